@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -117,3 +118,61 @@ func DeleteObjectsNotInRepo(directory string, blobdir string, blobstorage types.
 
 	return nil
 }
+
+// Move moves the blobs of the repository named from, with everything stored
+// next to it, to the name target. Blobs are copied through gickup, server-side
+// copies need extra authorization for some credentials.
+func Move(blobstorage types.AzureBlob, from, target string) (int, error) {
+	client, err := NewAzureBlobClient(blobstorage)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	pager := client.NewListBlobsFlatPager(blobstorage.Container, &azblob.ListBlobsFlatOptions{
+		Prefix: &from,
+	})
+
+	names := []string{}
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, blobItem := range page.Segment.BlobItems {
+			if types.StoredAs(*blobItem.Name, from) {
+				names = append(names, *blobItem.Name)
+			}
+		}
+	}
+
+	for _, name := range names {
+		moved := target + strings.TrimPrefix(name, from)
+		sub.Debug().Msgf("Moving %s to %s in container %s", name, moved, blobstorage.Container)
+		if err := copyBlob(ctx, client, blobstorage.Container, name, moved); err != nil {
+			return 0, err
+		}
+
+		_, err := client.DeleteBlob(ctx, blobstorage.Container, name, &azblob.DeleteBlobOptions{
+			DeleteSnapshots: to.Ptr(azblob.DeleteSnapshotsOptionTypeInclude),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(names), nil
+}
+
+func copyBlob(ctx context.Context, client *azblob.Client, container, src, dst string) error {
+	download, err := client.DownloadStream(ctx, container, src, nil)
+	if err != nil {
+		return err
+	}
+	defer download.Body.Close()
+
+	_, err = client.UploadStream(ctx, container, dst, download.Body, nil)
+
+	return err
+}
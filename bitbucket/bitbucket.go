@@ -1,11 +1,14 @@
 package bitbucket
 
 import (
+	"context"
 	"net/url"
 	"os"
 	"time"
 
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/ktrysmt/go-bitbucket"
 	"github.com/rs/zerolog"
@@ -14,7 +17,7 @@ import (
 var sub zerolog.Logger
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(ctx context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	for _, repo := range conf.Source.BitBucket {
@@ -31,12 +34,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			repo.Username = repo.User
 		}
 
-		include := types.GetMap(repo.Include)
-		exclude := types.GetMap(repo.Exclude)
-		includeorgs := types.GetMap(repo.IncludeOrgs)
-		excludeorgs := types.GetMap(repo.ExcludeOrgs)
+		include := types.NewMatcher(repo.Include)
+		exclude := types.NewMatcher(repo.Exclude)
+		includeorgs := types.NewMatcher(repo.IncludeOrgs)
+		excludeorgs := types.NewMatcher(repo.ExcludeOrgs)
 
 		client, err := bitbucket.NewBasicAuth(repo.Email, repo.Password)
+		if err == nil {
+			client.HttpClient.Transport = prometheus.InstrumentTransport("bitbucket", tracing.Transport(ctx, client.HttpClient.Transport))
+		}
 
 		if repo.URL == "" {
 			repo.URL = bitbucket.DEFAULT_BITBUCKET_API_BASE_URL
@@ -61,6 +67,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
 
 		sub.Info().
 			Msgf("grabbing repositories from %s", repo.User)
@@ -76,15 +86,13 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			} else {
 				for _, workspace := range workspaces.Workspaces {
 					if workspace.Slug != repo.User {
-						if len(includeorgs) > 0 {
-							if !includeorgs[workspace.Slug] {
+						if !includeorgs.Empty() {
+							if !includeorgs.Match(workspace.Slug) {
 								continue
 							}
 						}
-						if len(excludeorgs) > 0 {
-							if excludeorgs[workspace.Slug] {
-								continue
-							}
+						if excludeorgs.Match(workspace.Slug) {
+							continue
 						}
 						workspacerepos, err := client.Repositories.ListForAccount(&bitbucket.RepositoriesOptions{Owner: workspace.Slug})
 						if err != nil {
@@ -128,8 +136,11 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if time.Since(*r.UpdatedOnTime) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 				continue
 			}
+			if !repo.Filter.Match(filterEnv(r, user)) {
+				continue
+			}
 
-			if exclude[r.Name] {
+			if exclude.MatchRepo(user, r.Name) {
 				continue
 			}
 
@@ -138,8 +149,9 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 				origin.User = repo.Username
 			}
 
-			if include[r.Name] {
+			if include.MatchRepo(user, r.Name) {
 				repos = append(repos, types.Repo{
+					ID:          r.Uuid,
 					Name:        r.Name,
 					URL:         r.Links["clone"].([]interface{})[0].(map[string]interface{})["href"].(string),
 					SSHURL:      r.Links["clone"].([]interface{})[1].(map[string]interface{})["href"].(string),
@@ -149,13 +161,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Is_private,
+					Metadata:    getMetadata(r),
 				})
 
 				continue
 			}
 
-			if len(include) == 0 {
+			if include.Empty() {
 				repos = append(repos, types.Repo{
+					ID:          r.Uuid,
 					Name:        r.Name,
 					URL:         r.Links["clone"].([]interface{})[0].(map[string]interface{})["href"].(string),
 					SSHURL:      r.Links["clone"].([]interface{})[1].(map[string]interface{})["href"].(string),
@@ -165,6 +179,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Is_private,
+					Metadata:    getMetadata(r),
 				})
 			}
 		}
@@ -172,3 +187,54 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 
 	return repos, ran
 }
+
+// filterEnv get the attributes of a repository for filter expressions
+func filterEnv(repo bitbucket.Repository, owner string) types.FilterEnv {
+	env := types.FilterEnv{
+		Name:       repo.Name,
+		Owner:      owner,
+		Visibility: "public",
+		Fork:       repo.Parent != nil,
+		Language:   repo.Language,
+	}
+
+	if repo.Is_private {
+		env.Visibility = "private"
+	}
+
+	if repo.UpdatedOnTime != nil {
+		env.LastActivity = *repo.UpdatedOnTime
+	}
+
+	return env
+}
+
+// getMetadata get the metadata of a repository
+func getMetadata(repo bitbucket.Repository) *types.Metadata {
+	meta := &types.Metadata{
+		Description:   repo.Description,
+		DefaultBranch: repo.Mainbranch.Name,
+		Fork:          repo.Parent != nil,
+		Visibility:    "public",
+		CreatedAt:     repo.CreatedOnTime,
+		UpdatedAt:     repo.UpdatedOnTime,
+	}
+
+	if repo.Is_private {
+		meta.Visibility = "private"
+	}
+
+	if repo.Parent != nil {
+		meta.Parent = repo.Parent.Full_name
+	}
+
+	if repo.Language != "" {
+		meta.Languages = []string{repo.Language}
+	}
+
+	if repo.Project.Key != "" {
+		meta.Extra = map[string]interface{}{"project": repo.Project.Key}
+	}
+
+	return meta
+}
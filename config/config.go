@@ -0,0 +1,187 @@
+// Package config turns configuration files into documents ready to be
+// decoded into types.Conf. It decrypts them when needed, expands environment
+// placeholders, resolves includes and applies defaults.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// File is a loaded configuration file, its documents are ready to be decoded.
+type File struct {
+	Docs []ast.Node
+	// Sensitive is set when anything was decrypted, see Redact.
+	Sensitive bool
+	// Defaults is set when the file declares defaults.
+	Defaults bool
+}
+
+type loader struct {
+	stack     []string
+	sensitive bool
+}
+
+// ParseFile parses the configuration file at path with the content data.
+// Environment placeholders are expanded, included fragments are merged and
+// the defaults are applied to every document of the file.
+func ParseFile(path string, data []byte) (*File, error) {
+	l := &loader{}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	l.stack = append(l.stack, abs)
+
+	docs, err := l.parse(data, filepath.Dir(abs))
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Sensitive: l.sensitive}
+
+	defaults := &ast.MappingNode{}
+	for _, doc := range docs {
+		if d := extract(doc, defaultsKey); d != nil {
+			mapping, ok := d.(*ast.MappingNode)
+			if !ok {
+				return nil, fmt.Errorf("defaults must be a mapping")
+			}
+			merge(defaults, mapping, false)
+			file.Defaults = true
+		}
+	}
+
+	for _, doc := range docs {
+		if mapping, ok := doc.(*ast.MappingNode); ok && len(mapping.Values) > 0 {
+			merge(mapping, defaults, false)
+		}
+	}
+
+	file.Docs = docs
+
+	return file, nil
+}
+
+func (l *loader) load(path string) ([]ast.Node, error) {
+	if slices.Contains(l.stack, path) {
+		return nil, fmt.Errorf("include %s: circular include", path)
+	}
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+
+	l.stack = append(l.stack, path)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	docs, err := l.parse(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", path, err)
+	}
+
+	return docs, nil
+}
+
+func (l *loader) parse(data []byte, dir string) ([]ast.Node, error) {
+	file, sensitive, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	l.sensitive = l.sensitive || sensitive
+
+	docs := []ast.Node{}
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+
+		if err := l.resolveIncludes(doc.Body, dir); err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, doc.Body)
+	}
+
+	return docs, nil
+}
+
+// Parse parses the raw content of a configuration file. Whole-file age
+// encryption, SOPS and age encrypted single values are decrypted in memory
+// only. Environment placeholders are expanded before single values are
+// decrypted, so decrypted secrets are never interpolated. sensitive reports
+// whether anything was decrypted, in which case errors must not quote the
+// configuration, so they are reduced to the position.
+func Parse(data []byte) (*ast.File, bool, error) {
+	sensitive := false
+
+	if isAgeEncrypted(data) {
+		plain, err := decryptAge(data)
+		if err != nil {
+			return nil, false, fmt.Errorf("can't decrypt age configuration: %w", err)
+		}
+		data = plain
+		sensitive = true
+	}
+
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, sensitive, Redact(err, sensitive)
+	}
+
+	if isSOPS(file) {
+		plain, err := decryptSOPS(data)
+		if err != nil {
+			return nil, false, err
+		}
+		sensitive = true
+
+		file, err = parser.ParseBytes(plain, 0)
+		if err != nil {
+			return nil, sensitive, Redact(err, sensitive)
+		}
+	}
+
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+
+		if doc.Body, err = interpolate(doc.Body); err != nil {
+			return nil, sensitive, err
+		}
+	}
+
+	decrypted, err := decryptValues(file)
+	if err != nil {
+		return nil, sensitive, err
+	}
+
+	return file, sensitive || decrypted, nil
+}
+
+// Redact strips the quoted source from YAML errors of decrypted
+// configurations, keeping only where the error occurred.
+func Redact(err error, sensitive bool) error {
+	if !sensitive || err == nil {
+		return err
+	}
+
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil {
+		pos := yamlErr.GetToken().Position
+
+		return fmt.Errorf("invalid decrypted configuration at line %d, column %d", pos.Line, pos.Column)
+	}
+
+	return errors.New("invalid decrypted configuration")
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/cooperspencer/gickup/types"
+	"github.com/goccy/go-yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+const testKeyFile = "testdata/age.key"
+
+func testRecipient(t *testing.T) age.Recipient {
+	t.Helper()
+
+	data, err := os.ReadFile(testKeyFile)
+	if err != nil {
+		t.Fatalf("read key: %v", err)
+	}
+
+	ids, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+
+	return ids[0].(*age.X25519Identity).Recipient()
+}
+
+func encrypt(t *testing.T, plain string, armored bool) string {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	var out io.Writer = buf
+
+	var a io.WriteCloser
+	if armored {
+		a = armor.NewWriter(buf)
+		out = a
+	}
+
+	w, err := age.Encrypt(out, testRecipient(t))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if _, err := io.WriteString(w, plain); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if a != nil {
+		if err := a.Close(); err != nil {
+			t.Fatalf("armor: %v", err)
+		}
+	}
+
+	return buf.String()
+}
+
+func decode(t *testing.T, data []byte) (types.Conf, bool) {
+	t.Helper()
+
+	file, sensitive, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	var c types.Conf
+	if err := yaml.NodeToValue(file.Docs[0].Body, &c); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	return c, sensitive
+}
+
+func TestParsePlain(t *testing.T) {
+	c, sensitive := decode(t, []byte("source:\n  github:\n    - token: plain\n"))
+
+	if sensitive {
+		t.Fatalf("plain config must not be sensitive")
+	}
+	if c.Source.Github[0].Token != "plain" {
+		t.Fatalf("expected token plain, got %q", c.Source.Github[0].Token)
+	}
+}
+
+func TestParseAgeFile(t *testing.T) {
+	t.Setenv(AgeKeyFileEnv, testKeyFile)
+
+	plain := "source:\n  github:\n    - token: age-file-token\n"
+
+	for _, armored := range []bool{true, false} {
+		c, sensitive := decode(t, []byte(encrypt(t, plain, armored)))
+
+		if !sensitive {
+			t.Fatalf("decrypted config must be sensitive")
+		}
+		if c.Source.Github[0].Token != "age-file-token" {
+			t.Fatalf("expected decrypted token, got %q", c.Source.Github[0].Token)
+		}
+	}
+}
+
+func TestParseAgeValue(t *testing.T) {
+	key, err := os.ReadFile(testKeyFile)
+	if err != nil {
+		t.Fatalf("read key: %v", err)
+	}
+	t.Setenv(AgeKeyEnv, string(key))
+
+	secret := encrypt(t, "age-value-token", true)
+	data := "source:\n  github:\n    - user: cooperspencer\n      token: |\n        " +
+		strings.ReplaceAll(strings.TrimSpace(secret), "\n", "\n        ") + "\n"
+
+	c, sensitive := decode(t, []byte(data))
+
+	if !sensitive {
+		t.Fatalf("decrypted config must be sensitive")
+	}
+	if c.Source.Github[0].Token != "age-value-token" {
+		t.Fatalf("expected decrypted token, got %q", c.Source.Github[0].Token)
+	}
+	if c.Source.Github[0].User != "cooperspencer" {
+		t.Fatalf("expected user to stay untouched, got %q", c.Source.Github[0].User)
+	}
+}
+
+func TestParseSOPS(t *testing.T) {
+	t.Setenv(sopsAgeKeyFileEnv, "")
+	t.Setenv(AgeKeyFileEnv, testKeyFile)
+
+	data, err := os.ReadFile("testdata/sops.yml")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	c, sensitive := decode(t, data)
+
+	if !sensitive {
+		t.Fatalf("decrypted config must be sensitive")
+	}
+	if c.Source.Github[0].Token != "sops-secret-token" {
+		t.Fatalf("expected decrypted token, got %q", c.Source.Github[0].Token)
+	}
+	if len(c.Destination.Local) != 1 || c.Destination.Local[0].Path != "/backup" {
+		t.Fatalf("unexpected destinations: %+v", c.Destination.Local)
+	}
+}
+
+func TestParseMissingKey(t *testing.T) {
+	for _, env := range []string{AgeKeyEnv, AgeKeyFileEnv, sopsAgeKeyEnv, sopsAgeKeyFileEnv} {
+		t.Setenv(env, "")
+	}
+
+	_, _, err := Parse([]byte(encrypt(t, "cron: '* * * * *'\n", true)))
+	if !errors.Is(err, ErrNoIdentity) {
+		t.Fatalf("expected ErrNoIdentity, got %v", err)
+	}
+}
+
+func TestRedactHidesSource(t *testing.T) {
+	t.Setenv(AgeKeyFileEnv, testKeyFile)
+
+	data := encrypt(t, "source:\n  github:\n    - token: leaked-token\n      starred: [nope\n", true)
+
+	_, _, err := Parse([]byte(data))
+	if err == nil {
+		t.Fatalf("expected an error for invalid yaml")
+	}
+	if strings.Contains(err.Error(), "leaked-token") {
+		t.Fatalf("error leaks decrypted content: %v", err)
+	}
+	if !strings.Contains(err.Error(), "line") {
+		t.Fatalf("expected the error to keep the position, got %v", err)
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	t.Parallel()
+
+	a := []*types.Conf{{Source: types.Source{Github: []types.GenRepo{{User: "old", Token: "first-secret"}}}}}
+	b := []*types.Conf{{Source: types.Source{Github: []types.GenRepo{{User: "new", Token: "second-secret"}}}}}
+	a[0].Metrics.Heartbeat.URLs = []string{"https://hc-ping.com/first-uuid"}
+	b[0].Metrics.Heartbeat.URLs = []string{"https://hc-ping.com/second-uuid"}
+
+	diff := cmp.Diff(a, b, RedactSecrets())
+
+	for _, secret := range []string{"first-secret", "second-secret", "first-uuid", "second-uuid"} {
+		if strings.Contains(diff, secret) {
+			t.Fatalf("diff leaks %q:\n%s", secret, diff)
+		}
+	}
+	if !strings.Contains(diff, "new") || !strings.Contains(diff, "<redacted:") {
+		t.Fatalf("expected diff to show changed fields, got:\n%s", diff)
+	}
+}
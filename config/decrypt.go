@@ -0,0 +1,166 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/goccy/go-yaml/ast"
+)
+
+const (
+	// AgeKeyEnv holds one or more age identities (AGE-SECRET-KEY-...).
+	AgeKeyEnv = "GICKUP_AGE_KEY"
+	// AgeKeyFileEnv points to an age identity file.
+	AgeKeyFileEnv = "GICKUP_AGE_KEY_FILE"
+
+	sopsAgeKeyEnv     = "SOPS_AGE_KEY"
+	sopsAgeKeyFileEnv = "SOPS_AGE_KEY_FILE"
+
+	ageBinaryHeader = "age-encryption.org/v1"
+)
+
+// ErrNoIdentity is returned when an encrypted config is found but no age key
+// was configured to decrypt it.
+var ErrNoIdentity = fmt.Errorf("the configuration is encrypted, but neither %s nor %s is set", AgeKeyEnv, AgeKeyFileEnv)
+
+// isAgeEncrypted reports whether data is an age file, either binary or ASCII armored.
+func isAgeEncrypted(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+
+	return bytes.HasPrefix(trimmed, []byte(ageBinaryHeader)) || bytes.HasPrefix(trimmed, []byte(armor.Header))
+}
+
+// identities returns the age identities configured through the environment.
+// The SOPS variables are honored as well, so one key serves both formats.
+func identities() ([]age.Identity, error) {
+	keys := []string{}
+
+	for _, env := range []string{AgeKeyEnv, sopsAgeKeyEnv} {
+		if key := os.Getenv(env); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, env := range []string{AgeKeyFileEnv, sopsAgeKeyFileEnv} {
+		if file := os.Getenv(env); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("can't read age key file from %s: %w", env, err)
+			}
+			keys = append(keys, string(data))
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoIdentity
+	}
+
+	ids, err := age.ParseIdentities(strings.NewReader(strings.Join(keys, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse age identities: %w", err)
+	}
+
+	return ids, nil
+}
+
+// decryptAge decrypts a binary or armored age payload.
+func decryptAge(data []byte) ([]byte, error) {
+	ids, err := identities()
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = bytes.NewReader(bytes.TrimLeft(data, " \t\r\n"))
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(ageBinaryHeader)) {
+		src = armor.NewReader(src)
+	}
+
+	r, err := age.Decrypt(src, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+// isSOPS reports whether any document of the file carries SOPS metadata.
+func isSOPS(file *ast.File) bool {
+	for _, doc := range file.Docs {
+		mapping, ok := doc.Body.(*ast.MappingNode)
+		if !ok {
+			continue
+		}
+
+		for _, value := range mapping.Values {
+			if value.Key.GetToken().Value == "sops" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// decryptSOPS decrypts a SOPS encrypted YAML file. SOPS resolves its keys
+// itself (age, PGP, cloud KMS, Vault), the gickup age variables are only
+// passed on when the SOPS ones are unset.
+func decryptSOPS(data []byte) ([]byte, error) {
+	for gickupEnv, sopsEnv := range map[string]string{AgeKeyEnv: sopsAgeKeyEnv, AgeKeyFileEnv: sopsAgeKeyFileEnv} {
+		if os.Getenv(sopsEnv) == "" && os.Getenv(gickupEnv) != "" {
+			if err := os.Setenv(sopsEnv, os.Getenv(gickupEnv)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	plain, err := decrypt.DataWithFormat(data, formats.Yaml)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt sops configuration: %w", err)
+	}
+
+	return plain, nil
+}
+
+// decryptValues replaces every age armored string in the file with its
+// plaintext, so single values can be encrypted without encrypting the whole
+// file. It reports whether a value was decrypted.
+func decryptValues(file *ast.File) (bool, error) {
+	decrypted := false
+
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+
+		for _, node := range ast.Filter(ast.StringType, doc.Body) {
+			value, ok := node.(*ast.StringNode)
+			if !ok || !strings.HasPrefix(strings.TrimSpace(value.Value), armor.Header) {
+				continue
+			}
+
+			plain, err := decryptAge([]byte(value.Value))
+			if err != nil {
+				if errors.Is(err, ErrNoIdentity) {
+					return decrypted, err
+				}
+
+				pos := value.GetToken().Position
+
+				return decrypted, fmt.Errorf("can't decrypt value at line %d, column %d: %w", pos.Line, pos.Column, err)
+			}
+
+			value.Value = strings.TrimRight(string(plain), "\n")
+			decrypted = true
+		}
+	}
+
+	return decrypted, nil
+}
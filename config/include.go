@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-yaml/ast"
+)
+
+const (
+	includeKey  = "include"
+	defaultsKey = "defaults"
+)
+
+// extract removes key from the top level of the mapping and returns its value.
+func extract(body ast.Node, key string) ast.Node {
+	mapping, ok := body.(*ast.MappingNode)
+	if !ok {
+		return nil
+	}
+
+	for i, value := range mapping.Values {
+		if value.Key.GetToken().Value == key {
+			mapping.Values = append(mapping.Values[:i], mapping.Values[i+1:]...)
+
+			return value.Value
+		}
+	}
+
+	return nil
+}
+
+// merge merges src into dst. Values already set in dst win, nested mappings
+// are merged. Lists are prepended to the ones of dst if appendLists is set,
+// otherwise the list of dst is kept as is.
+func merge(dst, src *ast.MappingNode, appendLists bool) {
+	for _, value := range src.Values {
+		key := value.Key.GetToken().Value
+
+		var existing *ast.MappingValueNode
+		for _, v := range dst.Values {
+			if v.Key.GetToken().Value == key {
+				existing = v
+
+				break
+			}
+		}
+
+		if existing == nil {
+			dst.Values = append(dst.Values, value)
+
+			continue
+		}
+
+		switch dstValue := existing.Value.(type) {
+		case *ast.MappingNode:
+			if srcValue, ok := value.Value.(*ast.MappingNode); ok {
+				merge(dstValue, srcValue, appendLists)
+			}
+		case *ast.SequenceNode:
+			if srcValue, ok := value.Value.(*ast.SequenceNode); ok && appendLists {
+				dstValue.Values = append(append([]ast.Node{}, srcValue.Values...), dstValue.Values...)
+			}
+		case *ast.NullNode:
+			// `key:` without a value doesn't override anything
+			existing.Value = value.Value
+		}
+	}
+}
+
+// includePaths returns the files referenced by an include directive. Paths are
+// relative to the including file and may contain glob patterns.
+func includePaths(node ast.Node, dir string) ([]string, error) {
+	patterns := []string{}
+
+	switch n := node.(type) {
+	case *ast.StringNode:
+		patterns = append(patterns, n.Value)
+	case *ast.SequenceNode:
+		for _, value := range n.Values {
+			s, ok := value.(*ast.StringNode)
+			if !ok {
+				return nil, fmt.Errorf("include expects a path or a list of paths")
+			}
+			patterns = append(patterns, s.Value)
+		}
+	default:
+		return nil, fmt.Errorf("include expects a path or a list of paths")
+	}
+
+	paths := []string{}
+	for _, pattern := range patterns {
+		pattern = substituteHome(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", pattern, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("include %s: %w", pattern, os.ErrNotExist)
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
+
+// resolveIncludes merges the fragments referenced by the include directive of
+// body into it. Included lists come before the ones of the document itself.
+func (l *loader) resolveIncludes(body ast.Node, dir string) error {
+	directive := extract(body, includeKey)
+	if directive == nil {
+		return nil
+	}
+
+	mapping := body.(*ast.MappingNode)
+
+	paths, err := includePaths(directive, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		fragment, err := l.load(path)
+		if err != nil {
+			return err
+		}
+
+		if len(fragment) != 1 {
+			return fmt.Errorf("include %s: a fragment must contain exactly one document", path)
+		}
+
+		included, ok := fragment[0].(*ast.MappingNode)
+		if !ok {
+			return fmt.Errorf("include %s: a fragment must be a mapping", path)
+		}
+
+		merge(mapping, included, true)
+	}
+
+	return nil
+}
+
+func substituteHome(path string) string {
+	if len(path) > 1 && path[:2] == "~/" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+
+	return path
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+	"github.com/goccy/go-yaml"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	return dir
+}
+
+func loadConfs(t *testing.T, path string) ([]types.Conf, *File) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	file, err := ParseFile(path, data)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+
+	confs := []types.Conf{}
+	for _, doc := range file.Docs {
+		var c types.Conf
+		if err := yaml.NodeToValue(doc, &c); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		confs = append(confs, c)
+	}
+
+	return confs, file
+}
+
+func TestParseFileIncludes(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"conf.yml": `include:
+  - shared/destinations.yml
+  - teams/*.yml
+source:
+  github:
+    - user: main
+destination:
+  local:
+    - path: /main
+`,
+		"shared/destinations.yml": `destination:
+  local:
+    - path: /shared
+  s3:
+    - bucket: backups
+metrics:
+  heartbeat:
+    urls:
+      - https://hc.example.com/ping
+`,
+		"teams/a.yml": "source:\n  github:\n    - user: team-a\n",
+		"teams/b.yml": "source:\n  gitea:\n    - user: team-b\n",
+	})
+
+	confs, _ := loadConfs(t, filepath.Join(dir, "conf.yml"))
+	if len(confs) != 1 {
+		t.Fatalf("expected 1 config, got %d", len(confs))
+	}
+	c := confs[0]
+
+	if len(c.Source.Github) != 2 || c.Source.Github[0].User != "team-a" || c.Source.Github[1].User != "main" {
+		t.Fatalf("unexpected github sources: %+v", c.Source.Github)
+	}
+	if len(c.Source.Gitea) != 1 || c.Source.Gitea[0].User != "team-b" {
+		t.Fatalf("unexpected gitea sources: %+v", c.Source.Gitea)
+	}
+	if len(c.Destination.Local) != 2 || len(c.Destination.S3) != 1 {
+		t.Fatalf("unexpected destinations: %+v", c.Destination)
+	}
+	if len(c.Metrics.Heartbeat.URLs) != 1 {
+		t.Fatalf("expected included heartbeat, got %+v", c.Metrics.Heartbeat)
+	}
+}
+
+func TestParseFileIncludeErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"missing.yml":  "include: nope.yml\n",
+		"circular.yml": "include: other.yml\n",
+		"other.yml":    "include: circular.yml\n",
+	})
+
+	for name, want := range map[string]string{
+		"missing.yml":  "nope.yml",
+		"circular.yml": "circular include",
+	} {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		if _, err := ParseFile(path, data); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, want, err)
+		}
+	}
+}
+
+func TestParseFileDefaults(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		"conf.yml": `defaults:
+  cron: "0 22 * * *"
+  destination:
+    local:
+      - path: /default
+  metrics:
+    push:
+      ntfy:
+        - url: https://ntfy.sh/topic
+---
+source:
+  github:
+    - user: first
+---
+cron: "0 1 * * *"
+source:
+  gitea:
+    - user: second
+destination:
+  local:
+    - path: /own
+`,
+	})
+
+	confs, file := loadConfs(t, filepath.Join(dir, "conf.yml"))
+	if !file.Defaults {
+		t.Fatalf("expected the file to declare defaults")
+	}
+
+	confs = confs[1:] // the defaults document itself is empty
+	if len(confs) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(confs))
+	}
+
+	if confs[0].Cron != "0 22 * * *" || confs[0].Destination.Local[0].Path != "/default" {
+		t.Fatalf("defaults not applied: %+v", confs[0])
+	}
+	if confs[1].Cron != "0 1 * * *" {
+		t.Fatalf("document must override defaults, got cron %q", confs[1].Cron)
+	}
+	if len(confs[1].Destination.Local) != 1 || confs[1].Destination.Local[0].Path != "/own" {
+		t.Fatalf("document lists must replace default lists: %+v", confs[1].Destination.Local)
+	}
+	for _, c := range confs {
+		if len(c.Metrics.PushConfigs.Ntfy) != 1 {
+			t.Fatalf("expected default push config, got %+v", c.Metrics.PushConfigs)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"github.com/goccy/go-yaml/token"
+)
+
+// placeholderRx matches $${ESCAPED}, ${VAR} and ${VAR:-default}.
+var placeholderRx = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expand replaces the placeholders in s with the values of the environment.
+// A variable that is neither set nor has a default is an error, so a
+// forgotten export doesn't end up as an empty token.
+func expand(s string) (string, error) {
+	var missing []string
+
+	expanded := placeholderRx.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		groups := placeholderRx.FindStringSubmatch(match)
+		value, ok := os.LookupEnv(groups[1])
+		if ok && value != "" {
+			return value
+		}
+
+		if strings.Contains(match, ":-") {
+			return groups[2]
+		}
+
+		if !ok {
+			missing = append(missing, groups[1])
+		}
+
+		return value
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
+
+// interpolate expands the environment placeholders in every value of node
+// and returns the resulting node. A plain scalar consisting of a single
+// placeholder takes the type of its value, so `ssh: ${USE_SSH}` is a boolean.
+func interpolate(node ast.Node) (ast.Node, error) {
+	var err error
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			if _, err = interpolate(value); err != nil {
+				return nil, err
+			}
+		}
+	case *ast.MappingValueNode:
+		if n.Value, err = interpolate(n.Value); err != nil {
+			return nil, err
+		}
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			if n.Values[i], err = interpolate(value); err != nil {
+				return nil, err
+			}
+		}
+	case *ast.TagNode:
+		if n.Value, err = interpolate(n.Value); err != nil {
+			return nil, err
+		}
+	case *ast.AnchorNode:
+		if n.Value, err = interpolate(n.Value); err != nil {
+			return nil, err
+		}
+	case *ast.LiteralNode:
+		if _, err = interpolate(n.Value); err != nil {
+			return nil, err
+		}
+	case *ast.StringNode:
+		return interpolateString(n)
+	}
+
+	return node, nil
+}
+
+func interpolateString(n *ast.StringNode) (ast.Node, error) {
+	if !strings.Contains(n.Value, "${") {
+		return n, nil
+	}
+
+	value, err := expand(n.Value)
+	if err != nil {
+		pos := n.GetToken().Position
+
+		return nil, fmt.Errorf("line %d, column %d: %w", pos.Line, pos.Column, err)
+	}
+
+	lone := placeholderRx.FindString(n.Value) == n.Value && !strings.HasPrefix(n.Value, "$$")
+	if lone && n.GetToken().Type == token.StringType {
+		if file, err := parser.ParseBytes([]byte(value), 0); err == nil && len(file.Docs) == 1 {
+			switch typed := file.Docs[0].Body.(type) {
+			case *ast.BoolNode, *ast.IntegerNode, *ast.FloatNode:
+				typed.GetToken().Position = n.GetToken().Position
+
+				return typed, nil
+			}
+		}
+	}
+
+	n.Value = value
+
+	return n, nil
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("GICKUP_TEST_SET", "value")
+	t.Setenv("GICKUP_TEST_EMPTY", "")
+
+	for in, want := range map[string]string{
+		"${GICKUP_TEST_SET}":                   "value",
+		"prefix-${GICKUP_TEST_SET}-suffix":     "prefix-value-suffix",
+		"${GICKUP_TEST_UNSET:-fallback}":       "fallback",
+		"${GICKUP_TEST_EMPTY:-fallback}":       "fallback",
+		"${GICKUP_TEST_EMPTY}":                 "",
+		"$${GICKUP_TEST_SET}":                  "${GICKUP_TEST_SET}",
+		"no placeholder":                       "no placeholder",
+		"${GICKUP_TEST_SET}${GICKUP_TEST_SET}": "valuevalue",
+	} {
+		got, err := expand(in)
+		if err != nil {
+			t.Fatalf("expand(%q): %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("expand(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if _, err := expand("${GICKUP_TEST_UNSET}"); err == nil || !strings.Contains(err.Error(), "GICKUP_TEST_UNSET") {
+		t.Fatalf("expected an error naming the unset variable, got %v", err)
+	}
+}
+
+func TestParseInterpolates(t *testing.T) {
+	t.Setenv("GICKUP_TEST_TOKEN", "env-token")
+	t.Setenv("GICKUP_TEST_SSH", "true")
+	t.Setenv("GICKUP_TEST_KEEP", "5")
+
+	c, _ := decode(t, []byte(`source:
+  github:
+    - token: ${GICKUP_TEST_TOKEN}
+      user: "${GICKUP_TEST_USER:-cooperspencer}"
+      ssh: ${GICKUP_TEST_SSH}
+destination:
+  local:
+    - path: ${GICKUP_TEST_DIR:-/backup}/repos
+      keep: ${GICKUP_TEST_KEEP}
+`))
+
+	github := c.Source.Github[0]
+	if github.Token != "env-token" || github.User != "cooperspencer" || !github.SSH {
+		t.Fatalf("unexpected source: %+v", github)
+	}
+
+	local := c.Destination.Local[0]
+	if local.Path != "/backup/repos" || local.Keep != 5 {
+		t.Fatalf("unexpected destination: %+v", local)
+	}
+}
+
+func TestParseInterpolateMissing(t *testing.T) {
+	_, _, err := Parse([]byte("cron: ${GICKUP_TEST_UNSET}\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected an error with position, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// RedactSecrets is a cmp option that masks every field tagged with
+// `secret:"true"`, so configuration diffs can be logged. Changed secrets
+// still show up as a different fingerprint.
+func RedactSecrets() cmp.Option {
+	return cmp.FilterPath(isSecret, cmp.Transformer("redact", func(s string) string {
+		if s == "" {
+			return s
+		}
+
+		sum := sha256.Sum256([]byte(s))
+
+		return "<redacted:" + hex.EncodeToString(sum[:4]) + ">"
+	}))
+}
+
+// isSecret reports whether the closest struct field of the path is tagged as secret.
+func isSecret(p cmp.Path) bool {
+	for i := len(p) - 1; i > 0; i-- {
+		field, ok := p[i].(cmp.StructField)
+		if !ok {
+			continue
+		}
+
+		parent := p[i-1].Type()
+		for parent.Kind() == reflect.Pointer {
+			parent = parent.Elem()
+		}
+
+		f, ok := parent.FieldByName(field.Name())
+
+		return ok && f.Tag.Get("secret") == "true"
+	}
+
+	return false
+}
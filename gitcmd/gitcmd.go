@@ -8,6 +8,10 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/cooperspencer/gickup/metrics/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Auth struct {
@@ -49,7 +53,7 @@ func (g GitCmd) Command(ctx context.Context, auth *Auth, args ...string) *exec.C
 	return cmd
 }
 
-func (g GitCmd) Clone(url, reponame string, bare bool, mirror bool, auth *Auth) error {
+func (g GitCmd) Clone(ctx context.Context, url, reponame string, bare bool, mirror bool, auth *Auth) error {
 	args := []string{"clone", url, reponame}
 	if bare {
 		args = append(args, "--bare")
@@ -57,71 +61,83 @@ func (g GitCmd) Clone(url, reponame string, bare bool, mirror bool, auth *Auth)
 	if mirror {
 		args = append(args, "--mirror")
 	}
-	cmd := g.Command(context.Background(), auth, args...)
-	return cmd.Run()
+	cmd := g.Command(ctx, auth, args...)
+	return run(ctx, cmd)
 }
 
-func (g GitCmd) Pull(bare bool, mirror bool, repopath string, auth *Auth) error {
+func (g GitCmd) Pull(ctx context.Context, bare bool, mirror bool, repopath string, auth *Auth) error {
 	var args []string
 	if bare || mirror {
 		args = []string{"-C", repopath, "fetch", "--all"}
 	} else {
 		args = []string{"-C", repopath, "pull", "--all"}
 	}
-	cmd := g.Command(context.Background(), auth, args...)
-	return cmd.Run()
+	cmd := g.Command(ctx, auth, args...)
+	return run(ctx, cmd)
 }
 
-func (g GitCmd) Fetch(path string, auth *Auth) error {
+func (g GitCmd) Fetch(ctx context.Context, path string, auth *Auth) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"-C", path, "fetch", "--all", "--tags"}
-	cmd := g.Command(context.Background(), auth, args...)
-	return cmd.Run()
+	cmd := g.Command(ctx, auth, args...)
+	return run(ctx, cmd)
+}
+
+// FetchRefs fetches refspecs from origin, for example the heads of pull
+// requests which plain and bare clones leave out.
+func (g GitCmd) FetchRefs(ctx context.Context, path string, auth *Auth, refspecs ...string) error {
+	_, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"-C", path, "fetch", "origin"}, refspecs...)
+	cmd := g.Command(ctx, auth, args...)
+	return run(ctx, cmd)
 }
 
-func (g GitCmd) LFSFetch(path string, auth *Auth) error {
+func (g GitCmd) LFSFetch(ctx context.Context, path string, auth *Auth) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"-C", path, "lfs", "fetch", "--all"}
-	cmd := g.Command(context.Background(), auth, args...)
-	return cmd.Run()
+	cmd := g.Command(ctx, auth, args...)
+	return run(ctx, cmd)
 }
 
-func (g GitCmd) MirrorPull(path string, auth *Auth) error {
+func (g GitCmd) MirrorPull(ctx context.Context, path string, auth *Auth) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"-C", path, "pull", "--all", "--tags"}
-	cmd := g.Command(context.Background(), auth, args...)
-	return cmd.Run()
+	cmd := g.Command(ctx, auth, args...)
+	return run(ctx, cmd)
 }
 
-func (g GitCmd) NewRemote(name, url, path string) error {
+func (g GitCmd) NewRemote(ctx context.Context, name, url, path string) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"-C", path, "remote", "add", name, url}
-	cmd := g.Command(context.Background(), nil, args...)
+	cmd := g.Command(ctx, nil, args...)
 
-	return cmd.Run()
+	return run(ctx, cmd)
 }
 
-func (g GitCmd) Push(path, remote string, auth *Auth) error {
+func (g GitCmd) Push(ctx context.Context, path, remote string, auth *Auth) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"-C", path, "push", "--all", remote}
-	cmd := g.Command(context.Background(), auth, args...)
+	cmd := g.Command(ctx, auth, args...)
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(ctx, cmd)
 	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
@@ -132,15 +148,15 @@ func (g GitCmd) Push(path, remote string, auth *Auth) error {
 	return err
 }
 
-func (g GitCmd) Checkout(path, branch string) error {
+func (g GitCmd) Checkout(ctx context.Context, path, branch string) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"checkout", branch}
-	cmd := g.Command(context.Background(), nil, args...)
+	cmd := g.Command(ctx, nil, args...)
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(ctx, cmd)
 	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
@@ -151,16 +167,16 @@ func (g GitCmd) Checkout(path, branch string) error {
 	return err
 }
 
-func (g GitCmd) SSHPush(path, remote, key string) error {
+func (g GitCmd) SSHPush(ctx context.Context, path, remote, key string) error {
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
 	args := []string{"-C", path, "push", "--all", remote}
-	cmd := g.Command(context.Background(), nil, args...)
+	cmd := g.Command(ctx, nil, args...)
 	cmd.Env = append(os.Environ(), fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s", key))
 
-	output, err := cmd.CombinedOutput()
+	output, err := combinedOutput(ctx, cmd)
 	if err != nil {
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
@@ -170,3 +186,37 @@ func (g GitCmd) SSHPush(path, remote, key string) error {
 
 	return err
 }
+
+// span starts a span for the git subprocess cmd, named after its subcommand.
+func span(ctx context.Context, cmd *exec.Cmd) (context.Context, trace.Span) {
+	subcommand, dir := "", cmd.Dir
+	for i := 1; i < len(cmd.Args); i++ {
+		if cmd.Args[i] == "-C" && i+1 < len(cmd.Args) {
+			i++
+			dir = cmd.Args[i]
+
+			continue
+		}
+		subcommand = cmd.Args[i]
+
+		break
+	}
+
+	return tracing.Start(ctx, strings.TrimSpace("git "+subcommand), attribute.String("git.dir", dir))
+}
+
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	_, s := span(ctx, cmd)
+	err := cmd.Run()
+	tracing.End(s, err)
+
+	return err
+}
+
+func combinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	_, s := span(ctx, cmd)
+	output, err := cmd.CombinedOutput()
+	tracing.End(s, err)
+
+	return output, err
+}
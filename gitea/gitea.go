@@ -1,13 +1,23 @@
 package gitea
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"code.gitea.io/sdk/gitea"
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
+	"github.com/cooperspencer/gickup/releases"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/rs/zerolog"
 )
@@ -38,8 +48,9 @@ func getRepoVisibility(visibility string, private bool) bool {
 	}
 }
 
-// Backup TODO.
-func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
+// Backup mirrors r with a pull mirror on the Gitea destination d and returns
+// the error that stopped it.
+func Backup(r types.Repo, d types.GenRepo, dry bool) error {
 	orgvisibilty := getOrgVisibility(d.Visibility.Organizations)
 	repovisibility := getRepoVisibility(d.Visibility.Repositories, r.Private)
 	if d.URL == "" {
@@ -62,19 +73,17 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 	giteaclient, err := gitea.NewClient(d.URL, gitea.SetToken(d.GetToken()))
 	if err != nil {
 		sub.Error().Msg(err.Error())
-		return false
+		return err
 	}
 
 	user, _, err := giteaclient.GetMyUserInfo()
 	if err != nil {
 		sub.Error().
 			Msg(err.Error())
-		return false
+		return err
 	}
 
-	if d.User == "" && d.CreateOrg {
-		d.User = r.Owner
-	}
+	d.User = d.TargetOwner(r.Owner)
 
 	if d.User != "" {
 		user, _, err = giteaclient.GetUserInfo(d.User)
@@ -87,20 +96,20 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 				if err != nil {
 					sub.Error().
 						Msg(err.Error())
-					return false
+					return err
 				}
 				user.ID = org.ID
 				user.UserName = org.UserName
 			} else {
 				sub.Error().
 					Msg(err.Error())
-				return false
+				return err
 			}
 		}
 	}
 
 	if dry {
-		return true
+		return nil
 	}
 
 	repo, _, err := giteaclient.GetRepo(user.UserName, r.Name)
@@ -134,26 +143,27 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 			}
 		}
 
-		_, _, err := giteaclient.MigrateRepo(opts)
+		mirror, _, err := giteaclient.MigrateRepo(opts)
 		if err != nil {
 			sub.Error().
 				Msg(err.Error())
 			sub.Info().
 				Msgf("deleting %s again", types.Blue(r.Name))
-			_, err = giteaclient.DeleteRepo(user.UserName, r.Name)
-			if err != nil {
+			if _, err := giteaclient.DeleteRepo(user.UserName, r.Name); err != nil {
 				sub.Error().
 					Str("stage", "gitea").
 					Str("url", d.URL).
 					Msgf("couldn't delete %s!", types.Red(r.Name))
 			}
-			return false
+			return err
 		}
 
+		applyMetadata(giteaclient, mirror, r.GetMetadata())
+
 		sub.Info().
 			Msgf("mirrored %s to %s", types.Blue(r.Name), d.URL)
 
-		return true
+		return nil
 	}
 
 	if mirrorInterval != "" {
@@ -170,8 +180,8 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 			sub.Error().
 				Err(err).
 				Msgf("Couldn't update %s", types.Red(r.Name))
+			return err
 		}
-		return false
 	}
 
 	if repo.Mirror {
@@ -184,7 +194,7 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 				Str("stage", "gitea").
 				Str("url", d.URL).
 				Msg(err.Error())
-			return false
+			return err
 		}
 
 		sub.Info().
@@ -193,11 +203,11 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 			Msgf("successfully synced %s.", types.Blue(r.Name))
 	}
 
-	return true
+	return nil
 }
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(ctx context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	for _, repo := range conf.Source.Gitea {
@@ -210,6 +220,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
 		ran = true
 		if repo.User == "" {
 			sub.Info().
@@ -226,9 +240,9 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 		var client *gitea.Client
 		token := repo.GetToken()
 		if token != "" {
-			client, err = gitea.NewClient(repo.URL, gitea.SetToken(token))
+			client, err = gitea.NewClient(repo.URL, gitea.SetToken(token), gitea.SetHTTPClient(prometheus.InstrumentClient("gitea", tracing.Client(ctx))))
 		} else {
-			client, err = gitea.NewClient(repo.URL)
+			client, err = gitea.NewClient(repo.URL, gitea.SetHTTPClient(prometheus.InstrumentClient("gitea", tracing.Client(ctx))))
 		}
 
 		if token != "" && repo.User == "" {
@@ -274,14 +288,14 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 		}
 
-		include := types.GetMap(repo.Include)
-		exclude := types.GetMap(repo.Exclude)
-		includeorgs := types.GetMap(repo.IncludeOrgs)
-		excludeorgs := types.GetMap(repo.ExcludeOrgs)
+		include := types.NewMatcher(repo.Include)
+		exclude := types.NewMatcher(repo.Exclude)
+		includeorgs := types.NewMatcher(repo.IncludeOrgs)
+		excludeorgs := types.NewMatcher(repo.ExcludeOrgs)
 		for i := range repo.Filter.Languages {
 			repo.Filter.Languages[i] = strings.ToLower(repo.Filter.Languages[i])
 		}
-		languages := types.GetMap(repo.Filter.Languages)
+		languages := types.NewMatcher(repo.Filter.Languages)
 
 		for _, r := range gitearepos {
 			sub.Debug().Str("repo-type", "user").Msg(r.HTMLURL)
@@ -311,7 +325,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 						percentage = percent
 					}
 				}
-				if !languages[strings.ToLower(language)] {
+				if !languages.Match(strings.ToLower(language)) {
 					continue
 				}
 			}
@@ -322,12 +336,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if time.Since(r.Updated) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 				continue
 			}
+			if !repo.Filter.Match(filterEnv(r, client, repo.Filter)) {
+				continue
+			}
 
-			if exclude[r.Name] {
+			if exclude.MatchRepo(r.Owner.UserName, r.Name) {
 				continue
 			}
 
-			if include[r.Name] {
+			if include.MatchRepo(r.Owner.UserName, r.Name) {
 				repos = append(repos, types.Repo{
 					Name:        r.Name,
 					URL:         r.CloneURL,
@@ -338,12 +355,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo, token),
+					Size:        int64(r.Size),
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if r.HasWiki && repo.Wiki && types.StatRemote(r.CloneURL, r.SSHURL, repo) {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -370,12 +390,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo, token),
+					Size:        int64(r.Size),
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if r.HasWiki && repo.Wiki && types.StatRemote(r.CloneURL, r.SSHURL, repo) {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -408,25 +431,18 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 		orgrepos := []*gitea.Repository{}
 		for _, org := range orgs {
 			orgopt.Page = 1
-			if excludeorgs[org.UserName] {
+			if excludeorgs.Match(org.UserName) {
+				continue
+			}
+			if !includeorgs.Empty() && !includeorgs.Match(org.UserName) {
 				continue
 			}
 			for {
-				if len(includeorgs) > 0 {
-					if includeorgs[org.UserName] {
-						o := getOrgRepos(client, org, orgopt, repo)
-						if len(o) == 0 {
-							break
-						}
-						orgrepos = append(orgrepos, o...)
-					}
-				} else {
-					o := getOrgRepos(client, org, orgopt, repo)
-					if len(o) == 0 {
-						break
-					}
-					orgrepos = append(orgrepos, o...)
+				o := getOrgRepos(client, org, orgopt, repo)
+				if len(o) == 0 {
+					break
 				}
+				orgrepos = append(orgrepos, o...)
 				orgopt.Page++
 			}
 		}
@@ -458,7 +474,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 						percentage = percent
 					}
 				}
-				if !languages[strings.ToLower(language)] {
+				if !languages.Match(strings.ToLower(language)) {
 					continue
 				}
 			}
@@ -469,12 +485,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if time.Since(r.Updated) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 				continue
 			}
+			if !repo.Filter.Match(filterEnv(r, client, repo.Filter)) {
+				continue
+			}
 
-			if exclude[r.Name] {
+			if exclude.MatchRepo(r.Owner.UserName, r.Name) {
 				continue
 			}
 
-			if include[r.Name] {
+			if include.MatchRepo(r.Owner.UserName, r.Name) {
 				repos = append(repos, types.Repo{
 					Name:        r.Name,
 					URL:         r.CloneURL,
@@ -485,12 +504,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo, token),
+					Size:        int64(r.Size),
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if r.HasWiki && repo.Wiki && types.StatRemote(r.CloneURL, r.SSHURL, repo) {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -517,12 +539,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo, token),
+					Size:        int64(r.Size),
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if r.HasWiki && repo.Wiki && types.StatRemote(r.CloneURL, r.SSHURL, repo) {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -553,6 +578,16 @@ func getOrgRepos(client *gitea.Client, org *gitea.Organization,
 	return o
 }
 
+// enrich returns the function that fetches the issues, releases and metadata
+// of r, once it is known that r is backed up.
+func enrich(r *gitea.Repository, client *gitea.Client, conf types.GenRepo, token string) func(context.Context, *types.Repo) {
+	return func(ctx context.Context, repo *types.Repo) {
+		repo.Issues = GetIssues(r, client, conf)
+		repo.Releases = GetReleases(ctx, r, client, conf, token)
+		repo.Metadata = getMetadata(r, client, conf)
+	}
+}
+
 // GetIssues get issues
 func GetIssues(repo *gitea.Repository, client *gitea.Client, conf types.GenRepo) map[string]interface{} {
 	issues := map[string]interface{}{}
@@ -576,7 +611,7 @@ func GetIssues(repo *gitea.Repository, client *gitea.Client, conf types.GenRepo)
 			} else {
 				if len(i) > 0 {
 					for _, issue := range i {
-						issues[strconv.Itoa(int(issue.Index))] = issue
+						issues[strconv.Itoa(int(issue.Index))] = getIssue(client, repo.Owner.UserName, repo.Name, issue)
 					}
 				} else {
 					break
@@ -588,6 +623,22 @@ func GetIssues(repo *gitea.Repository, client *gitea.Client, conf types.GenRepo)
 	return issues
 }
 
+// applyMetadata sets the homepage and topics of a created repository, failures
+// are only logged.
+func applyMetadata(client *gitea.Client, r *gitea.Repository, meta types.Metadata) {
+	if meta.Homepage != "" {
+		if _, _, err := client.EditRepo(r.Owner.UserName, r.Name, gitea.EditRepoOption{Website: &meta.Homepage}); err != nil {
+			sub.Warn().Err(err).Str("repo", r.Name).Msg("can't set the homepage")
+		}
+	}
+
+	if len(meta.Topics) > 0 {
+		if _, err := client.SetRepoTopics(r.Owner.UserName, r.Name, meta.Topics); err != nil {
+			sub.Warn().Err(err).Str("repo", r.Name).Msg("can't set topics")
+		}
+	}
+}
+
 // GetOrCreate Get or create a repository
 func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	orgvisibilty := getOrgVisibility(destination.Visibility.Organizations)
@@ -608,9 +659,7 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	}
 	me := user
 
-	if destination.User == "" && destination.CreateOrg {
-		destination.User = repo.Owner
-	}
+	destination.User = destination.TargetOwner(repo.Owner)
 
 	if destination.User != "" {
 		user, _, err = giteaclient.GetUserInfo(destination.User)
@@ -633,10 +682,12 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 
 	r, _, err := giteaclient.GetRepo(user.UserName, repo.Name)
 	if err != nil {
+		meta := repo.GetMetadata()
 		opts := gitea.CreateRepoOption{
-			Name:        repo.Name,
-			Private:     repovisibility,
-			Description: repo.Description,
+			Name:          repo.Name,
+			Private:       repovisibility,
+			Description:   meta.Description,
+			DefaultBranch: meta.DefaultBranch,
 		}
 
 		if me.UserName == user.UserName {
@@ -650,7 +701,359 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 				return "", err
 			}
 		}
+
+		applyMetadata(giteaclient, r, meta)
 	}
 
 	return r.CloneURL, nil
 }
+
+// listAll fetches all pages of a list endpoint, until a page is empty since
+// the server may cap the page size.
+func listAll[T any](list func(opts gitea.ListOptions) ([]T, *gitea.Response, error)) ([]T, error) {
+	all := []T{}
+	opts := gitea.ListOptions{Page: 1, PageSize: 50}
+	for {
+		items, _, err := list(opts)
+		if err != nil {
+			return all, err
+		}
+
+		if len(items) == 0 {
+			return all, nil
+		}
+
+		all = append(all, items...)
+		opts.Page++
+	}
+}
+
+// filterEnv get the attributes of a repository for filter expressions, the
+// language is only fetched if the expression uses it
+func filterEnv(repo *gitea.Repository, client *gitea.Client, filter types.Filter) types.FilterEnv {
+	env := types.FilterEnv{
+		Name:         repo.Name,
+		Size:         int64(repo.Size),
+		Topics:       repo.Topics,
+		Visibility:   "public",
+		Archived:     repo.Archived,
+		Fork:         repo.Fork,
+		Stars:        repo.Stars,
+		LastActivity: repo.Updated,
+	}
+
+	switch {
+	case repo.Private:
+		env.Visibility = "private"
+	case repo.Internal:
+		env.Visibility = "internal"
+	}
+
+	if repo.Owner == nil {
+		return env
+	}
+
+	env.Owner = repo.Owner.UserName
+
+	if filter.Uses("language") {
+		languages, _, err := client.GetRepoLanguages(repo.Owner.UserName, repo.Name)
+		if err != nil {
+			sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch languages")
+		} else if sorted := types.SortLanguages(languages); len(sorted) > 0 {
+			env.Language = sorted[0]
+		}
+	}
+
+	return env
+}
+
+// getMetadata get the metadata of a repository, the languages and
+// collaborators are only fetched if enabled
+func getMetadata(repo *gitea.Repository, client *gitea.Client, conf types.GenRepo) *types.Metadata {
+	meta := &types.Metadata{
+		Description:   repo.Description,
+		Topics:        repo.Topics,
+		Homepage:      repo.Website,
+		DefaultBranch: repo.DefaultBranch,
+		License:       strings.Join(repo.Licenses, ", "),
+		Archived:      repo.Archived,
+		Fork:          repo.Fork,
+		Visibility:    "public",
+		CreatedAt:     &repo.Created,
+		UpdatedAt:     &repo.Updated,
+		Extra: map[string]interface{}{
+			"html_url": repo.HTMLURL,
+			"stars":    repo.Stars,
+			"forks":    repo.Forks,
+		},
+	}
+
+	switch {
+	case repo.Private:
+		meta.Visibility = "private"
+	case repo.Internal:
+		meta.Visibility = "internal"
+	}
+
+	if repo.Parent != nil {
+		meta.Parent = repo.Parent.FullName
+	}
+
+	if repo.OriginalURL != "" {
+		meta.Extra["original_url"] = repo.OriginalURL
+	}
+
+	if !conf.Metadata || repo.Owner == nil {
+		return meta
+	}
+
+	languages, _, err := client.GetRepoLanguages(repo.Owner.UserName, repo.Name)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch languages")
+	} else {
+		meta.Languages = types.SortLanguages(languages)
+	}
+
+	collaborators, err := listAll(func(opts gitea.ListOptions) ([]*gitea.User, *gitea.Response, error) {
+		return client.ListCollaborators(repo.Owner.UserName, repo.Name, gitea.ListCollaboratorsOptions{ListOptions: opts})
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch collaborators")
+	}
+
+	for _, collaborator := range collaborators {
+		meta.Collaborators = append(meta.Collaborators, collaborator.UserName)
+	}
+
+	return meta
+}
+
+// getIssue fetches the comments, reactions, timeline and attachments of an
+// issue, parts that can't be fetched are left empty.
+func getIssue(client *gitea.Client, owner, name string, issue *gitea.Issue) types.Issue {
+	i := types.NewIssue(issue)
+
+	if issue.Comments > 0 {
+		// the comments of an issue aren't paginated, the server returns all
+		comments, _, err := client.ListIssueComments(owner, name, issue.Index, gitea.ListIssueCommentOptions{ListOptions: gitea.ListOptions{Page: -1}})
+		if err != nil {
+			sub.Error().Err(err).Str("repo", name).Int64("issue", issue.Index).Msg("can't fetch comments")
+		}
+		i.Comments = types.List(comments)
+	}
+
+	reactions, _, err := client.GetIssueReactions(owner, name, issue.Index)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int64("issue", issue.Index).Msg("can't fetch reactions")
+	}
+	i.Reactions = types.List(reactions)
+
+	events, err := listAll(func(opts gitea.ListOptions) ([]*gitea.TimelineComment, *gitea.Response, error) {
+		return client.ListIssueTimeline(owner, name, issue.Index, gitea.ListIssueCommentOptions{ListOptions: opts})
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int64("issue", issue.Index).Msg("can't fetch timeline")
+	}
+	i.Events = types.List(events)
+
+	attachments, _, err := client.ListIssueAttachments(owner, name, issue.Index)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int64("issue", issue.Index).Msg("can't fetch attachments")
+	}
+	i.Attachments = types.List(attachments)
+
+	return i
+}
+
+// GetReleases get releases with their attachments
+func GetReleases(ctx context.Context, repo *gitea.Repository, client *gitea.Client, conf types.GenRepo, token string) []types.Release {
+	releases := []types.Release{}
+	if !conf.Releases {
+		return releases
+	}
+
+	r, err := listAll(func(opts gitea.ListOptions) ([]*gitea.Release, *gitea.Response, error) {
+		return client.ListReleases(repo.Owner.UserName, repo.Name, gitea.ListReleasesOptions{ListOptions: opts})
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch releases")
+		return releases
+	}
+
+	httpClient := prometheus.InstrumentClient("gitea", tracing.Client(ctx))
+	for _, release := range r {
+		rel := types.Release{
+			TagName:     release.TagName,
+			Name:        release.Title,
+			Body:        release.Note,
+			Draft:       release.IsDraft,
+			Prerelease:  release.IsPrerelease,
+			CreatedAt:   release.CreatedAt,
+			PublishedAt: release.PublishedAt,
+			Assets:      []types.Asset{},
+		}
+		if release.Publisher != nil {
+			rel.Author = release.Publisher.UserName
+		}
+
+		for _, attachment := range release.Attachments {
+			downloadURL := attachment.DownloadURL
+			rel.Assets = append(rel.Assets, types.Asset{
+				Name: attachment.Name,
+				Size: attachment.Size,
+				URL:  downloadURL,
+				Key:  attachment.UUID,
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					return download(ctx, httpClient, downloadURL, token)
+				},
+			})
+		}
+
+		releases = append(releases, rel)
+	}
+
+	return releases
+}
+
+// download opens an attachment, authenticated with token if it's set.
+func download(ctx context.Context, client *http.Client, url, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s failed with %s", req.URL.Redacted(), resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// CreateReleases recreates the releases of repo which are missing in the
+// repository at cloneurl.
+func CreateReleases(ctx context.Context, destination types.GenRepo, repo types.Repo, cloneurl string) error {
+	if destination.URL == "" {
+		destination.URL = "https://gitea.com/"
+	}
+
+	giteaclient, err := gitea.NewClient(destination.URL, gitea.SetToken(destination.GetToken()), gitea.SetContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(cloneurl)
+	if err != nil {
+		return err
+	}
+
+	owner, name := path.Split(strings.TrimSuffix(u.Path, ".git"))
+	owner = path.Base(owner)
+
+	errs := []error{}
+	for _, release := range repo.Releases {
+		existing, response, err := giteaclient.GetReleaseByTag(owner, name, release.TagName)
+		switch {
+		case err == nil:
+		case response == nil || response.StatusCode != http.StatusNotFound:
+			errs = append(errs, err)
+			continue
+		default:
+			existing, _, err = giteaclient.CreateRelease(owner, name, gitea.CreateReleaseOption{
+				TagName:      release.TagName,
+				Title:        release.Name,
+				Note:         release.Body,
+				IsDraft:      release.Draft,
+				IsPrerelease: release.Prerelease,
+			})
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			sub.Info().Str("repo", name).Msgf("created release %s", release.TagName)
+		}
+
+		// the assets of earlier runs are kept, the missing ones are uploaded
+		uploaded := map[string]bool{}
+		for _, attachment := range existing.Attachments {
+			uploaded[attachment.Name] = true
+		}
+
+		for i := range release.Assets {
+			asset := &release.Assets[i]
+			if uploaded[asset.Name] {
+				continue
+			}
+
+			cached, err := releases.Fetch(ctx, asset)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			file, err := os.Open(cached)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			_, _, err = giteaclient.CreateReleaseAttachment(owner, name, existing.ID, file, asset.Name)
+			file.Close()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			sub.Info().Str("repo", name).Msgf("uploaded asset %s of release %s", asset.Name, release.TagName)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Archive archives the repository name of owner on the destination, the
+// owner defaults to the user of the token
+func Archive(d types.GenRepo, owner, name string) error {
+	archived := true
+
+	return editRepo(d, owner, name, gitea.EditRepoOption{Archived: &archived})
+}
+
+// Rename renames the repository name of owner on the destination to newName
+func Rename(d types.GenRepo, owner, name, newName string) error {
+	return editRepo(d, owner, name, gitea.EditRepoOption{Name: &newName})
+}
+
+func editRepo(d types.GenRepo, owner, name string, opt gitea.EditRepoOption) error {
+	if d.URL == "" {
+		d.URL = "https://gitea.com/"
+	}
+	sub = logger.CreateSubLogger("stage", "gitea", "url", d.URL)
+
+	giteaclient, err := gitea.NewClient(d.URL, gitea.SetToken(d.GetToken()))
+	if err != nil {
+		return err
+	}
+
+	if owner == "" {
+		user, _, err := giteaclient.GetMyUserInfo()
+		if err != nil {
+			return err
+		}
+		owner = user.UserName
+	}
+
+	_, _, err = giteaclient.EditRepo(owner, name, opt)
+
+	return err
+}
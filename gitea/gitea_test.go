@@ -0,0 +1,56 @@
+package gitea
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"code.gitea.io/sdk/gitea"
+)
+
+func TestGetIssue(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// like Gitea, every page returns all comments
+	mux.HandleFunc("/api/v1/repos/alice/website/issues/1/comments", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 12, "body": "me too", "assets": [{"name": "log.txt"}]}]`)
+	})
+	mux.HandleFunc("/api/v1/repos/alice/website/issues/1/reactions", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"content": "+1"}]`)
+	})
+	mux.HandleFunc("/api/v1/repos/alice/website/issues/1/timeline", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "1" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		fmt.Fprint(w, `[{"type": "close"}, {"type": "comment"}]`)
+	})
+	mux.HandleFunc("/api/v1/repos/alice/website/issues/1/assets", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"name": "screenshot.png", "browser_download_url": "https://gitea.local/attachments/1"}]`)
+	})
+
+	client, err := gitea.NewClient(server.URL, gitea.SetGiteaVersion(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := getIssue(client, "alice", "website", &gitea.Issue{Index: 1, Comments: 1})
+	if len(issue.Comments) != 1 || len(issue.Comments[0].(*gitea.Comment).Attachments) != 1 {
+		t.Errorf("unexpected comments: %+v", issue.Comments)
+	}
+
+	if len(issue.Reactions) != 1 || len(issue.Events) != 2 || len(issue.Attachments) != 1 {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+
+	// the second issue has no comments and its other parts can't be fetched
+	second := getIssue(client, "alice", "website", &gitea.Issue{Index: 2})
+	if second.Comments == nil || len(second.Reactions) != 0 || len(second.Events) != 0 {
+		t.Errorf("unexpected issue: %+v", second)
+	}
+}
@@ -4,14 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
+	"github.com/cooperspencer/gickup/releases"
+	"github.com/cooperspencer/gickup/state"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/google/go-github/v74/github"
 	"github.com/rs/zerolog"
@@ -80,9 +88,10 @@ func hosterFromURL(instanceURL string) string {
 // It returns the client, the access token string (for git operations), and any error.
 func newGithubClient(ctx context.Context, repo types.GenRepo) (*github.Client, string, error) {
 	instURL := githubInstanceURL(repo.URL)
+	ctx = tracedContext(ctx)
 
 	if repo.HasAppAuth() {
-		itr, err := ghinstallation.NewKeyFromFile(http.DefaultTransport, repo.AppID, repo.AppInstallationID, repo.AppPrivateKeyFile)
+		itr, err := ghinstallation.NewKeyFromFile(prometheus.InstrumentTransport("github", tracing.Transport(ctx, http.DefaultTransport)), repo.AppID, repo.AppInstallationID, repo.AppPrivateKeyFile)
 		if err != nil {
 			return nil, "", fmt.Errorf("github app auth: %w", err)
 		}
@@ -107,7 +116,7 @@ func newGithubClient(ctx context.Context, repo types.GenRepo) (*github.Client, s
 
 	token := repo.GetToken()
 
-	var tc *http.Client
+	tc := prometheus.InstrumentClient("github", tracing.Client(ctx))
 	if token != "" {
 		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
 		tc = oauth2.NewClient(ctx, ts)
@@ -124,18 +133,24 @@ func newGithubClient(ctx context.Context, repo types.GenRepo) (*github.Client, s
 	}
 
 	if token == "" {
-		return github.NewClient(nil), "", nil
+		return github.NewClient(tc), "", nil
 	}
 
 	return github.NewClient(tc), token, nil
 }
 
-func getv4(token, user, instanceURL string) []V4Repo {
+// tracedContext makes oauth2 clients created from ctx trace and count their
+// requests.
+func tracedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, prometheus.InstrumentClient("github", tracing.Client(ctx)))
+}
+
+func getv4(ctx context.Context, token, user, instanceURL string) []V4Repo {
 	repos := []V4Repo{}
 	tokenSource := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	oauth2Client := oauth2.NewClient(context.Background(), tokenSource)
+	oauth2Client := oauth2.NewClient(tracedContext(ctx), tokenSource)
 
 	var client *githubv4.Client
 	if isGHE(instanceURL) {
@@ -151,7 +166,7 @@ func getv4(token, user, instanceURL string) []V4Repo {
 		"reposCursor": (*githubv4.String)(nil),
 	}
 	for {
-		err := client.Query(context.Background(), &query, variables)
+		err := client.Query(ctx, &query, variables)
 		if err != nil {
 			sub.Error().
 				Msg(err.Error())
@@ -178,6 +193,7 @@ func addWiki(r github.Repository, repo types.GenRepo, token, hoster string) type
 	}
 
 	return types.Repo{
+		ID:          strconv.FormatInt(r.GetID(), 10) + ".wiki",
 		Name:        *r.Name + ".wiki",
 		URL:         types.DotGitRx.ReplaceAllString(r.GetCloneURL(), ".wiki.git"),
 		SSHURL:      types.DotGitRx.ReplaceAllString(r.GetSSHURL(), ".wiki.git"),
@@ -191,7 +207,7 @@ func addWiki(r github.Repository, repo types.GenRepo, token, hoster string) type
 }
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(ctx context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	for _, repo := range conf.Source.Github {
@@ -203,6 +219,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
 		ran = true
 		if repo.User == "" {
 			sub.Info().
@@ -221,7 +241,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 		i := 1
 		githubrepos := []*github.Repository{}
 
-		client, token, err := newGithubClient(context.TODO(), repo)
+		client, token, err := newGithubClient(ctx, repo)
 		if err != nil {
 			sub.Error().Msg(err.Error())
 			continue
@@ -246,8 +266,8 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if repo.HasAppAuth() {
 				sub.Warn().Msg("contributed repos are not supported with GitHub App authentication, skipping")
 			} else {
-				for _, r := range getv4(token, v4user, instURL) {
-					githubRepo, _, err := client.Repositories.Get(context.Background(), r.User, r.Repository)
+				for _, r := range getv4(ctx, token, v4user, instURL) {
+					githubRepo, _, err := client.Repositories.Get(ctx, r.User, r.Repository)
 					if err != nil {
 						sub.Error().
 							Msg(err.Error())
@@ -328,14 +348,14 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 		}
 
-		include := types.GetMap(repo.Include)
-		includeorgs := types.GetMap(repo.IncludeOrgs)
-		exclude := types.GetMap(repo.Exclude)
-		excludeorgs := types.GetMap(repo.ExcludeOrgs)
+		include := types.NewMatcher(repo.Include)
+		includeorgs := types.NewMatcher(repo.IncludeOrgs)
+		exclude := types.NewMatcher(repo.Exclude)
+		excludeorgs := types.NewMatcher(repo.ExcludeOrgs)
 		for i := range repo.Filter.Languages {
 			repo.Filter.Languages[i] = strings.ToLower(repo.Filter.Languages[i])
 		}
-		languages := types.GetMap(repo.Filter.Languages)
+		languages := types.NewMatcher(repo.Filter.Languages)
 
 		for _, r := range githubrepos {
 			sub.Debug().Msg(*r.CloneURL)
@@ -353,7 +373,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 			if len(repo.Filter.Languages) > 0 {
 				if r.Language != nil {
-					if !languages[strings.ToLower(*r.Language)] {
+					if !languages.Match(strings.ToLower(*r.Language)) {
 						continue
 					}
 				}
@@ -367,16 +387,19 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if time.Since(r.PushedAt.Time) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 				continue
 			}
+			if !repo.Filter.Match(filterEnv(r)) {
+				continue
+			}
 
-			if exclude[*r.Name] {
+			if exclude.MatchRepo(r.GetOwner().GetLogin(), r.GetName()) {
 				continue
 			}
 
-			if excludeorgs[r.GetOwner().GetLogin()] {
+			if excludeorgs.Match(r.GetOwner().GetLogin()) {
 				continue
 			}
 
-			if include[*r.Name] {
+			if include.MatchRepo(r.GetOwner().GetLogin(), r.GetName()) {
 				repos = append(repos, types.Repo{
 					Name:        r.GetName(),
 					URL:         r.GetCloneURL(),
@@ -387,7 +410,9 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      hoster,
 					Description: r.GetDescription(),
 					Private:     r.GetPrivate(),
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo),
+					Size:        int64(r.GetSize()),
+					ID:          strconv.FormatInt(r.GetID(), 10),
 					NoTokenUser: true,
 				})
 				wiki := addWiki(*r, repo, token, hoster)
@@ -399,8 +424,8 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 
 			if len(repo.Include) == 0 {
-				if len(includeorgs) > 0 {
-					if includeorgs[r.GetOwner().GetLogin()] {
+				if !includeorgs.Empty() {
+					if includeorgs.Match(r.GetOwner().GetLogin()) {
 						repos = append(repos, types.Repo{
 							Name:        r.GetName(),
 							URL:         r.GetCloneURL(),
@@ -411,7 +436,9 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 							Hoster:      hoster,
 							Description: r.GetDescription(),
 							Private:     r.GetPrivate(),
-							Issues:      GetIssues(r, client, repo),
+							Enrich:      enrich(r, client, repo),
+							Size:        int64(r.GetSize()),
+							ID:          strconv.FormatInt(r.GetID(), 10),
 							NoTokenUser: true,
 						})
 						wiki := addWiki(*r, repo, token, hoster)
@@ -430,7 +457,9 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 						Hoster:      hoster,
 						Description: r.GetDescription(),
 						Private:     r.GetPrivate(),
-						Issues:      GetIssues(r, client, repo),
+						Enrich:      enrich(r, client, repo),
+						Size:        int64(r.GetSize()),
+						ID:          strconv.FormatInt(r.GetID(), 10),
 						NoTokenUser: true,
 					})
 					wiki := addWiki(*r, repo, token, hoster)
@@ -441,46 +470,299 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 		}
 		if repo.Gists {
-			gistlistoptions := &github.GistListOptions{ListOptions: github.ListOptions{PerPage: 50}}
-			i := 1
-			for {
-				gistlistoptions.Page = i
-				gists, _, err := client.Gists.List(context.Background(), repo.User, gistlistoptions)
-				if err != nil {
-					sub.Error().
-						Msg(err.Error())
-					continue
-				}
-				if len(gists) == 0 {
-					break
-				}
+			repos = append(repos, GetGists(ctx, client, repo, token, instURL, includeorgs, excludeorgs)...)
+		}
+	}
 
-				for _, gist := range gists {
-					sub.Debug().Msg(gist.GetHTMLURL())
-					gistSSHURL := fmt.Sprintf("git@gist.github.com:%s.git", gist.GetID())
-					if isGHE(instURL) {
-						gistSSHURL = fmt.Sprintf("git@%s:gist/%s.git", hoster, gist.GetID())
-					}
-					repos = append(repos, types.Repo{
-						Name:        fmt.Sprintf("gists%c%s", os.PathSeparator, gist.GetID()),
-						URL:         gist.GetHTMLURL(),
-						SSHURL:      gistSSHURL,
-						Token:       token,
-						Origin:      repo,
-						Owner:       gist.GetOwner().GetLogin(),
-						Hoster:      hoster,
-						Description: gist.GetDescription(),
-						Private:     !gist.GetPublic(),
-						NoTokenUser: true,
-					})
-				}
+	return repos, ran
+}
 
-				i++
+// enrich returns the function that fetches the issues, pull requests,
+// releases and metadata of r, once it is known that r is backed up.
+func enrich(r *github.Repository, client *github.Client, conf types.GenRepo) func(context.Context, *types.Repo) {
+	return func(ctx context.Context, repo *types.Repo) {
+		repo.Issues = GetIssues(ctx, r, client, conf)
+		repo.PullRequests = GetPullRequests(ctx, r, client, conf)
+		repo.Releases = GetReleases(ctx, r, client, conf)
+		repo.Metadata = getMetadata(ctx, r, client, conf)
+	}
+}
+
+// gistAliasRx matches everything but the characters kept in the aliases of
+// gists.
+var gistAliasRx = regexp.MustCompile(`[^\w.-]+`)
+
+// gistAlias returns the readable name of a gist, made of its description or
+// its first file name. aliases holds the names given in earlier runs by the
+// key <hoster>/<id>, once given a name stays even if the description changes.
+// Names are unique per hoster, colliding ones get the start of the ID appended.
+func gistAlias(aliases map[string]string, hoster string, gist *github.Gist) string {
+	key := hoster + "/" + gist.GetID()
+	if alias, ok := aliases[key]; ok {
+		return alias
+	}
+
+	alias := gist.GetDescription()
+	if alias == "" {
+		files := []string{}
+		for name := range gist.Files {
+			files = append(files, string(name))
+		}
+		sort.Strings(files)
+
+		if len(files) > 0 {
+			alias = files[0]
+		}
+	}
+
+	alias = strings.Trim(gistAliasRx.ReplaceAllString(alias, "-"), "-.")
+	if len(alias) > 64 {
+		alias = strings.TrimRight(alias[:64], "-.")
+	}
+
+	if alias == "" {
+		alias = gist.GetID()
+	}
+
+	for k, v := range aliases {
+		if v == alias && k != key && strings.HasPrefix(k, hoster+"/") {
+			alias = fmt.Sprintf("%s-%.7s", alias, gist.GetID())
+			break
+		}
+	}
+
+	aliases[key] = alias
+
+	return alias
+}
+
+// listGists lists the gists of the user, the authenticated user if it is
+// empty, and the starred gists and the gists of the members of organizations
+// the user administers if enabled.
+func listGists(ctx context.Context, client *github.Client, conf types.GenRepo, includeorgs, excludeorgs *types.Matcher) []*github.Gist {
+	gists := []*github.Gist{}
+	seen := map[string]bool{}
+	add := func(list []*github.Gist, err error) {
+		if err != nil {
+			sub.Error().
+				Msg(err.Error())
+		}
+
+		for _, gist := range list {
+			if !seen[gist.GetID()] {
+				seen[gist.GetID()] = true
+				gists = append(gists, gist)
 			}
 		}
 	}
 
-	return repos, ran
+	add(listAll(func(opts github.ListOptions) ([]*github.Gist, *github.Response, error) {
+		return client.Gists.List(ctx, conf.User, &github.GistListOptions{ListOptions: opts})
+	}))
+
+	if conf.Starred {
+		add(listAll(func(opts github.ListOptions) ([]*github.Gist, *github.Response, error) {
+			return client.Gists.ListStarred(ctx, &github.GistListOptions{ListOptions: opts})
+		}))
+	}
+
+	if conf.MemberGists {
+		memberships, err := listAll(func(opts github.ListOptions) ([]*github.Membership, *github.Response, error) {
+			return client.Organizations.ListOrgMemberships(ctx, &github.ListOrgMembershipsOptions{State: "active", ListOptions: opts})
+		})
+		if err != nil {
+			sub.Error().
+				Msg(err.Error())
+		}
+
+		for _, membership := range memberships {
+			org := membership.GetOrganization().GetLogin()
+			if membership.GetRole() != "admin" || excludeorgs.Match(org) || (!includeorgs.Empty() && !includeorgs.Match(org)) {
+				continue
+			}
+
+			members, err := listAll(func(opts github.ListOptions) ([]*github.User, *github.Response, error) {
+				return client.Organizations.ListMembers(ctx, org, &github.ListMembersOptions{ListOptions: opts})
+			})
+			if err != nil {
+				sub.Error().Err(err).Str("org", org).Msg("can't fetch members")
+				continue
+			}
+
+			for _, member := range members {
+				add(listAll(func(opts github.ListOptions) ([]*github.Gist, *github.Response, error) {
+					return client.Gists.List(ctx, member.GetLogin(), &github.GistListOptions{ListOptions: opts})
+				}))
+			}
+		}
+	}
+
+	return gists
+}
+
+// GetGists get the gists as repositories named gists/<alias> with their
+// comments
+func GetGists(ctx context.Context, client *github.Client, conf types.GenRepo, token, instURL string, includeorgs, excludeorgs *types.Matcher) []types.Repo {
+	repos := []types.Repo{}
+	hoster := hosterFromURL(instURL)
+
+	aliases := map[string]string{}
+	if err := state.Load("gists", &aliases); err != nil {
+		sub.Warn().Err(err).Msg("can't read the names of the gists")
+	}
+
+	for _, gist := range listGists(ctx, client, conf, includeorgs, excludeorgs) {
+		sub.Debug().Msg(gist.GetHTMLURL())
+		gistSSHURL := fmt.Sprintf("git@gist.github.com:%s.git", gist.GetID())
+		if isGHE(instURL) {
+			gistSSHURL = fmt.Sprintf("git@%s:gist/%s.git", hoster, gist.GetID())
+		}
+
+		// gists were named after their ID before they got aliases
+		_, named := aliases[hoster+"/"+gist.GetID()]
+		alias := gistAlias(aliases, hoster, gist)
+		previousName := ""
+		if !named && alias != gist.GetID() {
+			previousName = fmt.Sprintf("gists%c%s", os.PathSeparator, gist.GetID())
+		}
+
+		repos = append(repos, types.Repo{
+			ID:           "gist/" + gist.GetID(),
+			Name:         fmt.Sprintf("gists%c%s", os.PathSeparator, alias),
+			PreviousName: previousName,
+			URL:          gist.GetHTMLURL(),
+			SSHURL:       gistSSHURL,
+			Token:        token,
+			Origin:       conf,
+			Owner:        gist.GetOwner().GetLogin(),
+			Hoster:       hoster,
+			Description:  gist.GetDescription(),
+			Private:      !gist.GetPublic(),
+			Enrich: func(ctx context.Context, repo *types.Repo) {
+				repo.Comments = getGistComments(ctx, client, gist)
+			},
+			NoTokenUser: true,
+		})
+	}
+
+	if err := state.Save("gists", aliases); err != nil {
+		sub.Warn().Err(err).Msg("can't store the names of the gists")
+	}
+
+	return repos
+}
+
+// getGistComments get the comments of a gist by their ID
+func getGistComments(ctx context.Context, client *github.Client, gist *github.Gist) map[string]interface{} {
+	comments := map[string]interface{}{}
+	if gist.GetComments() == 0 {
+		return comments
+	}
+
+	list, err := listAll(func(opts github.ListOptions) ([]*github.GistComment, *github.Response, error) {
+		return client.Gists.ListComments(ctx, gist.GetID(), &opts)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("gist", gist.GetID()).Msg("can't fetch comments")
+	}
+
+	for _, comment := range list {
+		comments[strconv.FormatInt(comment.GetID(), 10)] = comment
+	}
+
+	return comments
+}
+
+// filterEnv get the attributes of a repository for filter expressions
+func filterEnv(repo *github.Repository) types.FilterEnv {
+	visibility := repo.GetVisibility()
+	if visibility == "" {
+		visibility = "public"
+		if repo.GetPrivate() {
+			visibility = "private"
+		}
+	}
+
+	return types.FilterEnv{
+		Name:         repo.GetName(),
+		Owner:        repo.GetOwner().GetLogin(),
+		Size:         int64(repo.GetSize()),
+		Topics:       repo.Topics,
+		Visibility:   visibility,
+		Archived:     repo.GetArchived(),
+		Fork:         repo.GetFork(),
+		Stars:        repo.GetStargazersCount(),
+		Language:     repo.GetLanguage(),
+		LastActivity: repo.GetPushedAt().Time,
+	}
+}
+
+// getMetadata get the metadata of a repository, the languages, collaborators
+// and the parent of forks are only fetched if enabled
+func getMetadata(ctx context.Context, repo *github.Repository, client *github.Client, conf types.GenRepo) *types.Metadata {
+	meta := &types.Metadata{
+		Description:   repo.GetDescription(),
+		Topics:        repo.Topics,
+		Homepage:      repo.GetHomepage(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		License:       repo.GetLicense().GetSPDXID(),
+		Archived:      repo.GetArchived(),
+		Fork:          repo.GetFork(),
+		Parent:        repo.GetParent().GetFullName(),
+		Visibility:    repo.GetVisibility(),
+		Extra: map[string]interface{}{
+			"html_url": repo.GetHTMLURL(),
+			"stars":    repo.GetStargazersCount(),
+			"forks":    repo.GetForksCount(),
+		},
+	}
+
+	if repo.CreatedAt != nil {
+		meta.CreatedAt = &repo.CreatedAt.Time
+	}
+
+	if repo.UpdatedAt != nil {
+		meta.UpdatedAt = &repo.UpdatedAt.Time
+	}
+
+	if repo.GetLanguage() != "" {
+		meta.Languages = []string{repo.GetLanguage()}
+	}
+
+	if !conf.Metadata {
+		return meta
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	if meta.Fork && meta.Parent == "" {
+		full, _, err := client.Repositories.Get(ctx, owner, name)
+		if err != nil {
+			sub.Error().Err(err).Str("repo", name).Msg("can't fetch the parent")
+		} else {
+			meta.Parent = full.GetParent().GetFullName()
+		}
+	}
+
+	languages, _, err := client.Repositories.ListLanguages(ctx, owner, name)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Msg("can't fetch languages")
+	} else if len(languages) > 0 {
+		meta.Languages = types.SortLanguages(languages)
+	}
+
+	collaborators, err := listAll(func(opts github.ListOptions) ([]*github.User, *github.Response, error) {
+		return client.Repositories.ListCollaborators(ctx, owner, name, &github.ListCollaboratorsOptions{ListOptions: opts})
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Msg("can't fetch collaborators")
+	}
+
+	for _, collaborator := range collaborators {
+		meta.Collaborators = append(meta.Collaborators, collaborator.GetLogin())
+	}
+
+	return meta
 }
 
 // GetOrCreate Get or create a repository
@@ -514,8 +796,9 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 		if !strings.Contains(err.Error(), "404 Not Found") {
 			return "", err
 		}
+		meta := repo.GetMetadata()
 		if destination.Organization == "" {
-			r, _, err = client.Repositories.Create(context.TODO(), "", &github.Repository{Name: github.String(repo.Name), Private: github.Bool(destination.Visibility.Repositories == "private"), Visibility: github.String(destination.Visibility.Repositories), Owner: dest.User})
+			r, _, err = client.Repositories.Create(context.TODO(), "", &github.Repository{Name: github.String(repo.Name), Private: github.Bool(destination.Visibility.Repositories == "private"), Visibility: github.String(destination.Visibility.Repositories), Owner: dest.User, Description: github.String(meta.Description), Homepage: github.String(meta.Homepage)})
 			if err != nil {
 				return "", err
 			}
@@ -523,26 +806,33 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 			if destination.Visibility.Repositories == "" {
 				destination.Visibility.Repositories = "private"
 			}
-			r, _, err = client.Repositories.Create(context.TODO(), *dest.Organization.Login, &github.Repository{Name: github.String(repo.Name), Private: github.Bool(destination.Visibility.Repositories == "private"), Visibility: github.String(destination.Visibility.Repositories), Organization: dest.Organization})
+			r, _, err = client.Repositories.Create(context.TODO(), *dest.Organization.Login, &github.Repository{Name: github.String(repo.Name), Private: github.Bool(destination.Visibility.Repositories == "private"), Visibility: github.String(destination.Visibility.Repositories), Organization: dest.Organization, Description: github.String(meta.Description), Homepage: github.String(meta.Homepage)})
 			if err != nil {
 				return "", err
 			}
 		}
+
+		// the default branch can only be set once it is pushed
+		if len(meta.Topics) > 0 {
+			if _, _, err := client.Repositories.ReplaceAllTopics(context.TODO(), r.GetOwner().GetLogin(), r.GetName(), meta.Topics); err != nil {
+				sub.Warn().Err(err).Str("repo", repo.Name).Msg("can't set topics")
+			}
+		}
 	}
 
 	return *r.CloneURL, nil
 }
 
 // GetIssues get issues
-func GetIssues(repo *github.Repository, client *github.Client, conf types.GenRepo) map[string]interface{} {
+func GetIssues(ctx context.Context, repo *github.Repository, client *github.Client, conf types.GenRepo) map[string]interface{} {
 	issues := map[string]interface{}{}
 	if conf.Issues {
 		listOptions := &github.IssueListByRepoOptions{State: "all", ListCursorOptions: github.ListCursorOptions{PerPage: 100}}
 		errorcount := 0
 		for {
-			i, response, err := client.Issues.ListByRepo(context.Background(), *repo.Owner.Login, *repo.Name, listOptions)
+			i, response, err := client.Issues.ListByRepo(ctx, *repo.Owner.Login, *repo.Name, listOptions)
 			if err != nil {
-				if response.StatusCode == http.StatusForbidden {
+				if response != nil && response.StatusCode == http.StatusForbidden {
 					sub.Error().Err(err).Str("repo", *repo.Name).Msg("can't fetch issues")
 					return issues
 				}
@@ -555,7 +845,7 @@ func GetIssues(repo *github.Repository, client *github.Client, conf types.GenRep
 				}
 			} else {
 				for _, issue := range i {
-					issues[strconv.Itoa(*issue.Number)] = issue
+					issues[strconv.Itoa(*issue.Number)] = getIssue(ctx, client, *repo.Owner.Login, *repo.Name, issue)
 				}
 
 				if response.After == "" {
@@ -568,3 +858,338 @@ func GetIssues(repo *github.Repository, client *github.Client, conf types.GenRep
 	}
 	return issues
 }
+
+// getIssue fetches the comments and events of an issue, parts that can't be
+// fetched are left empty. The reactions are part of the issue and its
+// comments.
+func getIssue(ctx context.Context, client *github.Client, owner, name string, issue *github.Issue) types.Issue {
+	number := issue.GetNumber()
+	i := types.NewIssue(issue)
+
+	if issue.GetComments() > 0 {
+		comments, err := listAll(func(opts github.ListOptions) ([]*github.IssueComment, *github.Response, error) {
+			return client.Issues.ListComments(ctx, owner, name, number, &github.IssueListCommentsOptions{ListOptions: opts})
+		})
+		if err != nil {
+			sub.Error().Err(err).Str("repo", name).Int("issue", number).Msg("can't fetch comments")
+		}
+		i.Comments = types.List(comments)
+	}
+
+	events, err := listAll(func(opts github.ListOptions) ([]*github.IssueEvent, *github.Response, error) {
+		return client.Issues.ListIssueEvents(ctx, owner, name, number, &opts)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int("issue", number).Msg("can't fetch events")
+	}
+	i.Events = types.List(events)
+
+	return i
+}
+
+// PullRequest is a pull request with its reviews and discussion, the lists
+// replace the counts of the API.
+type PullRequest struct {
+	*github.PullRequest
+	Reviews        []*github.PullRequestReview  `json:"reviews"`
+	ReviewComments []*github.PullRequestComment `json:"review_comments"`
+	Comments       []*github.IssueComment       `json:"comments"`
+	Commits        []*github.RepositoryCommit   `json:"commits"`
+	Timeline       []*github.Timeline           `json:"timeline"`
+}
+
+// listAll fetches all pages of a list endpoint.
+func listAll[T any](list func(opts github.ListOptions) ([]T, *github.Response, error)) ([]T, error) {
+	all := []T{}
+	opts := github.ListOptions{PerPage: 100}
+	for {
+		items, response, err := list(opts)
+		if err != nil {
+			return all, err
+		}
+
+		all = append(all, items...)
+
+		if response.NextPage == 0 {
+			return all, nil
+		}
+
+		opts.Page = response.NextPage
+	}
+}
+
+// GetPullRequests get pull requests with their reviews, comments, commits and timeline
+func GetPullRequests(ctx context.Context, repo *github.Repository, client *github.Client, conf types.GenRepo) map[string]interface{} {
+	pulls := map[string]interface{}{}
+	if !conf.PullRequests {
+		return pulls
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	listOptions := &github.PullRequestListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	errorcount := 0
+	for {
+		p, response, err := client.PullRequests.List(ctx, owner, name, listOptions)
+		if err != nil {
+			if response != nil && response.StatusCode == http.StatusForbidden {
+				sub.Error().Err(err).Str("repo", name).Msg("can't fetch pull requests")
+				return pulls
+			}
+			if errorcount < 5 {
+				sub.Warn().Err(err).Str("repo", name).Msg("can't fetch pull requests")
+				time.Sleep(5 * time.Second)
+				errorcount++
+				continue
+			}
+			return pulls
+		}
+
+		for _, pull := range p {
+			pulls[strconv.Itoa(pull.GetNumber())] = getPullRequest(ctx, client, owner, name, pull)
+		}
+
+		if response.NextPage == 0 {
+			break
+		}
+
+		listOptions.Page = response.NextPage
+	}
+
+	return pulls
+}
+
+// getPullRequest fetches the reviews and discussion of a pull request, parts
+// that can't be fetched are left empty.
+func getPullRequest(ctx context.Context, client *github.Client, owner, name string, pull *github.PullRequest) PullRequest {
+	number := pull.GetNumber()
+	pr := PullRequest{PullRequest: pull}
+
+	var err error
+	pr.Reviews, err = listAll(func(opts github.ListOptions) ([]*github.PullRequestReview, *github.Response, error) {
+		return client.PullRequests.ListReviews(ctx, owner, name, number, &opts)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int("pull", number).Msg("can't fetch reviews")
+	}
+
+	pr.ReviewComments, err = listAll(func(opts github.ListOptions) ([]*github.PullRequestComment, *github.Response, error) {
+		return client.PullRequests.ListComments(ctx, owner, name, number, &github.PullRequestListCommentsOptions{ListOptions: opts})
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int("pull", number).Msg("can't fetch review comments")
+	}
+
+	pr.Comments, err = listAll(func(opts github.ListOptions) ([]*github.IssueComment, *github.Response, error) {
+		return client.Issues.ListComments(ctx, owner, name, number, &github.IssueListCommentsOptions{ListOptions: opts})
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int("pull", number).Msg("can't fetch comments")
+	}
+
+	pr.Commits, err = listAll(func(opts github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+		return client.PullRequests.ListCommits(ctx, owner, name, number, &opts)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int("pull", number).Msg("can't fetch commits")
+	}
+
+	pr.Timeline, err = listAll(func(opts github.ListOptions) ([]*github.Timeline, *github.Response, error) {
+		return client.Issues.ListIssueTimeline(ctx, owner, name, number, &opts)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int("pull", number).Msg("can't fetch timeline")
+	}
+
+	return pr
+}
+
+// GetReleases get releases with their assets
+func GetReleases(ctx context.Context, repo *github.Repository, client *github.Client, conf types.GenRepo) []types.Release {
+	releases := []types.Release{}
+	if !conf.Releases {
+		return releases
+	}
+
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+	r, err := listAll(func(opts github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+		return client.Repositories.ListReleases(ctx, owner, name, &opts)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Msg("can't fetch releases")
+		return releases
+	}
+
+	for _, release := range r {
+		rel := types.Release{
+			TagName:     release.GetTagName(),
+			Name:        release.GetName(),
+			Body:        release.GetBody(),
+			Author:      release.GetAuthor().GetLogin(),
+			Draft:       release.GetDraft(),
+			Prerelease:  release.GetPrerelease(),
+			CreatedAt:   release.GetCreatedAt().Time,
+			PublishedAt: release.GetPublishedAt().Time,
+			Assets:      []types.Asset{},
+		}
+
+		for _, asset := range release.Assets {
+			id := asset.GetID()
+			rel.Assets = append(rel.Assets, types.Asset{
+				Name:        asset.GetName(),
+				ContentType: asset.GetContentType(),
+				Size:        int64(asset.GetSize()),
+				URL:         asset.GetBrowserDownloadURL(),
+				SHA256:      strings.TrimPrefix(asset.GetDigest(), "sha256:"),
+				Key:         fmt.Sprintf("%s@%s", asset.GetURL(), asset.GetUpdatedAt()),
+				Open: func(ctx context.Context) (io.ReadCloser, error) {
+					// the redirect to the storage of the asset must not carry the token
+					body, _, err := client.Repositories.DownloadReleaseAsset(ctx, owner, name, id, prometheus.InstrumentClient("github", tracing.Client(ctx)))
+					return body, err
+				},
+			})
+		}
+
+		releases = append(releases, rel)
+	}
+
+	return releases
+}
+
+// CreateReleases recreates the releases of repo which are missing in the
+// repository at cloneurl.
+func CreateReleases(ctx context.Context, destination types.GenRepo, repo types.Repo, cloneurl string) error {
+	client, _, err := newGithubClient(ctx, destination)
+	if err != nil {
+		return err
+	}
+
+	owner, name, err := ownerAndName(cloneurl)
+	if err != nil {
+		return err
+	}
+
+	// the releases are listed, looking them up by tag misses drafts
+	listed, err := listAll(func(opts github.ListOptions) ([]*github.RepositoryRelease, *github.Response, error) {
+		return client.Repositories.ListReleases(ctx, owner, name, &opts)
+	})
+	if err != nil {
+		return err
+	}
+
+	tags := map[string]*github.RepositoryRelease{}
+	for _, release := range listed {
+		tags[release.GetTagName()] = release
+	}
+
+	errs := []error{}
+	for _, release := range repo.Releases {
+		existing, ok := tags[release.TagName]
+		if !ok {
+			existing, _, err = client.Repositories.CreateRelease(ctx, owner, name, &github.RepositoryRelease{
+				TagName:    github.Ptr(release.TagName),
+				Name:       github.Ptr(release.Name),
+				Body:       github.Ptr(release.Body),
+				Draft:      github.Ptr(release.Draft),
+				Prerelease: github.Ptr(release.Prerelease),
+			})
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			sub.Info().Str("repo", name).Msgf("created release %s", release.TagName)
+		}
+
+		// the assets of earlier runs are kept, the missing ones are uploaded
+		uploaded := map[string]bool{}
+		for _, asset := range existing.Assets {
+			if asset.GetState() == "uploaded" {
+				uploaded[asset.GetName()] = true
+				continue
+			}
+
+			// a failed upload blocks the name of the asset
+			if _, err := client.Repositories.DeleteReleaseAsset(ctx, owner, name, asset.GetID()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		for i := range release.Assets {
+			asset := &release.Assets[i]
+			if uploaded[asset.Name] {
+				continue
+			}
+
+			cached, err := releases.Fetch(ctx, asset)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			file, err := os.Open(cached)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			_, _, err = client.Repositories.UploadReleaseAsset(ctx, owner, name, existing.GetID(), &github.UploadOptions{Name: asset.Name}, file)
+			file.Close()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			sub.Info().Str("repo", name).Msgf("uploaded asset %s of release %s", asset.Name, release.TagName)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ownerAndName returns the owner and name of the repository at cloneurl.
+func ownerAndName(cloneurl string) (string, string, error) {
+	u, err := url.Parse(cloneurl)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/"), "/")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("can't find the repository in %s", u.Redacted())
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// Archive archives the repository name on the destination
+func Archive(ctx context.Context, destination types.GenRepo, name string) error {
+	return editRepository(ctx, destination, name, &github.Repository{Archived: github.Ptr(true)})
+}
+
+// Rename renames the repository name on the destination to newName
+func Rename(ctx context.Context, destination types.GenRepo, name, newName string) error {
+	return editRepository(ctx, destination, name, &github.Repository{Name: github.Ptr(newName)})
+}
+
+// editRepository edits the repository name of the organization of the
+// destination, or of the user of the token without one
+func editRepository(ctx context.Context, destination types.GenRepo, name string, edit *github.Repository) error {
+	sub = logger.CreateSubLogger("stage", "github", "url", githubInstanceURL(destination.URL))
+	client, _, err := newGithubClient(ctx, destination)
+	if err != nil {
+		return err
+	}
+
+	login := destination.Organization
+	if login == "" {
+		user, _, err := client.Users.Get(ctx, "")
+		if err != nil {
+			return err
+		}
+		login = user.GetLogin()
+	}
+
+	_, _, err = client.Repositories.Edit(ctx, login, name, edit)
+
+	return err
+}
@@ -2,11 +2,22 @@ package github
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/cooperspencer/gickup/releases"
+	"github.com/cooperspencer/gickup/state"
 	"github.com/cooperspencer/gickup/types"
+	"github.com/google/go-github/v74/github"
 )
 
 func TestNewGithubClientUnauthenticated(t *testing.T) {
@@ -82,3 +93,436 @@ func TestNewGithubClientAppAuthMissingKeyFile(t *testing.T) {
 		t.Fatal("expected error when App private key file does not exist")
 	}
 }
+
+func TestGetPullRequests(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/repos/alice/website/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "all" {
+			t.Errorf("closed pull requests are missing, query %s", r.URL.RawQuery)
+		}
+
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"number": 2, "title": "second"}]`)
+			return
+		}
+
+		w.Header().Set("Link", fmt.Sprintf(`<%s/repos/alice/website/pulls?page=2>; rel="next"`, server.URL))
+		fmt.Fprint(w, `[{"number": 1, "title": "first", "labels": [{"name": "bug"}], "comments": 1}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/pulls/1/reviews", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 10, "state": "APPROVED"}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/pulls/1/comments", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 11, "body": "nit", "path": "main.go"}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/issues/1/comments", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 12, "body": "thanks"}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/pulls/1/commits", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"sha": "abc"}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/issues/1/timeline", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"event": "labeled"}]`)
+	})
+	// the discussion of the second pull request can't be fetched
+	mux.HandleFunc("/repos/alice/website/", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	repo := &github.Repository{Name: github.Ptr("website"), Owner: &github.User{Login: github.Ptr("alice")}}
+
+	if pulls := GetPullRequests(context.Background(), repo, client, types.GenRepo{}); len(pulls) != 0 {
+		t.Fatalf("fetched %d pull requests without the option", len(pulls))
+	}
+
+	pulls := GetPullRequests(context.Background(), repo, client, types.GenRepo{PullRequests: true})
+	if len(pulls) != 2 {
+		t.Fatalf("got %d pull requests, want 2", len(pulls))
+	}
+
+	data, err := json.Marshal(pulls["1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr := struct {
+		Title          string
+		Labels         []struct{ Name string }
+		Reviews        []struct{ State string }
+		ReviewComments []struct{ Path string } `json:"review_comments"`
+		Comments       []struct{ Body string }
+		Commits        []struct{ SHA string }
+		Timeline       []struct{ Event string }
+	}{}
+	if err := json.Unmarshal(data, &pr); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+
+	if pr.Title != "first" || len(pr.Labels) != 1 || len(pr.Reviews) != 1 || len(pr.ReviewComments) != 1 ||
+		len(pr.Comments) != 1 || pr.Comments[0].Body != "thanks" || len(pr.Commits) != 1 || len(pr.Timeline) != 1 {
+		t.Errorf("unexpected pull request: %s", data)
+	}
+
+	if second := pulls["2"].(PullRequest); second.GetTitle() != "second" || len(second.Reviews) != 0 {
+		t.Errorf("unexpected pull request: %+v", second)
+	}
+}
+
+func TestGetIssueComments(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/repos/alice/website/issues/1/comments", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 12, "body": "me too", "reactions": {"+1": 2}}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/issues/1/events", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"event": "closed"}]`)
+	})
+	mux.HandleFunc("/repos/alice/website/issues/2/comments", func(_ http.ResponseWriter, _ *http.Request) {
+		t.Error("fetched the comments of an issue without comments")
+	})
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	issue := getIssue(context.Background(), client, "alice", "website", &github.Issue{Number: github.Ptr(1), Comments: github.Ptr(1)})
+	if len(issue.Comments) != 1 || issue.Comments[0].(*github.IssueComment).GetReactions().GetPlusOne() != 2 || len(issue.Events) != 1 {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+
+	// the events of the second issue can't be fetched
+	if second := getIssue(context.Background(), client, "alice", "website", &github.Issue{Number: github.Ptr(2)}); len(second.Comments) != 0 || len(second.Events) != 0 {
+		t.Errorf("unexpected issue: %+v", second)
+	}
+
+	// a canceled run doesn't fetch anything
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mux.HandleFunc("/repos/alice/website/issues/3/events", func(_ http.ResponseWriter, _ *http.Request) {
+		t.Error("fetched the events with a canceled context")
+	})
+	getIssue(ctx, client, "alice", "website", &github.Issue{Number: github.Ptr(3)})
+
+	data, err := json.Marshal(issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		Number   int
+		Comments []struct{ Body string }
+		Events   []struct{ Event string }
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+
+	if decoded.Number != 1 || decoded.Comments[0].Body != "me too" || decoded.Events[0].Event != "closed" {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+}
+
+func TestGetReleases(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/repos/alice/website/releases", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `[{"tag_name": "v1.0.0", "name": "First", "author": {"login": "alice"}, "assets": [
+			{"id": 5, "name": "website.tar.gz", "size": 5, "url": "%s/repos/alice/website/releases/assets/5",
+			 "digest": "sha256:a7937b64b8caa58f03721bb6bacf5c78cb235febe0e70b1b84cd99541461a08e"}]}]`, server.URL)
+	})
+	mux.HandleFunc("/repos/alice/website/releases/assets/5", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			t.Errorf("asset requested as %s", r.Header.Get("Accept"))
+		}
+		fmt.Fprint(w, "first")
+	})
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	repo := &github.Repository{Name: github.Ptr("website"), Owner: &github.User{Login: github.Ptr("alice")}}
+	releases := GetReleases(context.Background(), repo, client, types.GenRepo{Releases: true})
+	if len(releases) != 1 || len(releases[0].Assets) != 1 {
+		t.Fatalf("unexpected releases: %+v", releases)
+	}
+
+	asset := releases[0].Assets[0]
+	if releases[0].Author != "alice" || asset.SHA256 != "a7937b64b8caa58f03721bb6bacf5c78cb235febe0e70b1b84cd99541461a08e" {
+		t.Errorf("unexpected release: %+v", releases[0])
+	}
+
+	body, err := asset.Open(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "first" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+//nolint:paralleltest // replaces the global asset cache
+func TestCreateReleasesUploadsMissingAssets(t *testing.T) {
+	previous := releases.CacheDir
+	releases.CacheDir = t.TempDir()
+	t.Cleanup(func() { releases.CacheDir = previous })
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("GET /api/v3/repos/alice/website/releases", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 1, "tag_name": "v1.0.0", "assets": [
+			{"id": 2, "name": "website.tar.gz", "state": "uploaded"},
+			{"id": 3, "name": "website.zip", "state": "starter"}]}]`)
+	})
+	deleted := []string{}
+	mux.HandleFunc("DELETE /api/v3/repos/alice/website/releases/assets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	uploaded := []string{}
+	mux.HandleFunc("POST /uploads/api/uploads/repos/alice/website/releases/1/assets", func(w http.ResponseWriter, r *http.Request) {
+		uploaded = append(uploaded, r.URL.Query().Get("name"))
+		fmt.Fprint(w, `{"id": 4}`)
+	})
+
+	asset := func(name string) types.Asset {
+		return types.Asset{Name: name, Key: name, Open: func(context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(name)), nil
+		}}
+	}
+	repo := types.Repo{Releases: []types.Release{{TagName: "v1.0.0", Assets: []types.Asset{
+		asset("website.tar.gz"), asset("website.zip"), asset("checksums.txt"),
+	}}}}
+
+	err := CreateReleases(context.Background(), types.GenRepo{URL: server.URL}, repo, server.URL+"/alice/website.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(deleted) != "[3]" {
+		t.Errorf("expected the failed upload to be deleted, deleted %v", deleted)
+	}
+	if fmt.Sprint(uploaded) != "[website.zip checksums.txt]" {
+		t.Errorf("expected the missing assets to be uploaded, uploaded %v", uploaded)
+	}
+}
+
+func TestCreateReleasesKeepsDrafts(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mu := sync.Mutex{}
+	created := []string{}
+	listed := []string{}
+	mux.HandleFunc("GET /api/v3/repos/alice/website/releases", func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "[%s]", strings.Join(listed, ","))
+	})
+	// drafts can't be looked up by tag
+	mux.HandleFunc("GET /api/v3/repos/alice/website/releases/tags/{tag}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /api/v3/repos/alice/website/releases", func(w http.ResponseWriter, r *http.Request) {
+		release := github.RepositoryRelease{}
+		if err := json.NewDecoder(r.Body).Decode(&release); err != nil {
+			t.Error(err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, release.GetTagName())
+		listed = append(listed, fmt.Sprintf(`{"id": %d, "tag_name": %q, "draft": %t}`, len(listed)+1, release.GetTagName(), release.GetDraft()))
+		fmt.Fprintf(w, `{"id": %d}`, len(listed))
+	})
+
+	repo := types.Repo{Releases: []types.Release{{TagName: "v2.0.0", Draft: true}}}
+	for range 2 {
+		if err := CreateReleases(context.Background(), types.GenRepo{URL: server.URL}, repo, server.URL+"/alice/website.git"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fmt.Sprint(created) != "[v2.0.0]" {
+		t.Errorf("expected the draft to be created once, created %v", created)
+	}
+}
+
+func TestOwnerAndName(t *testing.T) {
+	t.Parallel()
+
+	owner, name, err := ownerAndName("https://github.com/alice/website.git")
+	if err != nil || owner != "alice" || name != "website" {
+		t.Errorf("got %q, %q, %v", owner, name, err)
+	}
+
+	if _, _, err := ownerAndName("https://github.com/website"); err == nil {
+		t.Error("expected an error for a URL without owner")
+	}
+}
+
+func TestGistAlias(t *testing.T) {
+	t.Parallel()
+
+	aliases := map[string]string{}
+	named := &github.Gist{ID: github.Ptr("aa11bb22cc33"), Description: github.Ptr("Dotfiles: my .bashrc!")}
+	if alias := gistAlias(aliases, "github.com", named); alias != "Dotfiles-my-.bashrc" {
+		t.Errorf("unexpected alias %q", alias)
+	}
+
+	unnamed := &github.Gist{ID: github.Ptr("dd44"), Files: map[github.GistFilename]github.GistFile{"b.go": {}, "a.go": {}}}
+	if alias := gistAlias(aliases, "github.com", unnamed); alias != "a.go" {
+		t.Errorf("unexpected alias %q", alias)
+	}
+
+	same := &github.Gist{ID: github.Ptr("ee55ff66gg77"), Description: github.Ptr("Dotfiles: my .bashrc")}
+	if alias := gistAlias(aliases, "github.com", same); alias != "Dotfiles-my-.bashrc-ee55ff6" {
+		t.Errorf("colliding alias %q", alias)
+	}
+
+	// the alias stays when the description changes
+	named.Description = github.Ptr("renamed")
+	if alias := gistAlias(aliases, "github.com", named); alias != "Dotfiles-my-.bashrc" {
+		t.Errorf("alias changed to %q", alias)
+	}
+}
+
+//nolint:paralleltest // replaces the global state directory
+func TestGetGists(t *testing.T) {
+	previous := state.Dir
+	state.Dir = t.TempDir()
+	t.Cleanup(func() { state.Dir = previous })
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/gists", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": "aa11", "description": "notes", "comments": 1, "owner": {"login": "alice"}}]`)
+	})
+	mux.HandleFunc("/gists/starred", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": "aa11"}, {"id": "bb22", "description": "snippets", "public": true, "owner": {"login": "bob"}}]`)
+	})
+	mux.HandleFunc("/gists/aa11/comments", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": 5, "body": "nice"}]`)
+	})
+	mux.HandleFunc("/user/memberships/orgs", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"role": "admin", "organization": {"login": "acme"}}, {"role": "member", "organization": {"login": "other"}}]`)
+	})
+	mux.HandleFunc("/orgs/acme/members", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"login": "carol"}]`)
+	})
+	mux.HandleFunc("/users/carol/gists", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": "cc33", "files": {"deploy.sh": {}}, "owner": {"login": "carol"}}]`)
+	})
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	conf := types.GenRepo{Gists: true, Starred: true, MemberGists: true}
+	gists := GetGists(context.Background(), client, conf, "", "https://github.com", types.NewMatcher(nil), types.NewMatcher(nil))
+	if len(gists) != 3 {
+		t.Fatalf("expected 3 gists, got %+v", gists)
+	}
+
+	names := map[string]types.Repo{}
+	for _, gist := range gists {
+		names[gist.Name] = gist
+	}
+
+	notes, ok := names[filepath.Join("gists", "notes")]
+	if ok && notes.Enrich != nil {
+		notes.Enrich(context.Background(), &notes)
+	}
+	if !ok || notes.Owner != "alice" || !notes.Private || len(notes.Comments) != 1 {
+		t.Errorf("unexpected gist: %+v", notes)
+	}
+
+	if _, ok := names[filepath.Join("gists", "deploy.sh")]; !ok {
+		t.Errorf("gist of the member is missing: %v", names)
+	}
+
+	aliases := map[string]string{}
+	if err := state.Load("gists", &aliases); err != nil {
+		t.Fatal(err)
+	}
+
+	if aliases["github.com/bb22"] != "snippets" {
+		t.Errorf("aliases aren't stored: %v", aliases)
+	}
+
+	// the backups named after the ID are moved once
+	if notes.PreviousName != filepath.Join("gists", "aa11") {
+		t.Errorf("unexpected previous name %q", notes.PreviousName)
+	}
+
+	for _, gist := range GetGists(context.Background(), client, conf, "", "https://github.com", types.NewMatcher(nil), types.NewMatcher(nil)) {
+		if gist.PreviousName != "" {
+			t.Errorf("%s is moved again from %s", gist.Name, gist.PreviousName)
+		}
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/repos/alice/website/languages", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"Shell": 10, "Go": 900}`)
+	})
+	mux.HandleFunc("/repos/alice/website/collaborators", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"login": "alice"}, {"login": "bob"}]`)
+	})
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	repo := &github.Repository{
+		Name:          github.Ptr("website"),
+		Owner:         &github.User{Login: github.Ptr("alice")},
+		Topics:        []string{"hugo"},
+		Homepage:      github.Ptr("https://alice.example"),
+		DefaultBranch: github.Ptr("main"),
+		Language:      github.Ptr("Go"),
+		License:       &github.License{SPDXID: github.Ptr("MIT")},
+	}
+
+	meta := getMetadata(context.Background(), repo, client, types.GenRepo{})
+	if meta.Homepage != "https://alice.example" || meta.License != "MIT" || len(meta.Languages) != 1 || meta.Collaborators != nil {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+
+	meta = getMetadata(context.Background(), repo, client, types.GenRepo{Metadata: true})
+	if len(meta.Languages) != 2 || meta.Languages[1] != "Shell" || len(meta.Collaborators) != 2 {
+		t.Errorf("languages or collaborators missing: %+v", meta)
+	}
+}
@@ -1,14 +1,23 @@
 package gitlab
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
+	"github.com/cooperspencer/gickup/releases"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/rs/zerolog"
 	gitlab "gitlab.com/gitlab-org/api/client-go"
@@ -30,8 +39,9 @@ func getRepoVisibility(visibility string, private bool) gitlab.VisibilityValue {
 	}
 }
 
-// Backup TODO.
-func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
+// Backup mirrors r with a pull mirror on the GitLab destination d and returns
+// the error that stopped it.
+func Backup(r types.Repo, d types.GenRepo, dry bool) error {
 	var gitlabclient *gitlab.Client
 	token := d.GetToken()
 	var err error
@@ -46,7 +56,7 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 	if err != nil {
 		sub.Error().
 			Msg(err.Error())
-		return false
+		return err
 	}
 
 	sub.Info().
@@ -54,26 +64,61 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 
 	True := true
 
-	opt := gitlab.ListProjectsOptions{
-		Search: &r.Name,
-		Owned:  &True,
-	}
+	namespace := d.TargetOwner(r.Owner)
+	if namespace != "" {
+		user, _, err := gitlabclient.Users.CurrentUser()
+		if err != nil {
+			sub.Error().Msg(err.Error())
+			return err
+		}
 
-	projects, _, err := gitlabclient.Projects.ListProjects(&opt)
-	if err != nil {
-		sub.Error().Msg(err.Error())
-		return false
+		if namespace == user.Username {
+			namespace = ""
+		}
 	}
 
 	found := false
-	for _, p := range projects {
-		if p.Name == r.Name {
-			found = true
+	if namespace != "" {
+		_, _, err := gitlabclient.Projects.GetProject(path.Join(namespace, r.Name), &gitlab.GetProjectOptions{})
+		found = err == nil
+	} else {
+		opt := gitlab.ListProjectsOptions{
+			Search: &r.Name,
+			Owned:  &True,
+		}
+
+		projects, _, err := gitlabclient.Projects.ListProjects(&opt)
+		if err != nil {
+			sub.Error().Msg(err.Error())
+			return err
+		}
+
+		for _, p := range projects {
+			if p.Name == r.Name {
+				found = true
+			}
 		}
 	}
 
 	if dry || found {
-		return true
+		return nil
+	}
+
+	var namespaceID *int64
+	if namespace != "" {
+		namespaceID, err = getNamespace(gitlabclient, namespace, d)
+		if err != nil {
+			sub.Error().
+				Msg(err.Error())
+			return err
+		}
+
+		if namespaceID == nil {
+			err := fmt.Errorf("can't mirror %s into the namespace of the user %s", r.Name, namespace)
+			sub.Error().
+				Msg(err.Error())
+			return err
+		}
 	}
 
 	if r.Token != "" {
@@ -85,26 +130,32 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 
 	visibility := getRepoVisibility(d.Visibility.Repositories, r.Private)
 
+	meta := r.GetMetadata()
 	opts := &gitlab.CreateProjectOptions{
 		Mirror:      &True,
 		ImportURL:   &r.URL,
 		Name:        &r.Name,
-		Description: &r.Description,
+		Description: &meta.Description,
 		Visibility:  gitlab.Ptr(visibility),
+		NamespaceID: namespaceID,
+	}
+
+	if len(meta.Topics) > 0 {
+		opts.Topics = &meta.Topics
 	}
 
 	_, _, err = gitlabclient.Projects.CreateProject(opts)
 	if err != nil {
 		sub.Error().
 			Msg(err.Error())
-		return false
+		return err
 	}
 
-	return true
+	return nil
 }
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(ctx context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	inSlice := map[string]bool{}
@@ -118,10 +169,14 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
 		ran = true
 
 		token := repo.GetToken()
-		client, err := gitlab.NewClient(token, gitlab.WithBaseURL(repo.URL))
+		client, err := gitlab.NewClient(token, gitlab.WithBaseURL(repo.URL), gitlab.WithHTTPClient(prometheus.InstrumentClient("gitlab", tracing.Client(ctx))))
 		if err != nil {
 			sub.Error().
 				Msg(err.Error())
@@ -147,6 +202,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 		gitlabgrouprepos := map[string][]*gitlab.Project{}
 
 		opt := &gitlab.ListProjectsOptions{Membership: gitlab.Ptr(true)}
+		if repo.Filter.Uses("size") || repo.Filter.MaxSize != "" || repo.Filter.MinSize != "" {
+			// sizes are only reported with the statistics
+			opt.Statistics = gitlab.Ptr(true)
+		}
 		users, _, err := client.Users.ListUsers(&gitlab.ListUsersOptions{Username: &repo.User})
 		if err != nil {
 			sub.Error().
@@ -204,13 +263,19 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 		}
 
-		include := types.GetMap(repo.Include)
-		includeorgs := types.GetMap(repo.IncludeOrgs)
-		exclude := types.GetMap(repo.Exclude)
-		excludeorgs := types.GetMap(repo.ExcludeOrgs)
-		languages := types.GetMap(repo.Filter.Languages)
+		include := types.NewMatcher(repo.Include)
+		includeorgs := types.NewMatcher(repo.IncludeOrgs)
+		exclude := types.NewMatcher(repo.Exclude)
+		excludeorgs := types.NewMatcher(repo.ExcludeOrgs)
+		languages := types.NewMatcher(repo.Filter.Languages)
 
+		// the subgroups of named groups are included and excluded with them,
+		// patterns have to match the subgroups themselves
 		for _, org := range repo.IncludeOrgs {
+			if types.IsPattern(org) {
+				continue
+			}
+
 			group, _, err := client.Groups.GetGroup(org, &gitlab.GetGroupOptions{})
 			if err != nil {
 				sub.Error().
@@ -223,11 +288,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			})
 
 			for _, sub := range subgroups {
-				includeorgs[sub.FullPath] = true
+				includeorgs.Add(sub.FullPath)
 			}
 		}
 
 		for _, org := range repo.ExcludeOrgs {
+			if types.IsPattern(org) {
+				continue
+			}
+
 			group, _, err := client.Groups.GetGroup(org, &gitlab.GetGroupOptions{})
 			if err != nil {
 				sub.Error().
@@ -240,7 +309,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			})
 
 			for _, sub := range subgroups {
-				excludeorgs[sub.FullPath] = true
+				excludeorgs.Add(sub.FullPath)
 			}
 		}
 
@@ -274,7 +343,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 							percentage = percent
 						}
 					}
-					if !languages[strings.ToLower(language)] {
+					if !languages.Match(strings.ToLower(language)) {
 						continue
 					}
 				}
@@ -285,13 +354,16 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 				if time.Since(*r.LastActivityAt) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 					continue
 				}
-				if exclude[r.Name] {
+				if !repo.Filter.Match(filterEnv(r, client, repo.Filter)) {
 					continue
 				}
-				if excludeorgs[r.Namespace.FullPath] {
+				if exclude.MatchRepo(r.Namespace.FullPath, r.Name) {
 					continue
 				}
-				if include[r.Name] {
+				if excludeorgs.Match(r.Namespace.FullPath) {
+					continue
+				}
+				if include.MatchRepo(r.Namespace.FullPath, r.Name) {
 					if r.RepositoryAccessLevel != gitlab.DisabledAccessControl {
 						repos = append(repos, types.Repo{
 							Name:        r.Path,
@@ -303,16 +375,24 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 							Hoster:      types.GetHost(repo.URL),
 							Description: r.Description,
 							Private:     r.Visibility == gitlab.PrivateVisibility,
-							Issues:      GetIssues(r, client, repo),
+							Enrich:      enrich(r, client, repo, token),
+							Size:        projectSize(r),
+							ID:          strconv.FormatInt(r.ID, 10),
+							Export:      ProjectExport(ctx, r, client, repo, token),
 						})
 					}
 
+					if repo.Snippets && r.SnippetsAccessLevel != gitlab.DisabledAccessControl {
+						repos = append(repos, GetSnippets(r, client, repo, token, r.Namespace.FullPath)...)
+					}
+
 					if r.WikiEnabled && repo.Wiki {
 						if activeWiki(r, client, repo) {
 							httpURLToRepo := types.DotGitRx.ReplaceAllString(r.HTTPURLToRepo, ".wiki.git")
 							sshURLToRepo := types.DotGitRx.ReplaceAllString(r.SSHURLToRepo, ".wiki.git")
 							repos = append(repos, types.Repo{
 								Name:        r.Path + ".wiki",
+								ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 								URL:         httpURLToRepo,
 								SSHURL:      sshURLToRepo,
 								Token:       token,
@@ -327,7 +407,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 
 					continue
 				}
-				if len(include) == 0 {
+				if include.Empty() {
 					if r.RepositoryAccessLevel != gitlab.DisabledAccessControl {
 						repos = append(repos, types.Repo{
 							Name:        r.Path,
@@ -339,16 +419,24 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 							Hoster:      types.GetHost(repo.URL),
 							Description: r.Description,
 							Private:     r.Visibility == gitlab.PrivateVisibility,
-							Issues:      GetIssues(r, client, repo),
+							Enrich:      enrich(r, client, repo, token),
+							Size:        projectSize(r),
+							ID:          strconv.FormatInt(r.ID, 10),
+							Export:      ProjectExport(ctx, r, client, repo, token),
 						})
 					}
 
+					if repo.Snippets && r.SnippetsAccessLevel != gitlab.DisabledAccessControl {
+						repos = append(repos, GetSnippets(r, client, repo, token, r.Namespace.FullPath)...)
+					}
+
 					if r.WikiEnabled && repo.Wiki {
 						if activeWiki(r, client, repo) {
 							httpURLToRepo := types.DotGitRx.ReplaceAllString(r.HTTPURLToRepo, ".wiki.git")
 							sshURLToRepo := types.DotGitRx.ReplaceAllString(r.SSHURLToRepo, ".wiki.git")
 							repos = append(repos, types.Repo{
 								Name:        r.Path + ".wiki",
+								ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 								URL:         httpURLToRepo,
 								SSHURL:      sshURLToRepo,
 								Token:       token,
@@ -365,6 +453,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			}
 		}
 
+		if repo.Snippets && token != "" {
+			repos = append(repos, GetSnippets(nil, client, repo, token, repo.User)...)
+		}
+
 		if token != "" {
 			groups := []*gitlab.Group{}
 			i := int64(1)
@@ -412,6 +504,18 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					gopt.Page = i
 				}
 			}
+			if repo.GroupWikis {
+				for _, group := range groups {
+					if excludeorgs.Match(group.FullPath) || (!includeorgs.Empty() && !includeorgs.Match(group.FullPath)) {
+						continue
+					}
+
+					if activeGroupWiki(group, client) {
+						repos = append(repos, groupWiki(group, repo, token))
+					}
+				}
+			}
+
 			for k, gr := range gitlabgrouprepos {
 				for _, r := range gr {
 					if !inSlice[r.PathWithNamespace] {
@@ -443,7 +547,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 									percentage = percent
 								}
 							}
-							if !languages[strings.ToLower(language)] {
+							if !languages.Match(strings.ToLower(language)) {
 								continue
 							}
 						}
@@ -454,14 +558,17 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 						if time.Since(*r.LastActivityAt) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 							continue
 						}
+						if !repo.Filter.Match(filterEnv(r, client, repo.Filter)) {
+							continue
+						}
 
-						if exclude[r.Name] {
+						if exclude.MatchRepo(r.Namespace.FullPath, r.Name) {
 							continue
 						}
-						if excludeorgs[r.Namespace.FullPath] {
+						if excludeorgs.Match(r.Namespace.FullPath) {
 							continue
 						}
-						if include[r.Name] {
+						if include.MatchRepo(r.Namespace.FullPath, r.Name) {
 							if r.RepositoryAccessLevel != gitlab.DisabledAccessControl {
 								repos = append(repos, types.Repo{
 									Name:        r.Path,
@@ -473,16 +580,24 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 									Hoster:      types.GetHost(repo.URL),
 									Description: r.Description,
 									Private:     r.Visibility == gitlab.PrivateVisibility,
-									Issues:      GetIssues(r, client, repo),
+									Enrich:      enrich(r, client, repo, token),
+									Size:        projectSize(r),
+									ID:          strconv.FormatInt(r.ID, 10),
+									Export:      ProjectExport(ctx, r, client, repo, token),
 								})
 							}
 
+							if repo.Snippets && r.SnippetsAccessLevel != gitlab.DisabledAccessControl {
+								repos = append(repos, GetSnippets(r, client, repo, token, k)...)
+							}
+
 							if r.WikiEnabled && repo.Wiki {
 								if activeWiki(r, client, repo) {
 									httpURLToRepo := types.DotGitRx.ReplaceAllString(r.HTTPURLToRepo, ".wiki.git")
 									sshURLToRepo := types.DotGitRx.ReplaceAllString(r.SSHURLToRepo, ".wiki.git")
 									repos = append(repos, types.Repo{
 										Name:        r.Path + ".wiki",
+										ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 										URL:         httpURLToRepo,
 										SSHURL:      sshURLToRepo,
 										Token:       token,
@@ -497,8 +612,8 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 
 							continue
 						}
-						if len(include) == 0 {
-							if len(includeorgs) == 0 || includeorgs[r.Namespace.FullPath] {
+						if include.Empty() {
+							if includeorgs.Empty() || includeorgs.Match(r.Namespace.FullPath) {
 								if r.RepositoryAccessLevel != gitlab.DisabledAccessControl {
 									repos = append(repos, types.Repo{
 										Name:        r.Path,
@@ -510,16 +625,24 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 										Hoster:      types.GetHost(repo.URL),
 										Description: r.Description,
 										Private:     r.Visibility == gitlab.PrivateVisibility,
-										Issues:      GetIssues(r, client, repo),
+										Enrich:      enrich(r, client, repo, token),
+										Size:        projectSize(r),
+										ID:          strconv.FormatInt(r.ID, 10),
+										Export:      ProjectExport(ctx, r, client, repo, token),
 									})
 								}
 
+								if repo.Snippets && r.SnippetsAccessLevel != gitlab.DisabledAccessControl {
+									repos = append(repos, GetSnippets(r, client, repo, token, k)...)
+								}
+
 								if r.WikiEnabled && repo.Wiki {
 									if activeWiki(r, client, repo) {
 										httpURLToRepo := types.DotGitRx.ReplaceAllString(r.HTTPURLToRepo, ".wiki.git")
 										sshURLToRepo := types.DotGitRx.ReplaceAllString(r.SSHURLToRepo, ".wiki.git")
 										repos = append(repos, types.Repo{
 											Name:        r.Path + ".wiki",
+											ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 											URL:         httpURLToRepo,
 											SSHURL:      sshURLToRepo,
 											Token:       token,
@@ -557,6 +680,246 @@ func activeWiki(r *gitlab.Project, client *gitlab.Client, _ types.GenRepo) bool
 	return len(wikis) > 0
 }
 
+// activeGroupWiki reports whether the group has wiki pages. Group wikis need
+// GitLab Premium, other instances answer with an error.
+func activeGroupWiki(group *gitlab.Group, client *gitlab.Client) bool {
+	wikis, _, err := client.GroupWikis.ListGroupWikis(group.ID, &gitlab.ListGroupWikisOptions{})
+	if err != nil {
+		sub.Warn().Err(err).Str("group", group.FullPath).Msg("can't fetch group wiki")
+	}
+
+	return len(wikis) > 0
+}
+
+// groupWiki returns the wiki of a group as a repository named <group>.wiki
+// below the group.
+func groupWiki(group *gitlab.Group, conf types.GenRepo, token string) types.Repo {
+	return types.Repo{
+		ID:          "group/" + strconv.FormatInt(group.ID, 10) + ".wiki",
+		Name:        group.Path + ".wiki",
+		URL:         fmt.Sprintf("%s/%s.wiki.git", strings.TrimSuffix(conf.URL, "/"), group.FullPath),
+		SSHURL:      fmt.Sprintf("git@%s:%s.wiki.git", types.GetHost(conf.URL), group.FullPath),
+		Token:       token,
+		Origin:      conf,
+		Owner:       group.FullPath,
+		Hoster:      types.GetHost(conf.URL),
+		Description: group.Description,
+		Private:     group.Visibility == gitlab.PrivateVisibility,
+	}
+}
+
+// GetSnippets get the snippets of a project, or the personal snippets of the
+// user if project is nil, as repositories named <project>.snippet-<id> and
+// snippet-<id>
+func GetSnippets(project *gitlab.Project, client *gitlab.Client, conf types.GenRepo, token, owner string) []types.Repo {
+	repos := []types.Repo{}
+
+	snippets, err := gitlab.ScanAndCollect(func(p gitlab.PaginationOptionFunc) ([]*gitlab.Snippet, *gitlab.Response, error) {
+		if project == nil {
+			return client.Snippets.ListSnippets(&gitlab.ListSnippetsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}, p)
+		}
+
+		return client.ProjectSnippets.ListSnippets(project.ID, &gitlab.ListProjectSnippetsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}, p)
+	})
+	if err != nil {
+		if project != nil {
+			sub.Error().Err(err).Str("repo", project.Name).Msg("can't fetch snippets")
+		} else {
+			sub.Error().Err(err).Str("user", owner).Msg("can't fetch snippets")
+		}
+
+		return repos
+	}
+
+	for _, snippet := range snippets {
+		name := fmt.Sprintf("snippet-%d", snippet.ID)
+		sshURL := fmt.Sprintf("git@%s:snippets/%d.git", types.GetHost(conf.URL), snippet.ID)
+		if project != nil {
+			name = fmt.Sprintf("%s.%s", project.Path, name)
+			sshURL = fmt.Sprintf("%s/snippets/%d.git", strings.TrimSuffix(project.SSHURLToRepo, ".git"), snippet.ID)
+		}
+
+		repos = append(repos, types.Repo{
+			ID:          "snippet/" + strconv.FormatInt(snippet.ID, 10),
+			Name:        name,
+			URL:         snippet.WebURL + ".git",
+			SSHURL:      sshURL,
+			Token:       token,
+			Origin:      conf,
+			Owner:       owner,
+			Hoster:      types.GetHost(conf.URL),
+			Description: snippet.Title,
+			Private:     snippet.Visibility == string(gitlab.PrivateVisibility),
+		})
+	}
+
+	return repos
+}
+
+// MergeRequest is a merge request with its discussions and approvals.
+type MergeRequest struct {
+	*gitlab.BasicMergeRequest
+	Discussions []*gitlab.Discussion          `json:"discussions"`
+	Approvals   *gitlab.MergeRequestApprovals `json:"approvals"`
+}
+
+// enrich returns the function that fetches the issues, merge requests,
+// releases and metadata of r, once it is known that r is backed up.
+func enrich(r *gitlab.Project, client *gitlab.Client, conf types.GenRepo, token string) func(context.Context, *types.Repo) {
+	return func(ctx context.Context, repo *types.Repo) {
+		repo.Issues = GetIssues(r, client, conf)
+		repo.PullRequests = GetMergeRequests(r, client, conf)
+		repo.Releases = GetReleases(ctx, r, client, conf, token)
+		repo.Metadata = getMetadata(r, client, conf)
+	}
+}
+
+// GetMergeRequests get merge requests
+func GetMergeRequests(repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo) map[string]interface{} {
+	mergerequests := map[string]interface{}{}
+	if !conf.PullRequests || repo.MergeRequestsAccessLevel == gitlab.DisabledAccessControl {
+		return mergerequests
+	}
+
+	mrs, err := gitlab.ScanAndCollect(func(p gitlab.PaginationOptionFunc) ([]*gitlab.BasicMergeRequest, *gitlab.Response, error) {
+		return client.MergeRequests.ListProjectMergeRequests(repo.ID, &gitlab.ListProjectMergeRequestsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: 100},
+			State:       gitlab.Ptr("all"),
+		}, p)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch merge requests")
+		return mergerequests
+	}
+
+	for _, mr := range mrs {
+		mergerequests[strconv.FormatInt(mr.IID, 10)] = getMergeRequest(client, repo, mr)
+	}
+
+	return mergerequests
+}
+
+// getMergeRequest fetches the discussions and approvals of a merge request,
+// parts that can't be fetched are left empty.
+func getMergeRequest(client *gitlab.Client, repo *gitlab.Project, mr *gitlab.BasicMergeRequest) MergeRequest {
+	m := MergeRequest{BasicMergeRequest: mr, Discussions: []*gitlab.Discussion{}}
+
+	discussions, err := gitlab.ScanAndCollect(func(p gitlab.PaginationOptionFunc) ([]*gitlab.Discussion, *gitlab.Response, error) {
+		return client.Discussions.ListMergeRequestDiscussions(repo.ID, mr.IID, &gitlab.ListMergeRequestDiscussionsOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}, p)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Int64("mergerequest", mr.IID).Msg("can't fetch discussions")
+	} else {
+		m.Discussions = append(m.Discussions, discussions...)
+	}
+
+	approvals, _, err := client.MergeRequestApprovals.GetConfiguration(repo.ID, mr.IID)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Int64("mergerequest", mr.IID).Msg("can't fetch approvals")
+	} else {
+		m.Approvals = approvals
+	}
+
+	return m
+}
+
+// projectSize get the size of the repository of a project in kilobytes, it
+// is only known if the statistics were requested
+func projectSize(project *gitlab.Project) int64 {
+	if project.Statistics == nil {
+		return 0
+	}
+
+	return project.Statistics.RepositorySize / 1024
+}
+
+// filterEnv get the attributes of a project for filter expressions, the
+// language is only fetched if the expression uses it
+func filterEnv(repo *gitlab.Project, client *gitlab.Client, filter types.Filter) types.FilterEnv {
+	env := types.FilterEnv{
+		Name:       repo.Name,
+		Topics:     repo.Topics,
+		Visibility: string(repo.Visibility),
+		Archived:   repo.Archived,
+		Fork:       repo.ForkedFromProject != nil,
+		Stars:      int(repo.StarCount),
+		Size:       projectSize(repo),
+	}
+
+	if repo.Namespace != nil {
+		env.Owner = repo.Namespace.FullPath
+	}
+
+	if repo.LastActivityAt != nil {
+		env.LastActivity = *repo.LastActivityAt
+	}
+
+	if filter.Uses("language") {
+		languages, _, err := client.Projects.GetProjectLanguages(repo.ID)
+		if err != nil {
+			sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch languages")
+		} else if languages != nil {
+			if sorted := types.SortLanguages(map[string]float32(*languages)); len(sorted) > 0 {
+				env.Language = sorted[0]
+			}
+		}
+	}
+
+	return env
+}
+
+// getMetadata get the metadata of a project, the languages and members are
+// only fetched if enabled
+func getMetadata(repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo) *types.Metadata {
+	meta := &types.Metadata{
+		Description:   repo.Description,
+		Topics:        repo.Topics,
+		DefaultBranch: repo.DefaultBranch,
+		Archived:      repo.Archived,
+		Fork:          repo.ForkedFromProject != nil,
+		Visibility:    string(repo.Visibility),
+		CreatedAt:     repo.CreatedAt,
+		UpdatedAt:     repo.UpdatedAt,
+		Extra: map[string]interface{}{
+			"web_url": repo.WebURL,
+			"stars":   repo.StarCount,
+			"forks":   repo.ForksCount,
+		},
+	}
+
+	if repo.License != nil {
+		meta.License = repo.License.Key
+	}
+
+	if repo.ForkedFromProject != nil {
+		meta.Parent = repo.ForkedFromProject.PathWithNamespace
+	}
+
+	if !conf.Metadata {
+		return meta
+	}
+
+	languages, _, err := client.Projects.GetProjectLanguages(repo.ID)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch languages")
+	} else if languages != nil {
+		meta.Languages = types.SortLanguages(map[string]float32(*languages))
+	}
+
+	members, err := gitlab.ScanAndCollect(func(p gitlab.PaginationOptionFunc) ([]*gitlab.ProjectMember, *gitlab.Response, error) {
+		return client.ProjectMembers.ListProjectMembers(repo.ID, &gitlab.ListProjectMembersOptions{ListOptions: gitlab.ListOptions{PerPage: 100}}, p)
+	})
+	if err != nil {
+		sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch members")
+	}
+
+	for _, member := range members {
+		meta.Collaborators = append(meta.Collaborators, member.Username)
+	}
+
+	return meta
+}
+
 // GetIssues get issues
 func GetIssues(repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo) map[string]interface{} {
 	issues := map[string]interface{}{}
@@ -580,7 +943,7 @@ func GetIssues(repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo)
 			} else {
 				if len(i) > 0 {
 					for _, issue := range i {
-						issues[strconv.FormatInt(issue.IID, 10)] = issue
+						issues[strconv.FormatInt(issue.IID, 10)] = getIssue(client, repo, issue)
 					}
 				} else {
 					break
@@ -592,6 +955,54 @@ func GetIssues(repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo)
 	return issues
 }
 
+// getNamespace get the ID of the group namespace, nil for users. Missing
+// groups are created with their parents if createorg is set.
+func getNamespace(client *gitlab.Client, namespace string, destination types.GenRepo) (*int64, error) {
+	group, _, err := client.Groups.GetGroup(namespace, &gitlab.GetGroupOptions{})
+	if err == nil {
+		return &group.ID, nil
+	}
+
+	if !strings.Contains(namespace, "/") {
+		users, _, err := client.Users.ListUsers(&gitlab.ListUsersOptions{Username: &namespace})
+		if err == nil && len(users) > 0 {
+			return nil, nil
+		}
+	}
+
+	if !destination.CreateOrg {
+		return nil, fmt.Errorf("target namespace %s not found", namespace)
+	}
+
+	name := path.Base(namespace)
+	opts := &gitlab.CreateGroupOptions{
+		Name:       &name,
+		Path:       &name,
+		Visibility: gitlab.Ptr(getRepoVisibility(destination.Visibility.Organizations, true)),
+	}
+
+	if parent := path.Dir(namespace); parent != "." {
+		opts.ParentID, err = getNamespace(client, parent, destination)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.ParentID == nil {
+			return nil, fmt.Errorf("can't create group %s below the user %s", name, parent)
+		}
+	}
+
+	sub.Info().
+		Msgf("creating group %s", types.Blue(namespace))
+
+	group, _, err = client.Groups.CreateGroup(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group.ID, nil
+}
+
 // GetOrCreate Get or create a repository
 func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	visibility := getRepoVisibility(destination.Visibility.Repositories, repo.Private)
@@ -607,9 +1018,9 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	targetNamespace := user.Username
-	if destination.User != "" {
-		targetNamespace = destination.User
+	targetNamespace := destination.TargetOwner(repo.Owner)
+	if targetNamespace == "" {
+		targetNamespace = user.Username
 	}
 
 	fullPath := fmt.Sprintf("%s/%s", targetNamespace, repo.Name)
@@ -618,21 +1029,26 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 		return existingProject.HTTPURLToRepo, nil
 	}
 
+	meta := repo.GetMetadata()
 	opts := gitlab.CreateProjectOptions{
 		Name:        gitlab.Ptr(repo.Name),
 		Visibility:  gitlab.Ptr(visibility),
-		Description: gitlab.Ptr(repo.Description),
+		Description: gitlab.Ptr(meta.Description),
+	}
+
+	// gitlab has no homepage of projects
+	if len(meta.Topics) > 0 {
+		opts.Topics = &meta.Topics
+	}
+
+	if meta.DefaultBranch != "" {
+		opts.DefaultBranch = &meta.DefaultBranch
 	}
 
 	if targetNamespace != user.Username {
-		group, _, err := client.Groups.GetGroup(targetNamespace, &gitlab.GetGroupOptions{})
-		if err == nil {
-			opts.NamespaceID = &group.ID
-		} else {
-			users, _, err := client.Users.ListUsers(&gitlab.ListUsersOptions{Username: &targetNamespace})
-			if err != nil || len(users) == 0 {
-				return "", fmt.Errorf("target namespace %s not found", targetNamespace)
-			}
+		opts.NamespaceID, err = getNamespace(client, targetNamespace, destination)
+		if err != nil {
+			return "", err
 		}
 	}
 
@@ -643,3 +1059,387 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 
 	return r.HTTPURLToRepo, nil
 }
+
+// getIssue fetches the notes and award emojis of an issue, the system notes
+// are its events. Parts that can't be fetched are left empty.
+func getIssue(client *gitlab.Client, repo *gitlab.Project, issue *gitlab.Issue) types.Issue {
+	i := types.NewIssue(issue)
+
+	notesOptions := &gitlab.ListIssueNotesOptions{ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1}}
+	for {
+		notes, response, err := client.Notes.ListIssueNotes(repo.ID, issue.IID, notesOptions)
+		if err != nil {
+			sub.Error().Err(err).Str("repo", repo.Name).Int64("issue", issue.IID).Msg("can't fetch comments")
+			break
+		}
+
+		for _, note := range notes {
+			if note.System {
+				i.Events = append(i.Events, note)
+			} else {
+				i.Comments = append(i.Comments, note)
+			}
+		}
+
+		if response.NextPage == 0 {
+			break
+		}
+		notesOptions.Page = response.NextPage
+	}
+
+	emojiOptions := &gitlab.ListAwardEmojiOptions{ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1}}
+	for {
+		emojis, response, err := client.AwardEmoji.ListIssueAwardEmoji(repo.ID, issue.IID, emojiOptions)
+		if err != nil {
+			sub.Error().Err(err).Str("repo", repo.Name).Int64("issue", issue.IID).Msg("can't fetch reactions")
+			break
+		}
+
+		i.Reactions = append(i.Reactions, types.List(emojis)...)
+
+		if response.NextPage == 0 {
+			break
+		}
+		emojiOptions.Page = response.NextPage
+	}
+
+	return i
+}
+
+// GetReleases get releases with the files linked as their assets, the
+// generated source archives are left out
+func GetReleases(ctx context.Context, repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo, token string) []types.Release {
+	releases := []types.Release{}
+	if !conf.Releases {
+		return releases
+	}
+
+	host := types.GetHost(conf.URL)
+	httpClient := prometheus.InstrumentClient("gitlab", tracing.Client(ctx))
+	listOptions := &gitlab.ListReleasesOptions{ListOptions: gitlab.ListOptions{PerPage: 100, Page: 1}}
+	for {
+		r, response, err := client.Releases.ListReleases(repo.ID, listOptions)
+		if err != nil {
+			sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch releases")
+			return releases
+		}
+
+		for _, release := range r {
+			rel := types.Release{
+				TagName: release.TagName,
+				Name:    release.Name,
+				Body:    release.Description,
+				Author:  release.Author.Username,
+				Assets:  []types.Asset{},
+			}
+			if release.CreatedAt != nil {
+				rel.CreatedAt = *release.CreatedAt
+			}
+			if release.ReleasedAt != nil {
+				rel.PublishedAt = *release.ReleasedAt
+			}
+
+			for _, link := range release.Assets.Links {
+				downloadURL := link.DirectAssetURL
+				if downloadURL == "" {
+					downloadURL = link.URL
+				}
+
+				// only files on the instance get the token, links may point anywhere
+				linkToken := ""
+				if types.GetHost(downloadURL) == host {
+					linkToken = token
+				}
+
+				rel.Assets = append(rel.Assets, types.Asset{
+					Name: link.Name,
+					URL:  downloadURL,
+					Key:  fmt.Sprintf("%d@%s", link.ID, link.URL),
+					Open: func(ctx context.Context) (io.ReadCloser, error) {
+						return download(ctx, httpClient, downloadURL, linkToken)
+					},
+				})
+			}
+
+			releases = append(releases, rel)
+		}
+
+		if response.NextPage == 0 {
+			break
+		}
+		listOptions.Page = response.NextPage
+	}
+
+	return releases
+}
+
+// download opens a linked file, authenticated with token if it's set.
+func download(ctx context.Context, client *http.Client, url, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("PRIVATE-TOKEN", token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s failed with %s", req.URL.Redacted(), resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// CreateReleases recreates the releases of repo which are missing in the
+// project at cloneurl, the assets are uploaded to the project.
+func CreateReleases(ctx context.Context, destination types.GenRepo, repo types.Repo, cloneurl string) error {
+	if destination.URL == "" {
+		destination.URL = "https://gitlab.com"
+	}
+
+	client, err := gitlab.NewClient(destination.GetToken(), gitlab.WithBaseURL(destination.URL))
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(destination.URL)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(cloneurl)
+	if err != nil {
+		return err
+	}
+
+	// the path of the project below the instance, with all its groups
+	pid := strings.Trim(strings.TrimPrefix(strings.TrimSuffix(u.Path, ".git"), strings.TrimSuffix(base.Path, "/")), "/")
+
+	// upload returns the link to the uploaded asset
+	upload := func(asset *types.Asset) (*gitlab.ReleaseAssetLinkOptions, error) {
+		cached, err := releases.Fetch(ctx, asset)
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := os.Open(cached)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		uploaded, _, err := client.ProjectMarkdownUploads.UploadProjectMarkdown(pid, file, asset.Name, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		return &gitlab.ReleaseAssetLinkOptions{
+			Name: gitlab.Ptr(asset.Name),
+			URL:  gitlab.Ptr(strings.TrimSuffix(destination.URL, "/") + uploaded.FullPath),
+		}, nil
+	}
+
+	errs := []error{}
+	for _, release := range repo.Releases {
+		existing, response, err := client.Releases.GetRelease(pid, release.TagName, gitlab.WithContext(ctx))
+		if err == nil {
+			// the assets of earlier runs are kept, the missing ones are
+			// uploaded and linked
+			linked := map[string]bool{}
+			for _, link := range existing.Assets.Links {
+				linked[link.Name] = true
+			}
+
+			for i := range release.Assets {
+				asset := &release.Assets[i]
+				if linked[asset.Name] {
+					continue
+				}
+
+				link, err := upload(asset)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				_, _, err = client.ReleaseLinks.CreateReleaseLink(pid, release.TagName, &gitlab.CreateReleaseLinkOptions{Name: link.Name, URL: link.URL}, gitlab.WithContext(ctx))
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				sub.Info().Str("repo", repo.Name).Msgf("uploaded asset %s of release %s", asset.Name, release.TagName)
+			}
+
+			continue
+		}
+		if response == nil || response.StatusCode != http.StatusNotFound {
+			errs = append(errs, err)
+			continue
+		}
+
+		// assets that fail are uploaded by the next run
+		links := []*gitlab.ReleaseAssetLinkOptions{}
+		for i := range release.Assets {
+			link, err := upload(&release.Assets[i])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			links = append(links, link)
+		}
+
+		opts := &gitlab.CreateReleaseOptions{
+			Name:        gitlab.Ptr(release.Name),
+			TagName:     gitlab.Ptr(release.TagName),
+			Description: gitlab.Ptr(release.Body),
+			Assets:      &gitlab.ReleaseAssetsOptions{Links: links},
+		}
+		if !release.PublishedAt.IsZero() {
+			opts.ReleasedAt = gitlab.Ptr(release.PublishedAt)
+		}
+
+		_, _, err = client.Releases.CreateRelease(pid, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		sub.Info().Str("repo", repo.Name).Msgf("created release %s", release.TagName)
+	}
+
+	return errors.Join(errs...)
+}
+
+// exportPollInterval is the delay between checks of the export status.
+var exportPollInterval = 10 * time.Second
+
+// exportTimeout is how long gickup waits for an export to finish.
+var exportTimeout = time.Hour
+
+// ProjectExport returns the archive of a project export. The export is only
+// scheduled when the archive is opened the first time, after the project was
+// routed to a destination, every open waits for it to finish.
+func ProjectExport(ctx context.Context, repo *gitlab.Project, client *gitlab.Client, conf types.GenRepo, token string) *types.Asset {
+	if !conf.Export {
+		return nil
+	}
+
+	var schedule sync.Once
+	var scheduleErr error
+
+	httpClient := prometheus.InstrumentClient("gitlab", tracing.Client(ctx))
+	return &types.Asset{
+		Name: fmt.Sprintf("%s.export.tar.gz", repo.Path),
+		URL:  repo.WebURL,
+		Open: func(ctx context.Context) (io.ReadCloser, error) {
+			schedule.Do(func() {
+				_, scheduleErr = client.ProjectImportExport.ScheduleExport(repo.ID, nil, gitlab.WithContext(ctx))
+			})
+			if scheduleErr != nil {
+				return nil, fmt.Errorf("can't schedule the export of %s: %w", repo.PathWithNamespace, scheduleErr)
+			}
+
+			downloadURL, err := waitForExport(ctx, client, repo)
+			if err != nil {
+				return nil, err
+			}
+
+			return download(ctx, httpClient, downloadURL, token)
+		},
+	}
+}
+
+// waitForExport polls the export status of the project until the export is
+// finished and returns the URL of the archive.
+func waitForExport(ctx context.Context, client *gitlab.Client, repo *gitlab.Project) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	for {
+		status, _, err := client.ProjectImportExport.ExportStatus(repo.ID, gitlab.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+
+		switch status.ExportStatus {
+		case "finished":
+			return status.Links.APIURL, nil
+		case "failed":
+			return "", fmt.Errorf("export of %s failed: %s", repo.PathWithNamespace, status.Message)
+		}
+
+		sub.Debug().Str("repo", repo.Name).Msgf("export is %s", status.ExportStatus)
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("export of %s didn't finish: %w", repo.PathWithNamespace, ctx.Err())
+		case <-time.After(exportPollInterval):
+		}
+	}
+}
+
+// Archive archives the project name in namespace on the destination, the
+// namespace defaults to the user of the token
+func Archive(d types.GenRepo, namespace, name string) error {
+	client, pid, err := destinationProject(d, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = client.Projects.ArchiveProject(pid)
+
+	return err
+}
+
+// Rename renames the project name in namespace on the destination to newName
+func Rename(d types.GenRepo, namespace, name, newName string) error {
+	client, pid, err := destinationProject(d, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = client.Projects.EditProject(pid, &gitlab.EditProjectOptions{
+		Name: gitlab.Ptr(newName),
+		Path: gitlab.Ptr(newName),
+	})
+
+	return err
+}
+
+// destinationProject returns a client of the destination and the path of the
+// project name in namespace
+func destinationProject(d types.GenRepo, namespace, name string) (*gitlab.Client, string, error) {
+	var (
+		client *gitlab.Client
+		err    error
+	)
+	if d.URL == "" {
+		d.URL = "https://gitlab.com"
+		client, err = gitlab.NewClient(d.GetToken())
+	} else {
+		client, err = gitlab.NewClient(d.GetToken(), gitlab.WithBaseURL(d.URL))
+	}
+	sub = logger.CreateSubLogger("stage", "gitlab", "url", d.URL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if namespace == "" {
+		user, _, err := client.Users.CurrentUser()
+		if err != nil {
+			return nil, "", err
+		}
+		namespace = user.Username
+	}
+
+	return client, path.Join(namespace, name), nil
+}
@@ -1,7 +1,19 @@
 package gitlab
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
 
 	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
@@ -29,3 +41,301 @@ func TestGetRepoVisibility(t *testing.T) {
 		})
 	}
 }
+
+func TestGetIssue(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/7/issues/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"id": 3, "body": "closed", "system": true}]`)
+			return
+		}
+		w.Header().Set("X-Next-Page", "2")
+		fmt.Fprint(w, `[{"id": 1, "body": "me too"}, {"id": 2, "body": "thanks"}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/7/issues/1/award_emoji", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"name": "thumbsup"}]`)
+	})
+
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := getIssue(client, &gitlab.Project{ID: 7, Name: "website"}, &gitlab.Issue{IID: 1})
+	if len(issue.Comments) != 2 || len(issue.Events) != 1 || issue.Events[0].(*gitlab.Note).Body != "closed" {
+		t.Errorf("unexpected notes: %+v, %+v", issue.Comments, issue.Events)
+	}
+
+	if len(issue.Reactions) != 1 || issue.Reactions[0].(*gitlab.AwardEmoji).Name != "thumbsup" {
+		t.Errorf("unexpected reactions: %+v", issue.Reactions)
+	}
+}
+
+func TestGetMergeRequests(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/7/merge_requests", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("state") != "all" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `[{"iid": 1, "title": "fix typo"}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/7/merge_requests/1/discussions", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `[{"id": "a", "notes": [{"id": 1, "body": "looks good"}]}]`)
+	})
+	mux.HandleFunc("/api/v4/projects/7/merge_requests/1/approvals", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"iid": 1, "approved": true, "approved_by": [{"user": {"username": "alice"}}]}`)
+	})
+
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := &gitlab.Project{ID: 7, Name: "website"}
+	if mrs := GetMergeRequests(project, client, types.GenRepo{}); len(mrs) != 0 {
+		t.Errorf("merge requests fetched without being enabled: %v", mrs)
+	}
+
+	mrs := GetMergeRequests(project, client, types.GenRepo{PullRequests: true})
+	mr, ok := mrs["1"].(MergeRequest)
+	if !ok {
+		t.Fatalf("merge request 1 missing: %v", mrs)
+	}
+
+	if len(mr.Discussions) != 1 || mr.Discussions[0].Notes[0].Body != "looks good" {
+		t.Errorf("unexpected discussions: %+v", mr.Discussions)
+	}
+
+	if mr.Approvals == nil || !mr.Approvals.Approved || mr.Approvals.ApprovedBy[0].User.Username != "alice" {
+		t.Errorf("unexpected approvals: %+v", mr.Approvals)
+	}
+}
+
+func TestGetSnippets(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/7/snippets", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `[{"id": 3, "title": "setup", "visibility": "private", "web_url": "%s/alice/website/-/snippets/3"}]`, server.URL)
+	})
+	mux.HandleFunc("/api/v4/snippets", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `[{"id": 4, "title": "notes", "visibility": "public", "web_url": "%s/-/snippets/4"}]`, server.URL)
+	})
+
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := types.GenRepo{URL: server.URL}
+	project := &gitlab.Project{ID: 7, Name: "website", Path: "website", SSHURLToRepo: "git@gitlab.local:alice/website.git"}
+
+	snippets := GetSnippets(project, client, conf, "", "alice")
+	if len(snippets) != 1 {
+		t.Fatalf("expected 1 snippet, got %d", len(snippets))
+	}
+
+	snippet := snippets[0]
+	if snippet.Name != "website.snippet-3" || snippet.Owner != "alice" || !snippet.Private ||
+		snippet.URL != server.URL+"/alice/website/-/snippets/3.git" || snippet.SSHURL != "git@gitlab.local:alice/website/snippets/3.git" {
+		t.Errorf("unexpected snippet: %+v", snippet)
+	}
+
+	snippets = GetSnippets(nil, client, conf, "", "alice")
+	if len(snippets) != 1 || snippets[0].Name != "snippet-4" || snippets[0].URL != server.URL+"/-/snippets/4.git" {
+		t.Errorf("unexpected personal snippets: %+v", snippets)
+	}
+}
+
+func TestGroupWiki(t *testing.T) {
+	t.Parallel()
+
+	wiki := groupWiki(&gitlab.Group{Path: "tools", FullPath: "acme/tools"}, types.GenRepo{URL: "https://gitlab.local/"}, "")
+	if wiki.Name != "tools.wiki" || wiki.Owner != "acme/tools" || wiki.URL != "https://gitlab.local/acme/tools.wiki.git" ||
+		wiki.SSHURL != "git@gitlab.local:acme/tools.wiki.git" {
+		t.Errorf("unexpected wiki: %+v", wiki)
+	}
+}
+
+func TestGetNamespaceCreatesSubgroups(t *testing.T) {
+	t.Parallel()
+
+	groups := map[string]int64{"mirrors": 1}
+	created := []string{}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/groups/", func(w http.ResponseWriter, r *http.Request) {
+		name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/groups/"))
+		id, ok := groups[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "404 Group Not Found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id": %d, "full_path": %q}`, id, name)
+	})
+	mux.HandleFunc("/api/v4/groups", func(w http.ResponseWriter, r *http.Request) {
+		opts := gitlab.CreateGroupOptions{}
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			t.Error(err)
+			return
+		}
+
+		parent := ""
+		for name, id := range groups {
+			if opts.ParentID != nil && id == *opts.ParentID {
+				parent = name + "/"
+			}
+		}
+
+		name := parent + *opts.Path
+		groups[name] = int64(len(groups) + 1)
+		created = append(created, name)
+		fmt.Fprintf(w, `{"id": %d, "full_path": %q}`, groups[name], name)
+	})
+
+	client, err := gitlab.NewClient("", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getNamespace(client, "mirrors/acme/team", types.GenRepo{}); err == nil {
+		t.Error("groups are only created with createorg")
+	}
+
+	id, err := getNamespace(client, "mirrors/acme/team", types.GenRepo{CreateOrg: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id == nil || *id != groups["mirrors/acme/team"] || strings.Join(created, ",") != "mirrors/acme,mirrors/acme/team" {
+		t.Errorf("created %v, got %v", created, id)
+	}
+}
+
+//nolint:paralleltest // shortens the global poll interval
+func TestProjectExport(t *testing.T) {
+	previous := exportPollInterval
+	exportPollInterval = time.Millisecond
+	t.Cleanup(func() { exportPollInterval = previous })
+
+	var scheduled, polls int32
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/7/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			atomic.AddInt32(&scheduled, 1)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"message": "202 Accepted"}`)
+			return
+		}
+
+		status := "started"
+		if atomic.AddInt32(&polls, 1) > 2 {
+			status = "finished"
+		}
+		fmt.Fprintf(w, `{"export_status": %q, "_links": {"api_url": "%s/api/v4/projects/7/export/download"}}`, status, server.URL)
+	})
+	mux.HandleFunc("/api/v4/projects/7/export/download", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			t.Error("export downloaded without token")
+		}
+		fmt.Fprint(w, "archive")
+	})
+
+	client, err := gitlab.NewClient("token", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	project := &gitlab.Project{ID: 7, Name: "website", Path: "website"}
+	if export := ProjectExport(context.Background(), project, client, types.GenRepo{}, "token"); export != nil {
+		t.Fatal("returned an export without the option")
+	}
+
+	export := ProjectExport(context.Background(), project, client, types.GenRepo{Export: true}, "token")
+	if export == nil || atomic.LoadInt32(&scheduled) != 0 {
+		t.Fatal("the export was scheduled before it was opened")
+	}
+
+	for range 2 {
+		body, err := export.Open(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != "archive" {
+			t.Errorf("got %q", content)
+		}
+	}
+
+	if atomic.LoadInt32(&scheduled) != 1 || atomic.LoadInt32(&polls) != 4 {
+		t.Errorf("scheduled %d exports and polled %d times, want 1 and 4", scheduled, polls)
+	}
+}
+
+func TestArchiveAndRename(t *testing.T) {
+	t.Parallel()
+
+	requests := []string{}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/v4/projects/", func(w http.ResponseWriter, r *http.Request) {
+		project, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/projects/"))
+		if r.Method == http.MethodPut {
+			opts := gitlab.EditProjectOptions{}
+			if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+				t.Error(err)
+				return
+			}
+			project += " " + *opts.Path
+		}
+		requests = append(requests, r.Method+" "+project)
+		fmt.Fprint(w, `{"id": 1}`)
+	})
+	mux.HandleFunc("/api/v4/user", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"id": 1, "username": "backup"}`)
+	})
+
+	d := types.GenRepo{URL: server.URL}
+	if err := Archive(d, "mirrors/acme", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Rename(d, "", "website", "site"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "POST mirrors/acme/old/archive,PUT backup/website site"
+	if strings.Join(requests, ",") != want {
+		t.Errorf("requests %v, want %s", requests, want)
+	}
+}
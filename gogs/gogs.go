@@ -1,10 +1,13 @@
 package gogs
 
 import (
+	"context"
 	"strconv"
 	"time"
 
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/gogs/go-gogs-client"
 	"github.com/rs/zerolog"
@@ -23,8 +26,9 @@ func getRepoVisibility(visibility string, private bool) bool {
 	}
 }
 
-// Backup TODO.
-func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
+// Backup mirrors r with a pull mirror on the Gogs destination d and returns
+// the error that stopped it.
+func Backup(r types.Repo, d types.GenRepo, dry bool) error {
 	repovisibility := getRepoVisibility(d.Visibility.Repositories, r.Private)
 	sub = logger.CreateSubLogger("stage", "gogs", "url", d.URL)
 	sub.Info().
@@ -36,12 +40,10 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 	if err != nil {
 		sub.Error().
 			Msg(err.Error())
-		return false
+		return err
 	}
 
-	if d.User == "" && d.CreateOrg {
-		d.User = r.Owner
-	}
+	d.User = d.TargetOwner(r.Owner)
 
 	if d.User != "" {
 		user, err = gogsclient.GetUserInfo(d.User)
@@ -53,20 +55,20 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 				if err != nil {
 					sub.Error().
 						Msg(err.Error())
-					return false
+					return err
 				}
 				user.ID = org.ID
 				user.UserName = org.UserName
 			} else {
 				sub.Error().
 					Msg(err.Error())
-				return false
+				return err
 			}
 		}
 	}
 
 	if dry {
-		return true
+		return nil
 	}
 
 	repo, err := gogsclient.GetRepo(user.UserName, r.Name)
@@ -100,15 +102,14 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 				Msg(err.Error())
 			sub.Info().
 				Msgf("deleting %s again", types.Blue(r.Name))
-			err = gogsclient.DeleteRepo(user.UserName, r.Name)
-			if err != nil {
+			if err := gogsclient.DeleteRepo(user.UserName, r.Name); err != nil {
 				sub.Error().
 					Msgf("couldn't delete %s!", types.Red(r.Name))
 			}
-			return false
+			return err
 		}
 
-		return true
+		return nil
 	}
 
 	if repo.Mirror {
@@ -119,18 +120,18 @@ func Backup(r types.Repo, d types.GenRepo, dry bool) bool {
 		if err != nil {
 			sub.Error().
 				Msg(err.Error())
-			return false
+			return err
 		}
 
 		sub.Info().
 			Msgf("successfully synced %s.", types.Blue(r.Name))
 	}
 
-	return true
+	return nil
 }
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(ctx context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	for _, repo := range conf.Source.Gogs {
@@ -140,6 +141,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
 		ran = true
 		if repo.User == "" {
 			sub.Info().
@@ -151,6 +156,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 
 		token := repo.GetToken()
 		client := gogs.NewClient(repo.URL, token)
+		client.SetHTTPClient(prometheus.InstrumentClient("gogs", tracing.Client(ctx)))
 		var gogsrepos []*gogs.Repository
 
 		if repo.User == "" {
@@ -164,10 +170,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			continue
 		}
 
-		include := types.GetMap(repo.Include)
-		includeorgs := types.GetMap(repo.IncludeOrgs)
-		exclude := types.GetMap(repo.Exclude)
-		excludeorgs := types.GetMap(repo.ExcludeOrgs)
+		include := types.NewMatcher(repo.Include)
+		includeorgs := types.NewMatcher(repo.IncludeOrgs)
+		exclude := types.NewMatcher(repo.Exclude)
+		excludeorgs := types.NewMatcher(repo.ExcludeOrgs)
 
 		for _, r := range gogsrepos {
 			sub.Debug().Msg(r.HTMLURL)
@@ -182,12 +188,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if time.Since(r.Updated) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 				continue
 			}
+			if !repo.Filter.Match(filterEnv(r)) {
+				continue
+			}
 
-			if exclude[r.Name] {
+			if exclude.MatchRepo(r.Owner.UserName, r.Name) {
 				continue
 			}
 
-			if include[r.Name] {
+			if include.MatchRepo(r.Owner.UserName, r.Name) {
 				repos = append(repos, types.Repo{
 					Name:        r.Name,
 					URL:         r.CloneURL,
@@ -198,12 +207,16 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo),
+					Metadata:    getMetadata(r),
+					Size:        r.Size / 1024,
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if repo.Wiki {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -219,7 +232,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 				continue
 			}
 
-			if len(include) == 0 {
+			if include.Empty() {
 				repos = append(repos, types.Repo{
 					Name:        r.Name,
 					URL:         r.CloneURL,
@@ -230,12 +243,16 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo),
+					Metadata:    getMetadata(r),
+					Size:        r.Size / 1024,
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if repo.Wiki {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -264,38 +281,21 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 
 		orgrepos := []*gogs.Repository{}
 		for _, org := range orgs {
-			if excludeorgs[org.UserName] {
+			if excludeorgs.Match(org.UserName) {
+				continue
+			}
+			if !includeorgs.Empty() && !includeorgs.Match(org.UserName) {
 				continue
 			}
-			for {
-				if len(includeorgs) > 0 {
-					if includeorgs[org.UserName] {
-						o, err := client.ListOrgRepos(org.UserName)
-						if err != nil {
-							sub.Error().
-								Msg(err.Error())
-						}
-
-						if len(o) == 0 {
-							break
-						}
-
-						orgrepos = append(orgrepos, o...)
-					}
-				} else {
-					o, err := client.ListOrgRepos(org.UserName)
-					if err != nil {
-						sub.Error().
-							Msg(err.Error())
-					}
-
-					if len(o) == 0 {
-						break
-					}
 
-					orgrepos = append(orgrepos, o...)
-				}
+			// the organization repositories aren't paginated
+			o, err := client.ListOrgRepos(org.UserName)
+			if err != nil {
+				sub.Error().
+					Msg(err.Error())
 			}
+
+			orgrepos = append(orgrepos, o...)
 		}
 		for _, r := range orgrepos {
 			if repo.Filter.ExcludeForks {
@@ -309,12 +309,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			if time.Since(r.Updated) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 				continue
 			}
+			if !repo.Filter.Match(filterEnv(r)) {
+				continue
+			}
 
-			if exclude[r.Name] {
+			if exclude.MatchRepo(r.Owner.UserName, r.Name) {
 				continue
 			}
 
-			if include[r.Name] {
+			if include.MatchRepo(r.Owner.UserName, r.Name) {
 				repos = append(repos, types.Repo{
 					Name:        r.Name,
 					URL:         r.CloneURL,
@@ -325,12 +328,16 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo),
+					Metadata:    getMetadata(r),
+					Size:        r.Size / 1024,
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 				if repo.Wiki {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -357,13 +364,17 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     r.Private,
-					Issues:      GetIssues(r, client, repo),
+					Enrich:      enrich(r, client, repo),
+					Metadata:    getMetadata(r),
+					Size:        r.Size / 1024,
+					ID:          strconv.FormatInt(r.ID, 10),
 					NoTokenUser: true,
 				})
 
 				if repo.Wiki {
 					repos = append(repos, types.Repo{
 						Name:        r.Name + ".wiki",
+						ID:          strconv.FormatInt(r.ID, 10) + ".wiki",
 						URL:         types.DotGitRx.ReplaceAllString(r.CloneURL, ".wiki.git"),
 						SSHURL:      types.DotGitRx.ReplaceAllString(r.SSHURL, ".wiki.git"),
 						Token:       token,
@@ -382,6 +393,14 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 	return repos, ran
 }
 
+// enrich returns the function that fetches the issues of r, once it is known
+// that r is backed up.
+func enrich(r *gogs.Repository, client *gogs.Client, conf types.GenRepo) func(context.Context, *types.Repo) {
+	return func(_ context.Context, repo *types.Repo) {
+		repo.Issues = GetIssues(r, client, conf)
+	}
+}
+
 // GetIssues get issues
 func GetIssues(repo *gogs.Repository, client *gogs.Client, conf types.GenRepo) map[string]interface{} {
 	issues := map[string]interface{}{}
@@ -401,7 +420,7 @@ func GetIssues(repo *gogs.Repository, client *gogs.Client, conf types.GenRepo) m
 			} else {
 				if len(i) > 0 {
 					for _, issue := range i {
-						issues[strconv.Itoa(int(issue.Index))] = issue
+						issues[strconv.Itoa(int(issue.Index))] = getIssue(client, repo.Owner.UserName, repo.Name, issue)
 					}
 				} else {
 					break
@@ -413,6 +432,56 @@ func GetIssues(repo *gogs.Repository, client *gogs.Client, conf types.GenRepo) m
 	return issues
 }
 
+// filterEnv get the attributes of a repository for filter expressions
+func filterEnv(repo *gogs.Repository) types.FilterEnv {
+	env := types.FilterEnv{
+		Name:         repo.Name,
+		Size:         repo.Size / 1024,
+		Visibility:   "public",
+		Fork:         repo.Fork,
+		Stars:        repo.Stars,
+		LastActivity: repo.Updated,
+	}
+
+	if repo.Private {
+		env.Visibility = "private"
+	}
+
+	if repo.Owner != nil {
+		env.Owner = repo.Owner.UserName
+	}
+
+	return env
+}
+
+// getMetadata get the metadata of a repository
+func getMetadata(repo *gogs.Repository) *types.Metadata {
+	meta := &types.Metadata{
+		Description:   repo.Description,
+		Homepage:      repo.Website,
+		DefaultBranch: repo.DefaultBranch,
+		Fork:          repo.Fork,
+		Visibility:    "public",
+		CreatedAt:     &repo.Created,
+		UpdatedAt:     &repo.Updated,
+		Extra: map[string]interface{}{
+			"html_url": repo.HTMLURL,
+			"stars":    repo.Stars,
+			"forks":    repo.Forks,
+		},
+	}
+
+	if repo.Private {
+		meta.Visibility = "private"
+	}
+
+	if repo.Parent != nil {
+		meta.Parent = repo.Parent.FullName
+	}
+
+	return meta
+}
+
 // GetOrCreate Get or create a repository
 func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	repovisibility := getRepoVisibility(destination.Visibility.Repositories, repo.Private)
@@ -426,9 +495,7 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	}
 	me := user
 
-	if destination.User == "" && destination.CreateOrg {
-		destination.User = repo.Owner
-	}
+	destination.User = destination.TargetOwner(repo.Owner)
 
 	if destination.User != "" {
 		user, err = gogsclient.GetUserInfo(destination.User)
@@ -450,10 +517,11 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 
 	r, err := gogsclient.GetRepo(user.UserName, repo.Name)
 	if err != nil {
+		// gogs only takes the description of the metadata
 		opts := gogs.CreateRepoOption{
 			Name:        repo.Name,
 			Private:     repovisibility,
-			Description: repo.Description,
+			Description: repo.GetMetadata().Description,
 		}
 
 		if me.UserName == user.UserName {
@@ -471,3 +539,22 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 
 	return r.CloneURL, nil
 }
+
+// getIssue fetches the comments of an issue, they are left empty if they
+// can't be fetched. Gogs has no reactions, events or attachments.
+func getIssue(client *gogs.Client, owner, name string, issue *gogs.Issue) types.Issue {
+	i := types.NewIssue(issue)
+	if issue.Comments == 0 {
+		return i
+	}
+
+	comments, err := client.ListIssueComments(owner, name, issue.Index)
+	if err != nil {
+		sub.Error().Err(err).Str("repo", name).Int64("issue", issue.Index).Msg("can't fetch comments")
+		return i
+	}
+
+	i.Comments = types.List(comments)
+
+	return i
+}
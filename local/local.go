@@ -1,6 +1,8 @@
 package local
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +18,8 @@ import (
 
 	"github.com/cooperspencer/gickup/gitcmd"
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/releases"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/cooperspencer/gickup/zip"
 	"github.com/go-git/go-git/v5"
@@ -61,8 +65,10 @@ func toGitCmdAuth(auth transport.AuthMethod) *gitcmd.Auth {
 	return nil
 }
 
-// Locally TODO.
-func Locally(repo types.Repo, l types.Local, dry bool) bool {
+// Locally backs repo up to l and returns the error that stopped the backup.
+// rewritten is called for every branch or tag whose history was rewritten or
+// deleted upstream, it may be nil.
+func Locally(ctx context.Context, repo types.Repo, l types.Local, dry bool, rewritten func(RewrittenRef)) error {
 	sub = logger.CreateSubLogger("stage", "locally", "path", l.Path)
 	if l.LFS {
 		g, err := gitcmd.New()
@@ -73,10 +79,18 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 		gitc = g
 	}
 	date := time.Now()
+	// source keeps the name of the source for the metric labels
+	source := repo
 
-	if l.Structured {
-		repo.Name = path.Join(repo.Hoster, repo.Owner, repo.Name)
+	name, err := types.RenderName(l.NameTemplate, l.Structured, repo, date)
+	if err != nil {
+		sub.Error().
+			Str("repo", repo.Name).
+			Msg(err.Error())
+
+		return err
 	}
+	repo.Name = name
 
 	if l.Bare || l.Mirror {
 		repo.Name += ".git"
@@ -86,13 +100,13 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 		repo.Name = path.Join(repo.Name, fmt.Sprint(date.Unix()))
 	}
 
-	_, err := os.Stat(l.Path)
+	_, err = os.Stat(l.Path)
 	if os.IsNotExist(err) && !dry {
 		if err = os.MkdirAll(l.Path, 0o777); err != nil {
 			sub.Error().
 				Msg(err.Error())
 
-			return false
+			return err
 		}
 
 		_, err = os.Stat(l.Path)
@@ -102,7 +116,7 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 		sub.Error().
 			Msg(err.Error())
 
-		return false
+		return err
 	}
 
 	tries := 5
@@ -121,7 +135,7 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 			sub.Error().
 				Msg(err.Error())
 
-			return false
+			return err
 		}
 	case repo.Token != "":
 		auth = tokenAuth(repo)
@@ -138,21 +152,21 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 			sub.Info().
 				Msgf("cloning %s", types.Green(repo.Name))
 
-			err := cloneRepository(repo, auth, dry, l)
+			err := cloneRepository(ctx, repo, auth, dry, l)
 			if err != nil {
 				if err.Error() == "repository not found" {
 					sub.Warn().
 						Str("repo", repo.Name).
 						Msg(err.Error())
 
-					return false
+					return err
 				}
 				if x == tries {
 					sub.Warn().
 						Str("repo", repo.Name).
 						Msg(err.Error())
 
-					return false
+					return err
 				}
 
 				if strings.Contains(err.Error(), "ERR access denied or repository not exported") {
@@ -160,7 +174,7 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 						Str("repo", repo.Name).
 						Msgf("%s doesn't exist.", repo.Name)
 
-					return false
+					return err
 				}
 
 				if strings.Contains(err.Error(), "remote repository is empty") {
@@ -197,7 +211,7 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 				sub.Info().
 					Msgf("opening %s locally", types.Green(repo.Name))
 
-				err := updateRepository(repo, auth, dry, l)
+				err := updateRepository(ctx, repo, auth, dry, l, rewritten)
 				if err != nil {
 					switch {
 					case errors.Is(err, git.NoErrAlreadyUpToDate):
@@ -208,7 +222,7 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 							Str("repo", repo.Name).
 							Msg(err.Error())
 
-						return false
+						return err
 					default:
 						sub.Warn().
 							Str("repo", repo.Name).Err(err).
@@ -222,34 +236,61 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 			}
 		}
 
+		metadata := false
+		if !dry {
+			if err := WriteMetadata(l.Path, repo); err != nil {
+				sub.Error().
+					Str("repo", repo.Name).
+					Msg(err.Error())
+			} else {
+				metadata = true
+			}
+		}
+
 		if len(repo.Issues) > 0 {
-			_, err := os.Stat(filepath.Join(l.Path, fmt.Sprintf("%s.issues", repo.Name)))
-			if os.IsNotExist(err) && !dry {
-				if err := os.MkdirAll(filepath.Join(l.Path, fmt.Sprintf("%s.issues", repo.Name)), 0o777); err != nil {
+			sub.Info().Str("repo", repo.Name).Msg("backing up issues")
+			if !dry {
+				if err := migrateIssues(filepath.Join(l.Path, repo.Name+".issues")); err != nil {
+					sub.Warn().Err(err).Str("repo", repo.Name).Msg("can't migrate issues")
+				}
+			}
+			if written, ok := writeSidecar(l.Path, repo.Name, "issues", repo.Issues, dry); ok {
+				prometheus.IssuesBackedUp.WithLabelValues(source.Hoster, source.Name, source.Owner, "local", l.Path).Set(float64(written))
+			}
+		}
+
+		if len(repo.PullRequests) > 0 {
+			sub.Info().Str("repo", repo.Name).Msg("backing up pull requests")
+			if written, ok := writeSidecar(l.Path, repo.Name, "pulls", repo.PullRequests, dry); ok {
+				prometheus.PullRequestsBackedUp.WithLabelValues(source.Hoster, source.Name, source.Owner, "local", l.Path).Set(float64(written))
+			}
+		}
+
+		if len(repo.Comments) > 0 {
+			sub.Info().Str("repo", repo.Name).Msg("backing up comments")
+			writeSidecar(l.Path, repo.Name, "comments", repo.Comments, dry)
+		}
+
+		if len(repo.Releases) > 0 {
+			sub.Info().Str("repo", repo.Name).Msg("backing up releases")
+			if !dry {
+				if _, err := releases.Write(ctx, l.Path, repo); err != nil {
 					sub.Error().
+						Str("repo", repo.Name).
 						Msg(err.Error())
 				}
 			}
-			issuesDir, err := filepath.Abs(filepath.Join(l.Path, fmt.Sprintf("%s.issues", repo.Name)))
-			if err != nil {
-				sub.Error().
-					Msg(err.Error())
-			} else {
-				sub.Info().Str("repo", repo.Name).Msg("backing up issues")
-				if !dry {
-					for k, v := range repo.Issues {
-						jsonData, err := json.Marshal(v)
-						if err != nil {
-							sub.Error().
-								Msg(err.Error())
-						} else {
-							err = os.WriteFile(filepath.Join(issuesDir, fmt.Sprintf("%s.json", k)), jsonData, 0o644)
-							if err != nil {
-								sub.Error().
-									Msg(err.Error())
-							}
-						}
-					}
+		}
+
+		if repo.Export != nil {
+			sub.Info().Str("repo", repo.Name).Msg("backing up the export")
+			if !dry {
+				if err := WriteExport(ctx, l.Path, repo); err != nil {
+					sub.Error().
+						Str("repo", repo.Name).
+						Msg(err.Error())
+
+					return err
 				}
 			}
 		}
@@ -257,9 +298,29 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 		if l.Zip {
 			tozip := []string{filepath.Join(l.Path, repo.Name)}
 
+			if metadata {
+				tozip = append(tozip, filepath.Join(l.Path, fmt.Sprintf("%s.meta.json", repo.Name)))
+			}
+
 			if len(repo.Issues) > 0 {
 				tozip = append(tozip, filepath.Join(l.Path, fmt.Sprintf("%s.issues", repo.Name)))
 			}
+
+			if len(repo.PullRequests) > 0 {
+				tozip = append(tozip, filepath.Join(l.Path, fmt.Sprintf("%s.pulls", repo.Name)))
+			}
+
+			if len(repo.Comments) > 0 {
+				tozip = append(tozip, filepath.Join(l.Path, fmt.Sprintf("%s.comments", repo.Name)))
+			}
+
+			if len(repo.Releases) > 0 {
+				tozip = append(tozip, releases.Dir(l.Path, repo.Name))
+			}
+
+			if repo.Export != nil {
+				tozip = append(tozip, filepath.Join(l.Path, fmt.Sprintf("%s.export.tar.gz", repo.Name)))
+			}
 			sub.Info().
 				Msgf("zipping %s", types.Green(repo.Name))
 
@@ -273,7 +334,7 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 					Str("repo", repo.Name).
 					Msg(err.Error())
 
-				return false
+				return err
 			}
 		}
 
@@ -282,14 +343,195 @@ func Locally(repo types.Repo, l types.Local, dry bool) bool {
 				sub.Warn().
 					Str("repo", repo.Name).Msg(err.Error())
 
-				return false
+				return err
 			}
 		}
 
 		x = 5
 	}
 
-	return true
+	return nil
+}
+
+// WriteExport writes the export archive of repo to <dir>/<repo.Name>.export.tar.gz.
+// The archive is downloaded into the asset cache once per run and linked into
+// every destination. A failed download keeps the archive of the previous run.
+func WriteExport(ctx context.Context, dir string, repo types.Repo) error {
+	target := filepath.Join(dir, fmt.Sprintf("%s.export.tar.gz", repo.Name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+		return err
+	}
+
+	src, err := releases.Fetch(ctx, repo.Export)
+	if err != nil {
+		return err
+	}
+
+	return releases.Link(src, target)
+}
+
+// WriteMetadata writes the metadata of repo to <dir>/<repo.Name>.meta.json.
+func WriteMetadata(dir string, repo types.Repo) error {
+	target := filepath.Join(dir, fmt.Sprintf("%s.meta.json", repo.Name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(repo.GetMetadata(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(target, data, 0o644)
+}
+
+// Move moves the backup of the repository named from, with everything stored
+// next to it, to the name to below the path of l. It fails without moving
+// anything if one of the targets exists already.
+func Move(l types.Local, from, to string) (int, error) {
+	dir := filepath.Join(l.Path, filepath.Dir(filepath.FromSlash(from)))
+	base := path.Base(from)
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	moves := map[string]string{}
+	for _, entry := range entries {
+		if !types.StoredAs(entry.Name(), base) {
+			continue
+		}
+
+		target := filepath.Join(l.Path, filepath.FromSlash(to+strings.TrimPrefix(entry.Name(), base)))
+		if _, err := os.Lstat(target); err == nil {
+			return 0, fmt.Errorf("%s exists already", target)
+		}
+
+		moves[filepath.Join(dir, entry.Name())] = target
+	}
+
+	for source, target := range moves {
+		if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+			return 0, err
+		}
+
+		if err := os.Rename(source, target); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(moves), nil
+}
+
+// writeSidecar writes every item as <key>.json into the directory
+// <name>.<kind> next to the repository. It returns the count of written items
+// and false if the directory isn't usable or dry is set.
+func writeSidecar(path, name, kind string, items map[string]interface{}, dry bool) (int, bool) {
+	dir, err := filepath.Abs(filepath.Join(path, fmt.Sprintf("%s.%s", name, kind)))
+	if err != nil {
+		sub.Error().
+			Msg(err.Error())
+		return 0, false
+	}
+
+	if dry {
+		return 0, false
+	}
+
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		sub.Error().
+			Msg(err.Error())
+		return 0, false
+	}
+
+	written := 0
+	for k, v := range items {
+		jsonData, err := json.Marshal(v)
+		if err != nil {
+			sub.Error().
+				Msg(err.Error())
+			continue
+		}
+
+		err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.json", k)), jsonData, 0o644)
+		if err != nil {
+			sub.Error().
+				Msg(err.Error())
+			continue
+		}
+
+		written++
+	}
+
+	return written, true
+}
+
+// migrateIssues renames the Comments key of the OneDev issues written before
+// every hoster shared types.Issue to comments and adds the empty lists. The
+// issues that still exist are rewritten anyway, the ones deleted upstream
+// keep the shape of the others.
+func migrateIssues(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		file := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Contains(data, []byte(`"Comments":`)) {
+			continue
+		}
+
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		comments, ok := fields["Comments"]
+		if !ok {
+			continue
+		}
+
+		delete(fields, "Comments")
+		if string(comments) == "null" {
+			comments = json.RawMessage("[]")
+		}
+		fields["comments"] = comments
+
+		for _, key := range []string{"reactions", "events", "attachments"} {
+			if _, ok := fields[key]; !ok {
+				fields[key] = json.RawMessage("[]")
+			}
+		}
+
+		data, err = json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // pruneOldBackups enforces l.Keep by removing the oldest timestamped backups
@@ -366,13 +608,27 @@ func sanitizeRemote(r *git.Repository, cleanURL string) error {
 	return nil
 }
 
-func updateRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l types.Local) error {
+func updateRepository(ctx context.Context, repo types.Repo, auth transport.AuthMethod, dry bool, l types.Local, rewritten func(RewrittenRef)) error {
 	r, err := git.PlainOpen(filepath.Join(l.Path, repo.Name))
 	if err != nil {
 		return err
 	}
 
 	if !dry {
+		// the go-git fetches overwrite every ref, git only the ones of origin
+		extra := []config.RefSpec{"+refs/*:refs/*"}
+		if l.LFS {
+			extra = nil
+		}
+
+		guard, guardErr := guardUpdate(r, repo, auth, extra)
+		if guardErr != nil {
+			return guardErr
+		}
+		if guard != nil {
+			defer reportRewritten(repo, guard, rewritten)
+		}
+
 		if l.LFS {
 			_, err = os.Stat(filepath.Join(l.Path, repo.Name))
 			if err != nil {
@@ -388,7 +644,12 @@ func updateRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l ty
 			sub.Info().
 				Msgf("pulling %s", types.Green(repo.Name))
 
-			err = gitc.Pull(l.Bare, l.Mirror, filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth))
+			err = gitc.Pull(ctx, l.Bare, l.Mirror, filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth))
+			if err != nil {
+				return err
+			}
+
+			err = fetchPullRefs(ctx, repo, auth, l)
 			if err != nil {
 				return err
 			}
@@ -397,31 +658,39 @@ func updateRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l ty
 				sub.Info().
 					Msgf("fetching lfs files for %s", types.Green(repo.Name))
 
-				err = gitc.LFSFetch(filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth))
+				err = gitc.LFSFetch(ctx, filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth))
 				if err != nil {
 					return err
 				}
 			}
 		} else {
 			// fetch to see if there are any unpullable commits, for example a force push
-			err = r.Fetch(&git.FetchOptions{Auth: auth, RemoteName: "origin"})
+			err = r.Fetch(&git.FetchOptions{Auth: auth, RemoteName: "origin", Depth: depth(repo)})
 			if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
 				return err
 			}
 			sub.Info().
 				Msgf("pulling %s", types.Green(repo.Name))
+			forced := false
 			if !l.Bare && !l.Mirror {
 				w, worktreeErr := r.Worktree()
 				if worktreeErr != nil && !errors.Is(worktreeErr, git.NoErrAlreadyUpToDate) {
 					return worktreeErr
 				}
-				err = w.Pull(&git.PullOptions{Auth: auth, RemoteName: "origin", SingleBranch: false})
-				if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+				err = w.Pull(&git.PullOptions{Auth: auth, RemoteName: "origin", SingleBranch: false, Depth: depth(repo)})
+				switch {
+				case errors.Is(err, git.ErrNonFastForwardUpdate) && guard != nil:
+					// the previous tip is kept, the worktree follows the rewritten history
+					forced = true
+				case err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate):
 					return err
 				}
 			}
 			// if everything was ok, fetch everything
-			err = r.Fetch(&git.FetchOptions{Auth: auth, RemoteName: "origin", RefSpecs: []config.RefSpec{"+refs/*:refs/*"}})
+			err = r.Fetch(&git.FetchOptions{Auth: auth, RemoteName: "origin", RefSpecs: []config.RefSpec{"+refs/*:refs/*"}, Depth: depth(repo)})
+			if forced && (err == nil || errors.Is(err, git.NoErrAlreadyUpToDate)) {
+				return resetWorktree(r)
+			}
 			if err != nil {
 				return err
 			}
@@ -430,7 +699,66 @@ func updateRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l ty
 	return err
 }
 
-func cloneRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l types.Local) error {
+// guardUpdate keeps the tips of the refs the fetches of an update may
+// overwrite, see guardRefs. Shallow clones have no history to keep, their
+// guard is nil.
+func guardUpdate(r *git.Repository, repo types.Repo, auth transport.AuthMethod, extra []config.RefSpec) (*refGuard, error) {
+	shallow, err := r.Storer.Shallow()
+	if err != nil {
+		return nil, err
+	}
+	if repo.Shallow || len(shallow) > 0 {
+		return nil, nil
+	}
+
+	return guardRefs(r, auth, extra, time.Now())
+}
+
+// reportRewritten warns about the refs rewritten or deleted upstream during an
+// update and passes them to report.
+func reportRewritten(repo types.Repo, guard *refGuard, report func(RewrittenRef)) {
+	for _, rw := range guard.rewritten() {
+		sub.Warn().
+			Str("repo", repo.Name).
+			Str("ref", rw.Name.String()).
+			Msgf("%s was %s upstream, its previous tip %s is kept as %s", rw.Name, rw.Change, rw.Previous, types.Green(rw.Kept))
+
+		if report != nil {
+			report(rw)
+		}
+	}
+}
+
+// resetWorktree checks the rewritten history of HEAD out.
+func resetWorktree(r *git.Repository) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	return w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+}
+
+// fetchPullRefs keeps the commits of pull requests by fetching their heads into
+// refs/pull/*, or refs/merge-requests/* for GitLab. Mirrors and the go-git
+// clones already fetch every ref.
+func fetchPullRefs(ctx context.Context, repo types.Repo, auth transport.AuthMethod, l types.Local) error {
+	if !repo.Origin.PullRequests || l.Mirror {
+		return nil
+	}
+
+	sub.Info().
+		Msgf("fetching pull requests of %s", types.Green(repo.Name))
+
+	return gitc.FetchRefs(ctx, filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth), "+refs/pull/*:refs/pull/*", "+refs/merge-requests/*:refs/merge-requests/*")
+}
+
+func cloneRepository(ctx context.Context, repo types.Repo, auth transport.AuthMethod, dry bool, l types.Local) error {
 	if dry {
 		return nil
 	}
@@ -469,7 +797,12 @@ func cloneRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l typ
 	}
 
 	if l.LFS {
-		err = gitc.Clone(url, filepath.Join(l.Path, repo.Name), l.Bare, l.Mirror, toGitCmdAuth(auth))
+		err = gitc.Clone(ctx, url, filepath.Join(l.Path, repo.Name), l.Bare, l.Mirror, toGitCmdAuth(auth))
+		if err != nil {
+			return err
+		}
+
+		err = fetchPullRefs(ctx, repo, auth, l)
 		if err != nil {
 			return err
 		}
@@ -478,7 +811,7 @@ func cloneRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l typ
 			sub.Info().
 				Msgf("fetching lfs files for %s", types.Green(repo.Name))
 
-			err = gitc.LFSFetch(filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth))
+			err = gitc.LFSFetch(ctx, filepath.Join(l.Path, repo.Name), toGitCmdAuth(auth))
 			if err != nil {
 				return err
 			}
@@ -490,6 +823,7 @@ func cloneRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l typ
 			Auth:         auth,
 			SingleBranch: false,
 			Mirror:       l.Mirror,
+			Depth:        depth(repo),
 		})
 		if err != nil {
 			return err
@@ -498,6 +832,7 @@ func cloneRepository(repo types.Repo, auth transport.AuthMethod, dry bool, l typ
 			RefSpecs: []config.RefSpec{"refs/*:refs/*"},
 			Auth:     auth,
 			Force:    true,
+			Depth:    depth(repo),
 		})
 		if errors.Is(err, git.NoErrAlreadyUpToDate) {
 			err = nil
@@ -549,15 +884,24 @@ func VerifyHost(host string, remote net.Addr, key gossh.PublicKey) error {
 	return goph.AddKnownHost(host, remote, key, "")
 }
 
-func TempClone(repo types.Repo, tempdir string) (*git.Repository, error) {
-	return tempCloneBase(repo, tempdir, false)
+// depth returns the clone depth of the repository, 0 clones everything.
+func depth(repo types.Repo) int {
+	if repo.Shallow {
+		return 1
+	}
+
+	return 0
 }
 
-func TempCloneBare(repo types.Repo, tempdir string) (*git.Repository, error) {
-	return tempCloneBase(repo, tempdir, true)
+func TempClone(ctx context.Context, repo types.Repo, tempdir string) (*git.Repository, error) {
+	return tempCloneBase(ctx, repo, tempdir, false)
 }
 
-func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repository, error) {
+func TempCloneBare(ctx context.Context, repo types.Repo, tempdir string) (*git.Repository, error) {
+	return tempCloneBase(ctx, repo, tempdir, true)
+}
+
+func tempCloneBase(ctx context.Context, repo types.Repo, tempdir string, isBare bool) (*git.Repository, error) {
 	var auth transport.AuthMethod
 	if repo.Token != "" {
 		auth = tokenAuth(repo)
@@ -574,7 +918,7 @@ func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repositor
 		}
 		gitc = g
 
-		err = gitc.Clone(repo.URL, tempdir, isBare, false, toGitCmdAuth(auth))
+		err = gitc.Clone(ctx, repo.URL, tempdir, isBare, false, toGitCmdAuth(auth))
 		if err != nil {
 			return nil, err
 		}
@@ -607,7 +951,7 @@ func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repositor
 		// Print the names of branches
 		err = refs.ForEach(func(ref *plumbing.Reference) error {
 			if ref.Name().Short() != headRef.Name().Short() {
-				return gitc.Checkout(tempdir, ref.Name().Short())
+				return gitc.Checkout(ctx, tempdir, ref.Name().Short())
 			}
 			return nil
 		})
@@ -615,12 +959,12 @@ func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repositor
 			return nil, err
 		}
 
-		err = gitc.Checkout(tempdir, headRef.Name().Short())
+		err = gitc.Checkout(ctx, tempdir, headRef.Name().Short())
 		if err != nil {
 			return nil, err
 		}
 
-		err = gitc.MirrorPull(tempdir, toGitCmdAuth(auth))
+		err = gitc.MirrorPull(ctx, tempdir, toGitCmdAuth(auth))
 		if err != nil {
 			return nil, err
 		}
@@ -631,6 +975,7 @@ func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repositor
 		URL:          repo.URL,
 		Auth:         auth,
 		SingleBranch: false,
+		Depth:        depth(repo),
 	})
 	if err != nil {
 		return nil, err
@@ -640,6 +985,7 @@ func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repositor
 		RefSpecs: []config.RefSpec{"refs/*:refs/*"},
 		Auth:     auth,
 		Force:    true,
+		Depth:    depth(repo),
 	})
 	if errors.Is(err, git.NoErrAlreadyUpToDate) {
 		return r, nil
@@ -647,7 +993,11 @@ func tempCloneBase(repo types.Repo, tempdir string, isBare bool) (*git.Repositor
 	return r, err
 }
 
-func CreateRemotePush(repo *git.Repository, destination types.GenRepo, url string, lfs bool) error {
+// CreateRemotePush pushes the branches and tags of repo to url. Before a
+// forced push the tips of the destination's refs whose history it rewrites
+// are kept below RewrittenPrefix on the destination, rewritten is called for
+// every one of them and may be nil.
+func CreateRemotePush(ctx context.Context, repo *git.Repository, destination types.GenRepo, url string, lfs bool, rewritten func(RewrittenRef)) error {
 	sub = logger.CreateSubLogger("stage", "tempclone", "url", url)
 	token := destination.GetToken()
 	var auth transport.AuthMethod
@@ -701,22 +1051,22 @@ func CreateRemotePush(repo *git.Repository, destination types.GenRepo, url strin
 		remote := RandomString(8)
 
 		if destination.SSH {
-			err = gitc.NewRemote(remote, url, worktree.Filesystem.Root())
+			err = gitc.NewRemote(ctx, remote, url, worktree.Filesystem.Root())
 			if err != nil {
 				return err
 			}
 
-			err = gitc.SSHPush(worktree.Filesystem.Root(), remote, destination.SSHKey)
+			err = gitc.SSHPush(ctx, worktree.Filesystem.Root(), remote, destination.SSHKey)
 			if err != nil {
 				return err
 			}
 		} else {
-			err = gitc.NewRemote(remote, url, worktree.Filesystem.Root())
+			err = gitc.NewRemote(ctx, remote, url, worktree.Filesystem.Root())
 			if err != nil {
 				return err
 			}
 
-			err = gitc.Push(worktree.Filesystem.Root(), remote, toGitCmdAuth(auth))
+			err = gitc.Push(ctx, worktree.Filesystem.Root(), remote, toGitCmdAuth(auth))
 			if err != nil {
 				return err
 			}
@@ -732,6 +1082,12 @@ func CreateRemotePush(repo *git.Repository, destination types.GenRepo, url strin
 
 	headref, _ := repo.Head()
 
+	if destination.Force {
+		if err := guardForcePush(repo, remote, auth, headref.Name(), rewritten); err != nil {
+			return err
+		}
+	}
+
 	pushoptions := git.PushOptions{Force: destination.Force, Auth: auth, RemoteName: remote.Config().Name, RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", headref.Name(), headref.Name()))}}
 
 	err = repo.Push(&pushoptions)
@@ -756,6 +1112,39 @@ func CreateRemotePush(repo *git.Repository, destination types.GenRepo, url strin
 	return err
 }
 
+// guardForcePush keeps the tips of the destination's refs the forced push of
+// the branches and tags of repo rewrites, see guardPush, and reports them.
+// Shallow clones have no history to tell fast-forwards apart, nothing is kept.
+func guardForcePush(repo *git.Repository, remote *git.Remote, auth transport.AuthMethod, head plumbing.ReferenceName, report func(RewrittenRef)) error {
+	shallow, err := repo.Storer.Shallow()
+	if err != nil || len(shallow) > 0 {
+		return err
+	}
+
+	refspecs, err := getPushRefSpecs(repo, head)
+	if err != nil {
+		return err
+	}
+	refspecs = append(refspecs, config.RefSpec(fmt.Sprintf("%s:%s", head, head)))
+
+	rewritten, err := guardPush(repo, remote, auth, refspecs, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, rw := range rewritten {
+		sub.Warn().
+			Str("ref", rw.Name.String()).
+			Msgf("%s was %s upstream, the previous tip %s is kept as %s on the destination", rw.Name, rw.Change, rw.Previous, types.Green(rw.Kept))
+
+		if report != nil {
+			report(rw)
+		}
+	}
+
+	return nil
+}
+
 func getPushRefSpecs(repo *git.Repository, skip plumbing.ReferenceName) ([]config.RefSpec, error) {
 	refs, err := repo.References()
 	if err != nil {
@@ -1,12 +1,17 @@
 package local
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/cooperspencer/gickup/releases"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
@@ -414,3 +419,192 @@ func TestGetPushRefSpecs(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteSidecar(t *testing.T) {
+	t.Parallel()
+
+	path := t.TempDir()
+	items := map[string]interface{}{"1": map[string]string{"title": "first"}, "2": map[string]string{"title": "second"}}
+
+	if written, ok := writeSidecar(path, "website", "pulls", items, true); ok || written != 0 {
+		t.Errorf("dry run wrote %d items", written)
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "website.pulls")); !os.IsNotExist(err) {
+		t.Errorf("dry run created the directory: %v", err)
+	}
+
+	written, ok := writeSidecar(path, "website", "pulls", items, false)
+	if !ok || written != 2 {
+		t.Fatalf("written = %d, %v, want 2, true", written, ok)
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, "website.pulls", "1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"title":"first"}` {
+		t.Errorf("unexpected content %s", data)
+	}
+}
+
+//nolint:paralleltest // replaces the global asset cache
+func TestWriteExport(t *testing.T) {
+	previous := releases.CacheDir
+	releases.CacheDir = t.TempDir()
+	t.Cleanup(func() { releases.CacheDir = previous })
+
+	downloads := 0
+	dir := t.TempDir()
+	repo := types.Repo{Name: "website/1785115104", Export: &types.Asset{
+		Open: func(context.Context) (io.ReadCloser, error) {
+			downloads++
+
+			return io.NopCloser(strings.NewReader("archive")), nil
+		},
+	}}
+
+	// every destination gets the archive of one download
+	for _, dir := range []string{dir, t.TempDir()} {
+		if err := WriteExport(context.Background(), dir, repo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target := filepath.Join(dir, "website", "1785115104.export.tar.gz")
+	data, err := os.ReadFile(target)
+	if err != nil || string(data) != "archive" || downloads != 1 {
+		t.Fatalf("got %q, %v after %d downloads", data, err, downloads)
+	}
+
+	// a failed export of the next run keeps the previous archive
+	repo.Export = &types.Asset{Open: func(context.Context) (io.ReadCloser, error) {
+		return nil, errors.New("export failed")
+	}}
+	if err := WriteExport(context.Background(), dir, repo); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if data, _ := os.ReadFile(target); string(data) != "archive" {
+		t.Errorf("previous archive was replaced with %q", data)
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	repo := types.Repo{Name: "website", Private: true, Metadata: &types.Metadata{Topics: []string{"go"}, DefaultBranch: "main"}}
+
+	if err := WriteMetadata(dir, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "website.meta.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := types.Metadata{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(meta.Topics, []string{"go"}) || meta.DefaultBranch != "main" || meta.Visibility != "private" {
+		t.Errorf("unexpected metadata %s", data)
+	}
+}
+
+func TestMove(t *testing.T) {
+	t.Parallel()
+
+	l := types.Local{Path: t.TempDir()}
+	for _, p := range []string{"acme/website/HEAD", "acme/website.meta.json", "acme/website.issues/1.json", "acme/website.wiki/HEAD"} {
+		target := filepath.Join(l.Path, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(target), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := Move(l, "acme/website", "_deleted/acme/website")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if moved != 3 {
+		t.Errorf("moved %d, want 3", moved)
+	}
+
+	for _, p := range []string{"_deleted/acme/website/HEAD", "_deleted/acme/website.meta.json", "_deleted/acme/website.issues/1.json", "acme/website.wiki/HEAD"} {
+		if _, err := os.Stat(filepath.Join(l.Path, filepath.FromSlash(p))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// a second backup under the same name isn't overwritten
+	if err := os.MkdirAll(filepath.Join(l.Path, "acme", "website"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Move(l, "acme/website", "_deleted/acme/website"); err == nil {
+		t.Error("expected an error for an existing target")
+	}
+
+	if moved, err := Move(l, "missing/repo", "_deleted/missing/repo"); err != nil || moved != 0 {
+		t.Errorf("moving nothing: %d, %v", moved, err)
+	}
+}
+
+func TestMigrateIssues(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	old := `{"Number":1,"Title":"crash","Comments":[{"Content":"me too"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "1.json"), []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	current := `{"number":2,"comments":[]}`
+	if err := os.WriteFile(filepath.Join(dir, "2.json"), []byte(current), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateIssues(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := issue["Comments"]; ok || string(issue["comments"]) != `[{"Content":"me too"}]` || string(issue["events"]) != "[]" || string(issue["Title"]) != `"crash"` {
+		t.Errorf("unexpected migrated issue %s", data)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "2.json")); string(data) != current {
+		t.Errorf("current issue was rewritten: %s", data)
+	}
+
+	if err := migrateIssues(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("missing directory: %v", err)
+	}
+}
+
+func TestLocallyReturnsError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	repo := types.Repo{Name: "website", URL: filepath.Join(dir, "missing")}
+	err := Locally(context.Background(), repo, types.Local{Path: filepath.Join(dir, "backup")}, false, nil)
+	if err == nil || !strings.Contains(err.Error(), "repository not found") {
+		t.Errorf("expected the clone error, got %v", err)
+	}
+}
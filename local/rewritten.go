@@ -0,0 +1,319 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// RewrittenPrefix is the namespace the previous tips of rewritten refs are
+// kept in. Fetches only write the refs of their refspecs, so they never touch
+// it.
+const RewrittenPrefix = "refs/gickup/rewritten/"
+
+// Changes of rewritten refs.
+const (
+	ForcePushed = "force-pushed"
+	Deleted     = "deleted"
+)
+
+// RewrittenRef is a branch or tag whose history was rewritten or deleted
+// upstream.
+type RewrittenRef struct {
+	// Name is the local ref.
+	Name plumbing.ReferenceName
+	// Change is ForcePushed or Deleted.
+	Change   string
+	Previous plumbing.Hash
+	// Kept is the ref below RewrittenPrefix that keeps Previous.
+	Kept plumbing.ReferenceName
+}
+
+// refGuard keeps the tips of refs a fetch may overwrite until it is known
+// whether the fetch rewrote their history.
+type refGuard struct {
+	repo *git.Repository
+	refs []RewrittenRef
+}
+
+// guardRefs keeps the tips of the local branches and tags the fetch specs of
+// origin and extra would move below RewrittenPrefix, before anything is
+// fetched. Refs that are unchanged upstream aren't touched, refs deleted
+// upstream are kept once.
+//
+// Listing origin costs a round-trip per update. Force-pushes could be told
+// from the refs after the fetch, but deletions can't: the fetches don't
+// prune, and go-git doesn't return the refs a fetch saw. The listing also
+// skips repositories that didn't change without writing any ref.
+func guardRefs(r *git.Repository, auth transport.AuthMethod, extra []config.RefSpec, date time.Time) (*refGuard, error) {
+	remote, err := r.Remote("origin")
+	if err != nil {
+		return nil, err
+	}
+	specs := append(slices.Clone(remote.Config().Fetch), extra...)
+
+	upstream := map[plumbing.ReferenceName]plumbing.Hash{}
+	list, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil, err
+	}
+	for _, ref := range list {
+		if ref.Type() == plumbing.HashReference {
+			upstream[ref.Name()] = ref.Hash()
+		}
+	}
+
+	iter, err := r.References()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []*plumbing.Reference{}
+	// kept are the upstream refs and tips already kept by previous runs
+	kept := map[string]bool{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+
+		name := ref.Name().String()
+		if !strings.HasPrefix(name, "refs/gickup/") {
+			refs = append(refs, ref)
+
+			return nil
+		}
+
+		// RewrittenPrefix<timestamp>/<ref without refs/>
+		if _, rest, ok := strings.Cut(strings.TrimPrefix(name, RewrittenPrefix), "/"); ok && strings.HasPrefix(name, RewrittenPrefix) {
+			if source, ok := upstreamName(plumbing.ReferenceName("refs/"+rest), specs); ok {
+				kept[source.String()+" "+ref.Hash().String()] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// plain clones have the same tip as a branch and as a remote branch,
+	// it is kept once under the name of the branch
+	slices.SortFunc(refs, func(a, b *plumbing.Reference) int {
+		return strings.Compare(a.Name().String(), b.Name().String())
+	})
+	guarded := map[string]bool{}
+
+	guard := &refGuard{repo: r}
+	for _, ref := range refs {
+		source, ok := upstreamName(ref.Name(), specs)
+		if !ok {
+			continue
+		}
+
+		key := source.String() + " " + ref.Hash().String()
+		rw := RewrittenRef{Name: ref.Name(), Previous: ref.Hash()}
+		hash, ok := upstream[source]
+		switch {
+		case hash == ref.Hash() || guarded[key]:
+			continue
+		case !ok && kept[key]:
+			// the deletion was reported by a previous run
+			continue
+		case !ok:
+			rw.Change = Deleted
+		}
+
+		rw.Kept = keptName(ref.Name(), date)
+		if err := r.Storer.SetReference(plumbing.NewHashReference(rw.Kept, ref.Hash())); err != nil {
+			// don't leave the refs kept so far behind, nothing was fetched yet
+			guard.release()
+
+			return nil, err
+		}
+
+		guard.refs = append(guard.refs, rw)
+		guarded[key] = true
+	}
+
+	return guard, nil
+}
+
+// keptName returns the ref below RewrittenPrefix that keeps the previous tip
+// of name.
+func keptName(name plumbing.ReferenceName, date time.Time) plumbing.ReferenceName {
+	return plumbing.ReferenceName(fmt.Sprintf("%s%d/%s", RewrittenPrefix, date.Unix(), strings.TrimPrefix(name.String(), "refs/")))
+}
+
+// guardPush keeps the tips of the refs of the destination remote a forced
+// push of refspecs would overwrite below RewrittenPrefix on the destination,
+// like guardRefs does for fetches. The tips are fetched first to tell
+// fast-forwards apart, only the refs whose history the push rewrites are kept
+// and returned. Nothing must be force-pushed if it fails.
+func guardPush(r *git.Repository, remote *git.Remote, auth transport.AuthMethod, refspecs []config.RefSpec, date time.Time) ([]RewrittenRef, error) {
+	list, err := remote.List(&git.ListOptions{Auth: auth})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[plumbing.ReferenceName]plumbing.Hash{}
+	for _, ref := range list {
+		if ref.Type() == plumbing.HashReference {
+			current[ref.Name()] = ref.Hash()
+		}
+	}
+
+	guard := &refGuard{repo: r}
+	tips := map[plumbing.ReferenceName]plumbing.Hash{}
+	fetch := []config.RefSpec{}
+	for _, spec := range refspecs {
+		name := spec.Dst("")
+		previous, ok := current[name]
+		if !ok {
+			continue
+		}
+
+		ref, err := r.Reference(plumbing.ReferenceName(spec.Src()), true)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Hash() == previous {
+			continue
+		}
+
+		rw := RewrittenRef{Name: name, Change: ForcePushed, Previous: previous, Kept: keptName(name, date)}
+		guard.refs = append(guard.refs, rw)
+		tips[name] = ref.Hash()
+		fetch = append(fetch, config.RefSpec(fmt.Sprintf("+%s:%s", name, rw.Kept)))
+	}
+	if len(fetch) == 0 {
+		return nil, nil
+	}
+
+	err = remote.Fetch(&git.FetchOptions{Auth: auth, RefSpecs: fetch})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		guard.release()
+
+		return nil, err
+	}
+	// the kept refs only exist on the destination
+	defer guard.release()
+
+	rewritten := []RewrittenRef{}
+	push := []config.RefSpec{}
+	for _, rw := range guard.refs {
+		if guard.contains(tips[rw.Name], rw.Previous) {
+			continue
+		}
+
+		rewritten = append(rewritten, rw)
+		push = append(push, config.RefSpec(fmt.Sprintf("%s:%s", rw.Kept, rw.Kept)))
+	}
+	if len(push) == 0 {
+		return nil, nil
+	}
+
+	err = r.Push(&git.PushOptions{Auth: auth, RemoteName: remote.Config().Name, RefSpecs: push})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("keeping the rewritten refs: %w", err)
+	}
+
+	return rewritten, nil
+}
+
+// upstreamName returns the upstream branch or tag a fetch with specs writes
+// to the local ref name.
+func upstreamName(name plumbing.ReferenceName, specs []config.RefSpec) (plumbing.ReferenceName, bool) {
+	for _, spec := range specs {
+		reverse := config.RefSpec(strings.TrimPrefix(spec.String(), "+")).Reverse()
+		if !reverse.Match(name) {
+			continue
+		}
+
+		source := reverse.Dst(name)
+		if source.IsBranch() || source.IsTag() {
+			return source, true
+		}
+	}
+
+	return "", false
+}
+
+// rewritten returns the guarded refs that were deleted upstream or whose
+// history the fetch rewrote, their previous tips stay kept. The others are
+// released.
+func (g *refGuard) rewritten() []RewrittenRef {
+	rewritten := []RewrittenRef{}
+	for _, rw := range g.refs {
+		ref, err := g.repo.Reference(rw.Name, false)
+		switch {
+		case rw.Change == Deleted:
+			// deleted upstream, the fetch may or may not have pruned it
+		case errors.Is(err, plumbing.ErrReferenceNotFound):
+			rw.Change = Deleted
+		case err != nil:
+			// keep the tip, it can't be told what happened to the ref
+			rw.Change = ForcePushed
+		case ref.Hash() == rw.Previous || g.contains(ref.Hash(), rw.Previous):
+			_ = g.repo.Storer.RemoveReference(rw.Kept)
+
+			continue
+		default:
+			rw.Change = ForcePushed
+		}
+
+		rewritten = append(rewritten, rw)
+	}
+
+	return rewritten
+}
+
+// release removes all kept tips.
+func (g *refGuard) release() {
+	for _, rw := range g.refs {
+		_ = g.repo.Storer.RemoveReference(rw.Kept)
+	}
+}
+
+// contains reports whether previous is in the history of tip, that is whether
+// moving a ref from previous to tip was a fast-forward.
+func (g *refGuard) contains(tip, previous plumbing.Hash) bool {
+	newCommit, err := g.commit(tip)
+	if err != nil {
+		return false
+	}
+
+	oldCommit, err := g.commit(previous)
+	if err != nil {
+		return false
+	}
+
+	ok, err := oldCommit.IsAncestor(newCommit)
+
+	return err == nil && ok
+}
+
+// commit returns the commit at hash, peeling annotated tags.
+func (g *refGuard) commit(hash plumbing.Hash) (*object.Commit, error) {
+	commit, err := g.repo.CommitObject(hash)
+	if err == nil {
+		return commit, nil
+	}
+
+	tag, tagErr := g.repo.TagObject(hash)
+	if tagErr != nil {
+		return nil, err
+	}
+
+	return tag.Commit()
+}
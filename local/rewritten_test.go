@@ -0,0 +1,217 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func commit(t *testing.T, r *git.Repository, message string) plumbing.Hash {
+	t.Helper()
+
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(w.Filesystem.Root(), "file"), []byte(message), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := w.Commit(message, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func TestKeepRewrittenRefs(t *testing.T) {
+	t.Parallel()
+
+	for _, bare := range []bool{true, false} {
+		t.Run(map[bool]string{true: "bare", false: "plain"}[bare], func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			upstream, err := git.PlainInit(filepath.Join(dir, "upstream"), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := commit(t, upstream, "first")
+			commit(t, upstream, "second")
+			if err := upstream.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", first)); err != nil {
+				t.Fatal(err)
+			}
+
+			repo := types.Repo{Name: "website", URL: filepath.Join(dir, "upstream")}
+			l := types.Local{Path: filepath.Join(dir, "backup"), Bare: bare}
+			if err := cloneRepository(context.Background(), repo, nil, false, l); err != nil {
+				t.Fatal(err)
+			}
+
+			update := func() []RewrittenRef {
+				t.Helper()
+
+				reported := []RewrittenRef{}
+				err := updateRepository(context.Background(), repo, nil, false, l, func(rw RewrittenRef) { reported = append(reported, rw) })
+				if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+					t.Fatal(err)
+				}
+
+				return reported
+			}
+
+			// a fast-forward keeps nothing
+			third := commit(t, upstream, "third")
+			if reported := update(); len(reported) != 0 {
+				t.Fatalf("fast-forward reported %+v", reported)
+			}
+
+			// force-push master onto first and delete feature
+			w, err := upstream.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Reset(&git.ResetOptions{Commit: first, Mode: git.HardReset}); err != nil {
+				t.Fatal(err)
+			}
+			rewrite := commit(t, upstream, "rewrite")
+			if err := upstream.Storer.RemoveReference("refs/heads/feature"); err != nil {
+				t.Fatal(err)
+			}
+
+			reported := update()
+			changes := map[plumbing.ReferenceName]RewrittenRef{}
+			for _, rw := range reported {
+				changes[rw.Name] = rw
+			}
+			if len(reported) != 2 || changes["refs/heads/master"].Change != ForcePushed || changes["refs/heads/feature"].Change != Deleted {
+				t.Fatalf("expected master to be force-pushed and feature deleted, got %+v", reported)
+			}
+
+			backup, err := git.PlainOpen(filepath.Join(l.Path, repo.Name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range map[plumbing.ReferenceName]plumbing.Hash{"refs/heads/master": third, "refs/heads/feature": first} {
+				kept := changes[name].Kept
+				if !strings.HasPrefix(kept.String(), RewrittenPrefix) || !strings.HasSuffix(kept.String(), "/"+strings.TrimPrefix(name.String(), "refs/")) {
+					t.Errorf("%s is kept as %s", name, kept)
+				}
+
+				ref, err := backup.Reference(kept, false)
+				if err != nil || ref.Hash() != want {
+					t.Errorf("%s keeps %v, %v, want %s", kept, ref, err, want)
+				}
+			}
+
+			master, err := backup.Reference("refs/heads/master", false)
+			if err != nil || master.Hash() != rewrite {
+				t.Fatalf("master is %v, %v, want the rewritten history %s", master, err, rewrite)
+			}
+
+			if !bare {
+				data, err := os.ReadFile(filepath.Join(l.Path, repo.Name, "file"))
+				if err != nil || string(data) != "rewrite" {
+					t.Errorf("the worktree wasn't reset: %q, %v", data, err)
+				}
+			}
+
+			// the changes are reported once
+			if reported := update(); len(reported) != 0 {
+				t.Errorf("expected no changes, got %+v", reported)
+			}
+		})
+	}
+}
+
+func TestKeepForcePushedRefsOnDestination(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	upstream, err := git.PlainInit(filepath.Join(dir, "upstream"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := commit(t, upstream, "first")
+	second := commit(t, upstream, "second")
+	if err := upstream.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", first)); err != nil {
+		t.Fatal(err)
+	}
+
+	destination := filepath.Join(dir, "destination")
+	if _, err := git.PlainInit(destination, true); err != nil {
+		t.Fatal(err)
+	}
+
+	push := func() []RewrittenRef {
+		t.Helper()
+
+		temp, err := TempClone(context.Background(), types.Repo{Name: "website", URL: filepath.Join(dir, "upstream")}, t.TempDir())
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			t.Fatal(err)
+		}
+
+		reported := []RewrittenRef{}
+		err = CreateRemotePush(context.Background(), temp, types.GenRepo{Force: true}, destination, false, func(rw RewrittenRef) { reported = append(reported, rw) })
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			t.Fatal(err)
+		}
+
+		return reported
+	}
+
+	if reported := push(); len(reported) != 0 {
+		t.Fatalf("the first push reported %+v", reported)
+	}
+
+	// a fast-forward keeps nothing
+	commit(t, upstream, "third")
+	if err := upstream.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", second)); err != nil {
+		t.Fatal(err)
+	}
+	if reported := push(); len(reported) != 0 {
+		t.Fatalf("fast-forward reported %+v", reported)
+	}
+
+	// force-push feature onto first
+	if err := upstream.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature", first)); err != nil {
+		t.Fatal(err)
+	}
+
+	reported := push()
+	if len(reported) != 1 || reported[0].Name != "refs/heads/feature" || reported[0].Change != ForcePushed || reported[0].Previous != second {
+		t.Fatalf("expected feature to be force-pushed, got %+v", reported)
+	}
+
+	backup, err := git.PlainOpen(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept, err := backup.Reference(reported[0].Kept, false)
+	if err != nil || kept.Hash() != second || !strings.HasPrefix(kept.Name().String(), RewrittenPrefix) {
+		t.Errorf("%s keeps %v, %v, want %s", reported[0].Kept, kept, err, second)
+	}
+
+	feature, err := backup.Reference("refs/heads/feature", false)
+	if err != nil || feature.Hash() != first {
+		t.Errorf("feature is %v, %v, want the rewritten history %s", feature, err, first)
+	}
+}
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// FormatConsole is the human readable output, colored on stderr.
+	FormatConsole = "console"
+	// FormatJSON writes one JSON object per line.
+	FormatJSON = "json"
+	// FormatLogfmt writes one line of key=value pairs per event.
+	FormatLogfmt = "logfmt"
+)
+
+// colorRx matches the ANSI color codes of types.Red, types.Green and
+// types.Blue, raw as well as escaped inside of a JSON string.
+var colorRx = regexp.MustCompile(`(\x1b|\\u001b)\[[0-9;]*m`)
+
+// stripColors removes color markup before writing to the underlying writer.
+type stripColors struct {
+	out io.Writer
+}
+
+func (w stripColors) Write(p []byte) (int, error) {
+	if _, err := w.out.Write(colorRx.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// logfmtWriter converts the JSON events of zerolog to logfmt.
+type logfmtWriter struct {
+	out io.Writer
+}
+
+func (w logfmtWriter) Write(p []byte) (int, error) {
+	fields, err := decodeOrdered(p)
+	if err != nil {
+		// not an event of ours, pass it on untouched
+		if _, err := w.out.Write(p); err != nil {
+			return 0, err
+		}
+
+		return len(p), nil
+	}
+
+	first := []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, zerolog.MessageFieldName}
+	line := []string{}
+
+	for _, key := range first {
+		for _, field := range fields {
+			if field.key != key {
+				continue
+			}
+
+			name := key
+			if key == zerolog.MessageFieldName {
+				// logfmt consumers expect msg
+				name = "msg"
+			}
+			line = append(line, name+"="+logfmtValue(field.value))
+		}
+	}
+
+	for _, field := range fields {
+		if field.key != first[0] && field.key != first[1] && field.key != first[2] {
+			line = append(line, field.key+"="+logfmtValue(field.value))
+		}
+	}
+
+	if _, err := io.WriteString(w.out, strings.Join(line, " ")+"\n"); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+type field struct {
+	key   string
+	value json.RawMessage
+}
+
+// decodeOrdered decodes a JSON object keeping the order of its keys.
+func decodeOrdered(p []byte) ([]field, error) {
+	dec := json.NewDecoder(bytes.NewReader(p))
+
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	fields := []field{}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field{key: token.(string), value: value})
+	}
+
+	return fields, nil
+}
+
+func logfmtValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		// numbers, booleans, null, objects and arrays are kept as JSON
+		s = string(raw)
+	}
+
+	s = colorRx.ReplaceAllString(s, "")
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\r\n\\") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// newFormatWriter returns a writer that renders the events in format.
+// Colors are only kept for console output if color is set.
+func newFormatWriter(out io.Writer, format, timeformat string, color bool) io.Writer {
+	switch format {
+	case FormatJSON:
+		return stripColors{out: out}
+	case FormatLogfmt:
+		return logfmtWriter{out: out}
+	default:
+		if !color {
+			out = stripColors{out: out}
+		}
+
+		return zerolog.ConsoleWriter{Out: out, TimeFormat: timeformat, NoColor: !color}
+	}
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+	"github.com/rs/zerolog"
+)
+
+func TestLogfmtWriter(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(logfmtWriter{out: buf})
+
+	logger.Info().
+		Str("stage", "backup").
+		Str("path", "/tmp/some dir").
+		Int("count", 3).
+		Msg("cloning " + types.Green("repo"))
+
+	want := `level=info msg="cloning repo" stage=backup path="/tmp/some dir" count=3` + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatWriterStripsColors(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{FormatJSON, FormatConsole} {
+		buf := &bytes.Buffer{}
+		logger := zerolog.New(newFormatWriter(buf, format, "", false))
+
+		logger.Info().Msg("\x1b[31mred\x1b[0m")
+
+		if strings.Contains(buf.String(), "\x1b") || strings.Contains(buf.String(), "u001b") {
+			t.Fatalf("%s output still contains color codes: %q", format, buf.String())
+		}
+		if !strings.Contains(buf.String(), "red") {
+			t.Fatalf("%s output lost the message: %q", format, buf.String())
+		}
+	}
+}
+
+//nolint:paralleltest // CreateLogger sets the global log level.
+func TestCreateLoggerFileLevelAndFormat(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	dir := t.TempDir()
+	logger := CreateLogger(types.Logging{
+		Level: "error",
+		FileLogging: types.FileLogging{
+			Dir:    dir,
+			File:   "gickup.log",
+			Format: "json",
+			Level:  "debug",
+		},
+	}, false)
+
+	if zerolog.GlobalLevel() != zerolog.DebugLevel {
+		t.Fatalf("expected global level debug, got %s", zerolog.GlobalLevel())
+	}
+
+	logger.Debug().Msg("debug message")
+
+	data, err := os.ReadFile(filepath.Join(dir, "gickup.log"))
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+
+	if !strings.HasPrefix(string(data), `{"level":"debug"`) || !strings.Contains(string(data), `"message":"debug message"`) {
+		t.Fatalf("expected a json debug line, got %q", data)
+	}
+}
+
+//nolint:paralleltest // CreateLogger sets the global log level.
+func TestCreateLoggerSilentKeepsFile(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	dir := t.TempDir()
+	logger := CreateLogger(types.Logging{
+		Level: "warn",
+		FileLogging: types.FileLogging{
+			Dir:  dir,
+			File: "gickup.log",
+		},
+	}, true)
+
+	if zerolog.GlobalLevel() != zerolog.WarnLevel {
+		t.Fatalf("expected global level warn, got %s", zerolog.GlobalLevel())
+	}
+
+	logger.Warn().Msg("warn message")
+
+	data, err := os.ReadFile(filepath.Join(dir, "gickup.log"))
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+
+	if !strings.Contains(string(data), "warn message") {
+		t.Fatalf("silent muted the log file: %q", data)
+	}
+}
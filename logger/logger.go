@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"strings"
 	"sync/atomic"
 
 	"github.com/cooperspencer/gickup/types"
@@ -14,6 +15,9 @@ import (
 
 var exitcode int32
 
+// errorcount counts the errors logged since startup.
+var errorcount int64
+
 // NewRollingFile TODO.
 func NewRollingFile(config types.FileLogging) io.Writer {
 	if config.Dir != "" {
@@ -35,24 +39,91 @@ func NewRollingFile(config types.FileLogging) io.Writer {
 	}
 }
 
-// CreateLogger create an instance of Logger.
-func CreateLogger(conf types.Logging) zerolog.Logger {
+// CreateLogger create an instance of Logger. stderr and the log file each get
+// their own format and level, the global level is set to the lowest of both.
+// silent mutes stderr, the log file keeps its level.
+func CreateLogger(conf types.Logging, silent bool) zerolog.Logger {
 	var writers []io.Writer
 
-	writers = append(writers, zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: conf.Timeformat})
+	invalid := []string{}
+
+	level := parseLevel(conf.Level, zerolog.InfoLevel, &invalid)
+	stderrLevel := level
+	if silent {
+		stderrLevel = zerolog.Disabled
+	}
+
+	stderrFormat := parseFormat(conf.Format, &invalid)
+	writers = append(writers, &zerolog.FilteredLevelWriter{
+		Writer: zerolog.LevelWriterAdapter{Writer: newFormatWriter(os.Stderr, stderrFormat, conf.Timeformat, true)},
+		Level:  stderrLevel,
+	})
+
+	minLevel := stderrLevel
 
 	if conf.FileLogging.File != "" {
-		writers = append(writers, NewRollingFile(conf.FileLogging))
+		if file := NewRollingFile(conf.FileLogging); file != nil {
+			fileLevel := parseLevel(conf.FileLogging.Level, level, &invalid)
+			fileFormat := parseFormat(conf.FileLogging.Format, &invalid)
+			writers = append(writers, &zerolog.FilteredLevelWriter{
+				Writer: zerolog.LevelWriterAdapter{Writer: newFormatWriter(file, fileFormat, conf.Timeformat, false)},
+				Level:  fileLevel,
+			})
+
+			if fileLevel < minLevel {
+				minLevel = fileLevel
+			}
+		}
 	}
 
-	mw := io.MultiWriter(writers...)
+	zerolog.SetGlobalLevel(minLevel)
+
+	mw := zerolog.MultiLevelWriter(writers...)
 
 	logger := zerolog.New(mw).With().Timestamp().Logger()
 
+	for _, value := range invalid {
+		logger.Warn().
+			Str("stage", "logger").
+			Msgf("%s is neither a valid log level nor format, using the default", value)
+	}
+
 	// Attach the error hook to the main logger
 	return logger.Hook(&ErrorHook{})
 }
 
+// parseLevel parses a zerolog level name, empty values fall back to def.
+func parseLevel(level string, def zerolog.Level, invalid *[]string) zerolog.Level {
+	if level == "" {
+		return def
+	}
+
+	parsed, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || parsed == zerolog.NoLevel {
+		*invalid = append(*invalid, level)
+
+		return def
+	}
+
+	return parsed
+}
+
+// parseFormat validates an output format, empty values mean console.
+func parseFormat(format string, invalid *[]string) string {
+	switch strings.ToLower(format) {
+	case "", FormatConsole:
+		return FormatConsole
+	case FormatJSON:
+		return FormatJSON
+	case FormatLogfmt:
+		return FormatLogfmt
+	}
+
+	*invalid = append(*invalid, format)
+
+	return FormatConsole
+}
+
 // CreateSubLogger create a sublogger for modules
 func CreateSubLogger(args ...string) zerolog.Logger {
 	sub := log.With()
@@ -75,8 +146,15 @@ func GetExitCode() int32 {
 	return exitcode
 }
 
+// ErrorCount returns the count of errors logged since startup, the errors of
+// a run are the difference between its start and end.
+func ErrorCount() int64 {
+	return atomic.LoadInt64(&errorcount)
+}
+
 func (h *ErrorHook) Run(_ *zerolog.Event, level zerolog.Level, _ string) {
 	if level == zerolog.ErrorLevel {
 		atomic.StoreInt32(&exitcode, 1)
+		atomic.AddInt64(&errorcount, 1)
 	}
 }
@@ -34,8 +34,14 @@ func TestErrorHookSetsExitCode(t *testing.T) {
 		t.Fatalf("GetExitCode() after info = %d, want 0", got)
 	}
 
+	before := ErrorCount()
+
 	hook.Run(nil, zerolog.ErrorLevel, "error")
 	if got := GetExitCode(); got != 1 {
 		t.Fatalf("GetExitCode() after error = %d, want 1", got)
 	}
+
+	if got := ErrorCount() - before; got != 1 {
+		t.Fatalf("ErrorCount() grew by %d, want 1", got)
+	}
 }
@@ -1,36 +1,46 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/cooperspencer/gickup/azureblob"
 	"github.com/cooperspencer/gickup/bitbucket"
+	"github.com/cooperspencer/gickup/config"
 	"github.com/cooperspencer/gickup/gitea"
 	"github.com/cooperspencer/gickup/github"
 	"github.com/cooperspencer/gickup/gitlab"
 	"github.com/cooperspencer/gickup/gogs"
 	"github.com/cooperspencer/gickup/local"
 	"github.com/cooperspencer/gickup/logger"
-	"github.com/cooperspencer/gickup/metrics/apprise"
-	"github.com/cooperspencer/gickup/metrics/gotify"
 	"github.com/cooperspencer/gickup/metrics/heartbeat"
-	"github.com/cooperspencer/gickup/metrics/ntfy"
+	"github.com/cooperspencer/gickup/metrics/notify"
 	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
 	"github.com/cooperspencer/gickup/onedev"
 	"github.com/cooperspencer/gickup/radicle"
+	"github.com/cooperspencer/gickup/releases"
 	"github.com/cooperspencer/gickup/s3"
 	"github.com/cooperspencer/gickup/sourcehut"
+	"github.com/cooperspencer/gickup/state"
+	"github.com/cooperspencer/gickup/tracking"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/cooperspencer/gickup/webdav"
 	"github.com/cooperspencer/gickup/whatever"
@@ -43,6 +53,8 @@ import (
 	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var cli struct {
@@ -56,27 +68,34 @@ var cli struct {
 
 var version = "unknown"
 
+var pushConfigsInherited sync.Once
+
+var errBackupFailed = errors.New("backup failed")
+
 func readConfigFile(configfile string) []*types.Conf {
 	conf := []*types.Conf{}
-	cfgdata, err := os.Open(filepath.Clean(configfile))
+	cfgdata, err := os.ReadFile(filepath.Clean(configfile))
 	if err != nil {
 		log.Fatal().
 			Str("stage", "readconfig").
 			Str("file", configfile).
 			Msgf("Cannot open config file from %s", types.Red(configfile))
 	}
-	defer cfgdata.Close()
 
-	dec := yaml.NewDecoder(cfgdata)
+	file, err := config.ParseFile(configfile, cfgdata)
+	if err != nil {
+		log.Fatal().
+			Str("stage", "readconfig").
+			Str("file", configfile).
+			Msg(err.Error())
+	}
 
 	i := 0
-	for {
+	for _, doc := range file.Docs {
 		var c types.Conf
 
-		err = dec.Decode(&c)
-		if errors.Is(err, io.EOF) {
-			break
-		} else if err != nil {
+		err = config.Redact(yaml.NodeToValue(doc, &c), file.Sensitive)
+		if err != nil {
 			if len(conf) > 0 {
 				log.Fatal().
 					Str("stage", "readconfig").
@@ -95,10 +114,31 @@ func readConfigFile(configfile string) []*types.Conf {
 		}
 
 		expandConfigPaths(&c)
+		c.Source.SetScopes()
+
+		if err := c.Source.CompileFilters(); err != nil {
+			log.Fatal().
+				Str("stage", "readconfig").
+				Str("file", configfile).
+				Msg(err.Error())
+		}
+
+		if err := c.Destination.CheckUpstream(); err != nil {
+			log.Fatal().
+				Str("stage", "readconfig").
+				Str("file", configfile).
+				Msg(err.Error())
+		}
 
 		if !reflect.ValueOf(c).IsZero() {
-			if len(conf) > 0 {
-				if len(c.Metrics.PushConfigs.Gotify) == 0 && len(c.Metrics.PushConfigs.Ntfy) == 0 && len(c.Metrics.PushConfigs.Apprise) == 0 {
+			if len(conf) > 0 && !file.Defaults {
+				if !hasPushConfigs(c.Metrics.PushConfigs) && hasPushConfigs(conf[0].Metrics.PushConfigs) {
+					pushConfigsInherited.Do(func() {
+						log.Warn().
+							Str("stage", "readconfig").
+							Str("file", configfile).
+							Msg("inheriting the push configs of the first document is deprecated, use defaults instead")
+					})
 					c.Metrics.PushConfigs = conf[0].Metrics.PushConfigs
 				}
 			}
@@ -110,6 +150,11 @@ func readConfigFile(configfile string) []*types.Conf {
 	return conf
 }
 
+func hasPushConfigs(p types.PushConfigs) bool {
+	return len(p.Gotify) > 0 || len(p.Ntfy) > 0 || len(p.Apprise) > 0 ||
+		len(p.Webhook) > 0 || len(p.SMTP) > 0 || len(p.Slack) > 0 || len(p.Discord) > 0 || len(p.Matrix) > 0
+}
+
 func expandConfigPaths(c *types.Conf) {
 	c.Log.FileLogging.Dir = substituteHomeForTildeInPath(c.Log.FileLogging.Dir)
 
@@ -183,11 +228,64 @@ func substituteHomeForTildeInPath(path string) string {
 	return path
 }
 
-func backup(repos []types.Repo, conf *types.Conf) {
+// nameClaims are the names repositories got on destinations during a run, so
+// repositories of different sources can't overwrite each other.
+type nameClaims map[string]string
+
+// pathDestinations store repositories in directories, their names may contain
+// slashes.
+var pathDestinations = []string{"local", "s3", "azureblob", "webdav"}
+
+// claim renders the name of r on a destination and claims it for the run. It
+// fails if the name is invalid or claimed by another repository already.
+func (c nameClaims) claim(r types.Repo, tmpl string, structured bool, kind, url string) (string, error) {
+	name, err := types.RenderName(tmpl, structured, r, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(name, "/") && !slices.Contains(pathDestinations, kind) {
+		return "", fmt.Errorf("name %s of %s can't contain slashes on %s", name, r.URL, kind)
+	}
+
+	key := strings.Join([]string{kind, url, name}, " ")
+	if other, ok := c[key]; ok && other != r.URL {
+		return "", fmt.Errorf("name %s of %s collides with %s on %s %s", name, r.URL, other, kind, url)
+	}
+
+	c[key] = r.URL
+
+	return name, nil
+}
+
+// ownerURL is the URL of the owner of r on a forge destination, names only
+// collide within an owner.
+func ownerURL(d types.GenRepo, r types.Repo) string {
+	return strings.TrimSuffix(d.URL, "/") + "/" + d.TargetOwner(r.Owner)
+}
+
+func backup(ctx context.Context, repos []types.Repo, conf *types.Conf, summary *notify.Summary, names nameClaims, tracker *tracking.Tracker) {
 	checkedpath := false
 	currentDateDir := time.Now().Format("2006-01-02") + "/"
 
-	for _, r := range repos {
+	// claim claims the name of r on a destination and tracks it, so the
+	// backup can be found if r is deleted or renamed upstream
+	claim := func(r types.Repo, tmpl string, structured bool, kind, url string) (string, error) {
+		name, err := names.claim(r, tmpl, structured, kind, url)
+		if err == nil {
+			tracker.Stored(r, kind, url, name)
+		}
+
+		return name, err
+	}
+
+	for _, r := range limitSizes(repos) {
+		// repo keeps the name of the source for metrics and failures, the
+		// destinations set r.Name to the name they store the repository under
+		repo := r
+
+		ctx, span := tracing.Start(ctx, "backup", tracing.Repo(r)...)
+
 		log.Info().
 			Str("stage", "backup").
 			Msgf("starting backup for %s", r.URL)
@@ -196,7 +294,15 @@ func backup(repos []types.Repo, conf *types.Conf) {
 			log.Warn().Str("stage", "backup").Msg("No destinations configured!")
 		}
 
+		if r.PreviousName != "" {
+			migrateName(ctx, r, conf)
+		}
+
 		for _, d := range conf.Destination.Local {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
+			}
+
 			if !checkedpath {
 				_, err := filepath.Abs(d.Path)
 				if err != nil {
@@ -211,337 +317,847 @@ func backup(repos []types.Repo, conf *types.Conf) {
 
 			repotime := time.Now()
 			status := 0
-			if local.Locally(r, d, cli.Dry) {
-				prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "local", d.Path).Set(time.Since(repotime).Seconds())
+			ctx, span := tracing.Start(ctx, "destination local", tracing.Destination("local", d.Path)...)
+			// Locally renders the same name, it is claimed for the run here
+			if _, err := claim(r, d.NameTemplate, d.Structured, "local", d.Path); err != nil {
+				log.Error().
+					Str("stage", "locally").
+					Str("path", d.Path).
+					Msg(err.Error())
+				fail(summary, repo, "local", d.Path, prometheus.StageName, err)
+			} else if err := local.Locally(ctx, r, d, cli.Dry, rewritten(summary, repo, "local", d.Path)); err == nil {
+				prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "local", d.Path).Set(time.Since(repotime).Seconds())
 				status = 1
+			} else if !cli.Dry {
+				fail(summary, repo, "local", d.Path, prometheus.StageBackup, err)
 			}
 
-			prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "local", d.Path).Set(float64(status))
+			finishDestination(summary, span, repo, "local", d.Path, repotime, status)
+
+			prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "local", d.Path).Set(float64(status))
 			prometheus.DestinationBackupsComplete.WithLabelValues("local").Inc()
 		}
 
 		for _, d := range conf.Destination.S3 {
-			repotime := time.Now()
-			status := 0
-
-			logOp := "pushing"
-			if d.Zip {
-				logOp = "zipping and pushing"
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
 			}
-			log.Info().
-				Str("stage", "s3").
-				Str("url", d.Endpoint).
-				Msgf("%s %s to %s", logOp, types.Blue(r.Name), d.Bucket)
 
-			if !cli.Dry {
-				tempname := fmt.Sprintf("s3-%x", repotime)
-				tempdir, err := os.MkdirTemp(os.TempDir(), tempname)
+			func(r types.Repo) {
+				repotime := time.Now()
+				status := 0
+				ctx, span := tracing.Start(ctx, "destination s3", tracing.Destination("s3", d.Endpoint)...)
+				defer func() { finishDestination(summary, span, repo, "s3", d.Endpoint, repotime, status) }()
+
+				name, err := claim(r, d.NameTemplate, d.Structured, "s3", d.Endpoint)
 				if err != nil {
 					log.Error().
-						Str("stage", "tempclone").
-						Str("url", r.URL).
+						Str("stage", "s3").
+						Str("url", d.Endpoint).
 						Msg(err.Error())
-					continue
-				}
-
-				if d.Structured {
-					r.Name = path.Join(r.Hoster, r.Owner, r.Name)
+					fail(summary, repo, "s3", d.Endpoint, prometheus.StageName, err)
+					return
 				}
+				r.Name = name
 
-				if d.DateCreateDir {
-					r.Name = currentDateDir + r.Name
+				logOp := "pushing"
+				if d.Zip {
+					logOp = "zipping and pushing"
 				}
+				log.Info().
+					Str("stage", "s3").
+					Str("url", d.Endpoint).
+					Msgf("%s %s to %s", logOp, types.Blue(r.Name), d.Bucket)
 
-				defer os.RemoveAll(tempdir)
-				tempClonePath := path.Join(tempdir, r.Name)
-				_, err = local.TempCloneBare(r, tempClonePath)
-				if err != nil {
-					switch {
-					case errors.Is(err, git.NoErrAlreadyUpToDate):
-						log.Info().
-							Str("stage", "s3").
-							Str("url", r.URL).
-							Msg(err.Error())
-					case errors.Is(err, transport.ErrEmptyRemoteRepository):
-						log.Warn().
-							Str("repo", r.Name).
-							Msgf("%s - Skipping backup", err.Error())
-						continue
-					default:
+				if !cli.Dry {
+					tempname := fmt.Sprintf("s3-%x", repotime)
+					tempdir, err := os.MkdirTemp(os.TempDir(), tempname)
+					if err != nil {
 						log.Error().
 							Str("stage", "tempclone").
 							Str("url", r.URL).
-							Str("git", "clone").
 							Msg(err.Error())
-						os.RemoveAll(tempdir)
-						continue
+						fail(summary, repo, "s3", d.Endpoint, prometheus.StageTempdir, err)
+						return
 					}
-				}
 
-				if d.UseStaticCreds {
-					// Check if environment variables are used for accesskey and secretkey
-					d.AccessKey, err = d.GetKey(d.AccessKey)
-					if err != nil {
-						log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
+					if d.DateCreateDir {
+						r.Name = currentDateDir + r.Name
 					}
-					d.SecretKey, err = d.GetKey(d.SecretKey)
+
+					defer os.RemoveAll(tempdir)
+					tempClonePath := path.Join(tempdir, r.Name)
+					_, err = local.TempCloneBare(ctx, r, tempClonePath)
 					if err != nil {
-						log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
+						switch {
+						case errors.Is(err, git.NoErrAlreadyUpToDate):
+							log.Info().
+								Str("stage", "s3").
+								Str("url", r.URL).
+								Msg(err.Error())
+						case errors.Is(err, transport.ErrEmptyRemoteRepository):
+							log.Warn().
+								Str("repo", r.Name).
+								Msgf("%s - Skipping backup", err.Error())
+							return
+						default:
+							log.Error().
+								Str("stage", "tempclone").
+								Str("url", r.URL).
+								Str("git", "clone").
+								Msg(err.Error())
+							os.RemoveAll(tempdir)
+							fail(summary, repo, "s3", d.Endpoint, prometheus.StageClone, err)
+							return
+						}
 					}
-					if d.Token != "" {
-						d.Token, err = d.GetKey(d.Token)
+
+					if d.UseStaticCreds {
+						// Check if environment variables are used for accesskey and secretkey
+						d.AccessKey, err = d.GetKey(d.AccessKey)
+						if err != nil {
+							log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
+						}
+						d.SecretKey, err = d.GetKey(d.SecretKey)
 						if err != nil {
 							log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
 						}
+						if d.Token != "" {
+							d.Token, err = d.GetKey(d.Token)
+							if err != nil {
+								log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
+							}
+						}
 					}
-				}
 
-				if d.Zip {
-					log.Info().
-						Msgf("zipping %s", types.Green(r.Name))
-					err := zip.Zip(tempClonePath, []string{tempClonePath})
-					if err != nil {
+					if err := local.WriteMetadata(tempdir, r); err != nil {
 						log.Error().
-							Str("stage", "zip").
-							Str("url", r.URL).
+							Str("stage", "s3").
 							Str("repo", r.Name).
 							Msg(err.Error())
-						log.Error().Msgf("Skipping backup of %s due to error while zipping", r.Name)
-						continue
 					}
-				}
-				s3opts := &minio.PutObjectOptions{
-					StorageClass: d.StorageClass,
-				}
-				if d.SrcRepoUrlTagKey != nil {
-					s3opts.UserTags = map[string]string{
-						*d.SrcRepoUrlTagKey: r.URL,
+
+					storeReleases(ctx, tempdir, r, "s3", d.Endpoint)
+
+					if r.Export != nil {
+						if err := local.WriteExport(ctx, tempdir, r); err != nil {
+							log.Error().
+								Str("stage", "s3").
+								Str("repo", r.Name).
+								Msg(err.Error())
+							fail(summary, repo, "s3", d.Endpoint, prometheus.StageExport, err)
+							return
+						}
 					}
-				}
-				err = s3.UploadDirToS3(tempdir, d, s3opts)
-				if err != nil {
-					log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
-				}
-				err = s3.DeleteObjectsNotInRepo(tempdir, r.Name, d)
-				if err != nil {
-					log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
-				}
-				prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "s3", d.Endpoint).Set(time.Since(repotime).Seconds())
-				status = 1
 
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "s3", d.Endpoint).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("s3").Inc()
-			}
+					if d.Zip {
+						log.Info().
+							Msgf("zipping %s", types.Green(r.Name))
+						err := zip.Zip(tempClonePath, []string{tempClonePath})
+						if err != nil {
+							log.Error().
+								Str("stage", "zip").
+								Str("url", r.URL).
+								Str("repo", r.Name).
+								Msg(err.Error())
+							log.Error().Msgf("Skipping backup of %s due to error while zipping", r.Name)
+							fail(summary, repo, "s3", d.Endpoint, prometheus.StageZip, err)
+							return
+						}
+					}
+					s3opts := &minio.PutObjectOptions{
+						StorageClass: d.StorageClass,
+					}
+					if d.SrcRepoUrlTagKey != nil {
+						s3opts.UserTags = map[string]string{
+							*d.SrcRepoUrlTagKey: r.URL,
+						}
+					}
+					size := dirSize(tempdir)
+					span.SetAttributes(tracing.Bytes(size))
+					err = s3.UploadDirToS3(tempdir, d, s3opts)
+					if err != nil {
+						log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
+						fail(summary, repo, "s3", d.Endpoint, prometheus.StageUpload, err)
+						// don't delete what the failed upload didn't replace
+						return
+					}
+					prometheus.Bytes(repo, "s3", d.Endpoint, size)
+					err = s3.DeleteObjectsNotInRepo(tempdir, r.Name, d)
+					if err != nil {
+						log.Error().Str("stage", "s3").Str("endpoint", d.Endpoint).Str("bucket", d.Bucket).Msg(err.Error())
+					}
+					prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "s3", d.Endpoint).Set(time.Since(repotime).Seconds())
+					status = 1
+
+					prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "s3", d.Endpoint).Set(float64(status))
+					prometheus.DestinationBackupsComplete.WithLabelValues("s3").Inc()
+				}
+			}(r)
 		}
 
 		for _, d := range conf.Destination.AzureBlob {
-			repotime := time.Now()
-			status := 0
-
-			azureblobclient, err := azureblob.NewAzureBlobClient(d)
-			if err != nil {
-				log.Error().
-					Str("stage", "init").
-					Msg(err.Error())
+			if !r.RoutedTo(d.Name, d.Routes) {
 				continue
 			}
 
-			logOp := "uploading"
-			if d.Zip {
-				logOp = "zipping and uploading"
-			}
-			log.Info().
-				Str("stage", "azureblob").
-				Msgf("%s %s to blob container %s", logOp, types.Blue(r.Name), d.Container)
+			func(r types.Repo) {
+				repotime := time.Now()
+				status := 0
+				ctx, span := tracing.Start(ctx, "destination azureblob", tracing.Destination("azureblob", d.Container)...)
+				defer func() { finishDestination(summary, span, repo, "azureblob", d.Container, repotime, status) }()
 
-			if !cli.Dry {
-				tempname := fmt.Sprintf("azureblob-%x", repotime)
-				tempdir, err := os.MkdirTemp(os.TempDir(), tempname)
+				name, err := claim(r, d.NameTemplate, d.Structured, "azureblob", d.Container)
 				if err != nil {
 					log.Error().
-						Str("stage", "tempclone").
+						Str("stage", "azureblob").
+						Str("url", d.Container).
 						Msg(err.Error())
-					continue
+					fail(summary, repo, "azureblob", d.Container, prometheus.StageName, err)
+					return
 				}
+				r.Name = name
 
-				if d.Structured {
-					r.Name = path.Join(r.Hoster, r.Owner, r.Name)
+				azureblobclient, err := azureblob.NewAzureBlobClient(d)
+				if err != nil {
+					log.Error().
+						Str("stage", "init").
+						Msg(err.Error())
+					fail(summary, repo, "azureblob", d.Container, prometheus.StageUpload, err)
+					return
 				}
 
-				if d.DateCreateDir {
-					r.Name = currentDateDir + r.Name
+				logOp := "uploading"
+				if d.Zip {
+					logOp = "zipping and uploading"
 				}
+				log.Info().
+					Str("stage", "azureblob").
+					Msgf("%s %s to blob container %s", logOp, types.Blue(r.Name), d.Container)
 
-				defer os.RemoveAll(tempdir)
-				tempClonePath := path.Join(tempdir, r.Name)
-				_, err = local.TempCloneBare(r, tempClonePath)
-				if err != nil {
-					switch {
-					case errors.Is(err, git.NoErrAlreadyUpToDate):
-						log.Info().
-							Str("stage", "azureblob").
-							Msg(err.Error())
-					case errors.Is(err, transport.ErrEmptyRemoteRepository):
-						log.Warn().
-							Str("repo", r.Name).
-							Msgf("%s - Skipping backup", err.Error())
-						continue
-					default:
+				if !cli.Dry {
+					tempname := fmt.Sprintf("azureblob-%x", repotime)
+					tempdir, err := os.MkdirTemp(os.TempDir(), tempname)
+					if err != nil {
 						log.Error().
 							Str("stage", "tempclone").
-							Str("git", "clone").
 							Msg(err.Error())
-						os.RemoveAll(tempdir)
-						continue
+						fail(summary, repo, "azureblob", d.Container, prometheus.StageTempdir, err)
+						return
 					}
-				}
 
-				if d.Zip {
-					log.Info().
-						Msgf("zipping %s", types.Green(r.Name))
-					err := zip.Zip(tempClonePath, []string{tempClonePath})
+					if d.DateCreateDir {
+						r.Name = currentDateDir + r.Name
+					}
+
+					defer os.RemoveAll(tempdir)
+					tempClonePath := path.Join(tempdir, r.Name)
+					_, err = local.TempCloneBare(ctx, r, tempClonePath)
 					if err != nil {
+						switch {
+						case errors.Is(err, git.NoErrAlreadyUpToDate):
+							log.Info().
+								Str("stage", "azureblob").
+								Msg(err.Error())
+						case errors.Is(err, transport.ErrEmptyRemoteRepository):
+							log.Warn().
+								Str("repo", r.Name).
+								Msgf("%s - Skipping backup", err.Error())
+							return
+						default:
+							log.Error().
+								Str("stage", "tempclone").
+								Str("git", "clone").
+								Msg(err.Error())
+							os.RemoveAll(tempdir)
+							fail(summary, repo, "azureblob", d.Container, prometheus.StageClone, err)
+							return
+						}
+					}
+
+					if err := local.WriteMetadata(tempdir, r); err != nil {
 						log.Error().
-							Str("stage", "zip").
+							Str("stage", "azureblob").
 							Str("repo", r.Name).
 							Msg(err.Error())
-						log.Error().Msgf("Skipping backup of %s due to error while zipping", r.Name)
-						continue
 					}
-				}
-				err = azureblob.UploadDirToBlobStorage(tempdir, d, azureblobclient)
-				if err != nil {
-					log.Error().Str("stage", "azureblob").Str("container", d.Container).Msg(err.Error())
-				}
-				err = azureblob.DeleteObjectsNotInRepo(tempdir, r.Name, d, azureblobclient)
-				if err != nil {
-					log.Error().Str("stage", "azureblob").Str("container", d.Container).Msg(err.Error())
-				}
-				prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "azureblob", d.Container).Set(time.Since(repotime).Seconds())
-				status = 1
 
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "azureblob", d.Container).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("azureblob").Inc()
-			}
+					storeReleases(ctx, tempdir, r, "azureblob", d.Container)
+
+					if r.Export != nil {
+						if err := local.WriteExport(ctx, tempdir, r); err != nil {
+							log.Error().
+								Str("stage", "azureblob").
+								Str("repo", r.Name).
+								Msg(err.Error())
+							fail(summary, repo, "azureblob", d.Container, prometheus.StageExport, err)
+							return
+						}
+					}
+
+					if d.Zip {
+						log.Info().
+							Msgf("zipping %s", types.Green(r.Name))
+						err := zip.Zip(tempClonePath, []string{tempClonePath})
+						if err != nil {
+							log.Error().
+								Str("stage", "zip").
+								Str("repo", r.Name).
+								Msg(err.Error())
+							log.Error().Msgf("Skipping backup of %s due to error while zipping", r.Name)
+							fail(summary, repo, "azureblob", d.Container, prometheus.StageZip, err)
+							return
+						}
+					}
+					size := dirSize(tempdir)
+					span.SetAttributes(tracing.Bytes(size))
+					err = azureblob.UploadDirToBlobStorage(tempdir, d, azureblobclient)
+					if err != nil {
+						log.Error().Str("stage", "azureblob").Str("container", d.Container).Msg(err.Error())
+						fail(summary, repo, "azureblob", d.Container, prometheus.StageUpload, err)
+						// don't delete what the failed upload didn't replace
+						return
+					}
+					prometheus.Bytes(repo, "azureblob", d.Container, size)
+					err = azureblob.DeleteObjectsNotInRepo(tempdir, r.Name, d, azureblobclient)
+					if err != nil {
+						log.Error().Str("stage", "azureblob").Str("container", d.Container).Msg(err.Error())
+					}
+					prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "azureblob", d.Container).Set(time.Since(repotime).Seconds())
+					status = 1
+
+					prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "azureblob", d.Container).Set(float64(status))
+					prometheus.DestinationBackupsComplete.WithLabelValues("azureblob").Inc()
+				}
+			}(r)
 		}
 
 		for _, d := range conf.Destination.WebDAV {
-			repotime := time.Now()
-			status := 0
-
-			logOp := "uploading"
-			if d.Zip {
-				logOp = "zipping and uploading"
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
 			}
-			log.Info().
-				Str("stage", "webdav").
-				Str("url", d.Url).
-				Msgf("%s %s to %s", logOp, types.Blue(r.Name), d.Url)
 
-			if !cli.Dry {
-				tempname := fmt.Sprintf("webdav-%x", repotime)
-				tempdir, err := os.MkdirTemp(os.TempDir(), tempname)
+			func(r types.Repo) {
+				repotime := time.Now()
+				status := 0
+				ctx, span := tracing.Start(ctx, "destination webdav", tracing.Destination("webdav", d.Url)...)
+				defer func() { finishDestination(summary, span, repo, "webdav", d.Url, repotime, status) }()
+
+				name, err := claim(r, d.NameTemplate, d.Structured, "webdav", d.Url)
 				if err != nil {
 					log.Error().
-						Str("stage", "tempclone").
-						Str("url", r.URL).
+						Str("stage", "webdav").
+						Str("url", d.Url).
 						Msg(err.Error())
-					continue
-				}
-
-				if d.Structured {
-					r.Name = path.Join(r.Hoster, r.Owner, r.Name)
+					fail(summary, repo, "webdav", d.Url, prometheus.StageName, err)
+					return
 				}
+				r.Name = name
 
-				if d.DateCreateDir {
-					r.Name = currentDateDir + r.Name
+				logOp := "uploading"
+				if d.Zip {
+					logOp = "zipping and uploading"
 				}
+				log.Info().
+					Str("stage", "webdav").
+					Str("url", d.Url).
+					Msgf("%s %s to %s", logOp, types.Blue(r.Name), d.Url)
 
-				defer os.RemoveAll(tempdir)
-				tempClonePath := path.Join(tempdir, r.Name)
-				_, err = local.TempCloneBare(r, tempClonePath)
-				if err != nil {
-					switch {
-					case errors.Is(err, git.NoErrAlreadyUpToDate):
-						log.Info().
-							Str("stage", "webdav").
-							Msg(err.Error())
-					case errors.Is(err, transport.ErrEmptyRemoteRepository):
-						log.Warn().
-							Str("repo", r.Name).
-							Msgf("%s - Skipping backup", err.Error())
-						continue
-					default:
+				if !cli.Dry {
+					tempname := fmt.Sprintf("webdav-%x", repotime)
+					tempdir, err := os.MkdirTemp(os.TempDir(), tempname)
+					if err != nil {
 						log.Error().
 							Str("stage", "tempclone").
-							Str("git", "clone").
+							Str("url", r.URL).
 							Msg(err.Error())
-						os.RemoveAll(tempdir)
-						continue
+						fail(summary, repo, "webdav", d.Url, prometheus.StageTempdir, err)
+						return
 					}
-				}
 
-				if d.Zip {
-					log.Info().
-						Msgf("zipping %s", types.Green(r.Name))
-					err := zip.Zip(tempClonePath, []string{tempClonePath})
-					if err != nil {
-						log.Error().
-							Str("stage", "zip").
-							Str("repo", r.Name).
-							Msg(err.Error())
-						log.Error().Msgf("Skipping backup of %s due to error while zipping", r.Name)
-						continue
+					if d.DateCreateDir {
+						r.Name = currentDateDir + r.Name
 					}
-				}
-				err = webdav.UploadDirToWebDAV(tempdir, d)
-				if err != nil {
-					log.Error().Str("stage", "webdav").Str("url", d.Url).Msg(err.Error())
-				}
-				err = webdav.DeleteObjectsNotInRepo(tempdir, r.Name, d)
-				if err != nil {
-					log.Error().Str("stage", "webdav").Str("url", d.Url).Msg(err.Error())
-				}
-				prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "webdav", d.Url).Set(time.Since(repotime).Seconds())
-				status = 1
-
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "webdav", d.Url).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("webdav").Inc()
-			}
-		}
+
+					defer os.RemoveAll(tempdir)
+					tempClonePath := path.Join(tempdir, r.Name)
+					_, err = local.TempCloneBare(ctx, r, tempClonePath)
+					if err != nil {
+						switch {
+						case errors.Is(err, git.NoErrAlreadyUpToDate):
+							log.Info().
+								Str("stage", "webdav").
+								Msg(err.Error())
+						case errors.Is(err, transport.ErrEmptyRemoteRepository):
+							log.Warn().
+								Str("repo", r.Name).
+								Msgf("%s - Skipping backup", err.Error())
+							return
+						default:
+							log.Error().
+								Str("stage", "tempclone").
+								Str("git", "clone").
+								Msg(err.Error())
+							os.RemoveAll(tempdir)
+							fail(summary, repo, "webdav", d.Url, prometheus.StageClone, err)
+							return
+						}
+					}
+
+					if err := local.WriteMetadata(tempdir, r); err != nil {
+						log.Error().
+							Str("stage", "webdav").
+							Str("repo", r.Name).
+							Msg(err.Error())
+					}
+
+					storeReleases(ctx, tempdir, r, "webdav", d.Url)
+
+					if r.Export != nil {
+						if err := local.WriteExport(ctx, tempdir, r); err != nil {
+							log.Error().
+								Str("stage", "webdav").
+								Str("repo", r.Name).
+								Msg(err.Error())
+							fail(summary, repo, "webdav", d.Url, prometheus.StageExport, err)
+							return
+						}
+					}
+
+					if d.Zip {
+						log.Info().
+							Msgf("zipping %s", types.Green(r.Name))
+						err := zip.Zip(tempClonePath, []string{tempClonePath})
+						if err != nil {
+							log.Error().
+								Str("stage", "zip").
+								Str("repo", r.Name).
+								Msg(err.Error())
+							log.Error().Msgf("Skipping backup of %s due to error while zipping", r.Name)
+							fail(summary, repo, "webdav", d.Url, prometheus.StageZip, err)
+							return
+						}
+					}
+					size := dirSize(tempdir)
+					span.SetAttributes(tracing.Bytes(size))
+					err = webdav.UploadDirToWebDAV(tempdir, d)
+					if err != nil {
+						log.Error().Str("stage", "webdav").Str("url", d.Url).Msg(err.Error())
+						fail(summary, repo, "webdav", d.Url, prometheus.StageUpload, err)
+						// don't delete what the failed upload didn't replace
+						return
+					}
+					prometheus.Bytes(repo, "webdav", d.Url, size)
+					err = webdav.DeleteObjectsNotInRepo(tempdir, r.Name, d)
+					if err != nil {
+						log.Error().Str("stage", "webdav").Str("url", d.Url).Msg(err.Error())
+					}
+					prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "webdav", d.Url).Set(time.Since(repotime).Seconds())
+					status = 1
+
+					prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "webdav", d.Url).Set(float64(status))
+					prometheus.DestinationBackupsComplete.WithLabelValues("webdav").Inc()
+				}
+			}(r)
+		}
 
 		for _, d := range conf.Destination.Gitea {
-			if d.MirrorInterval != "" {
-				log.Warn().
-					Str("stage", "gitea").
-					Str("url", d.URL).
-					Msg("mirrorinterval is deprecated and will be removed in one of the next releases. please move it under the mirror parameter.")
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
 			}
-			if !strings.HasSuffix(r.Name, ".wiki") {
-				repotime := time.Now()
-				status := 0
-				if d.Mirror.Enabled {
-					log.Info().
+
+			func(r types.Repo) {
+				if d.MirrorInterval != "" {
+					log.Warn().
 						Str("stage", "gitea").
 						Str("url", d.URL).
-						Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
+						Msg("mirrorinterval is deprecated and will be removed in one of the next releases. please move it under the mirror parameter.")
+				}
+				if !strings.HasSuffix(r.Name, ".wiki") {
+					repotime := time.Now()
+					status := 0
+					ctx, span := tracing.Start(ctx, "destination gitea", tracing.Destination("gitea", d.URL)...)
+					defer func() { finishDestination(summary, span, repo, "gitea", d.URL, repotime, status) }()
+
+					name, err := claim(r, d.NameTemplate, false, "gitea", ownerURL(d, r))
+					if err != nil {
+						log.Error().
+							Str("stage", "gitea").
+							Str("url", d.URL).
+							Msg(err.Error())
+						fail(summary, repo, "gitea", d.URL, prometheus.StageName, err)
+						return
+					}
+					r.Name = name
+					if !d.Mirror.Enabled {
+						skipReleases(r, "gitea", d.URL, "gitea only syncs the tags of the repositories it mirrors itself")
+					}
+					if d.Mirror.Enabled {
+						log.Info().
+							Str("stage", "gitea").
+							Str("url", d.URL).
+							Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
+
+						if !cli.Dry {
+							tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("gitea-%x", repotime))
+							if err != nil {
+								log.Error().
+									Str("stage", "tempclone").
+									Str("url", r.URL).
+									Msg(err.Error())
+								fail(summary, repo, "gitea", d.URL, prometheus.StageTempdir, err)
+								return
+							}
+
+							defer os.RemoveAll(tempdir)
+							temprepo, err := local.TempClone(ctx, r, tempdir)
+							if err != nil {
+								if errors.Is(err, git.NoErrAlreadyUpToDate) {
+									log.Info().
+										Str("stage", "gitea").
+										Str("url", r.URL).
+										Msg(err.Error())
+								} else {
+									log.Error().
+										Str("stage", "tempclone").
+										Str("url", r.URL).
+										Str("git", "clone").
+										Msg(err.Error())
+									os.RemoveAll(tempdir)
+									fail(summary, repo, "gitea", d.URL, prometheus.StageClone, err)
+									return
+								}
+							}
+
+							cloneurl, err := gitea.GetOrCreate(d, r)
+							if err != nil {
+								log.Error().
+									Str("stage", "gitea").
+									Str("url", r.URL).
+									Msg(err.Error())
+								os.RemoveAll(tempdir)
+								fail(summary, repo, "gitea", d.URL, prometheus.StageCreate, err)
+								return
+							}
+
+							err = local.CreateRemotePush(ctx, temprepo, d, cloneurl, r.Origin.LFS, rewritten(summary, repo, "gitea", d.URL))
+							if err != nil {
+								if errors.Is(err, git.NoErrAlreadyUpToDate) {
+									log.Info().
+										Str("stage", "gitea").
+										Str("url", r.URL).
+										Msg(err.Error())
+								} else {
+									log.Error().
+										Str("stage", "gitea").
+										Str("url", r.URL).
+										Str("git", "push").
+										Msg(err.Error())
+									os.RemoveAll(tempdir)
+									fail(summary, repo, "gitea", d.URL, prometheus.StagePush, err)
+									return
+								}
+							}
+
+							if len(r.Releases) > 0 {
+								if err := gitea.CreateReleases(ctx, d, r, cloneurl); err != nil {
+									log.Error().
+										Str("stage", "gitea").
+										Str("url", r.URL).
+										Msg(err.Error())
+								}
+							}
+
+							prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitea", d.URL).Set(time.Since(repotime).Seconds())
+							status = 1
+
+							prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitea", d.URL).Set(float64(status))
+						}
+					} else if err := gitea.Backup(r, d, cli.Dry); err == nil {
+						prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitea", d.URL).Set(time.Since(repotime).Seconds())
+						status = 1
+					} else if !cli.Dry {
+						fail(summary, repo, "gitea", d.URL, prometheus.StageBackup, err)
+					}
+
+					prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitea", d.URL).Set(float64(status))
+					prometheus.DestinationBackupsComplete.WithLabelValues("gitea").Inc()
+				}
+			}(r)
+		}
+
+		for _, d := range conf.Destination.Gogs {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
+			}
+
+			func(r types.Repo) {
+				if !strings.HasSuffix(r.Name, ".wiki") {
+					repotime := time.Now()
+					status := 0
+					ctx, span := tracing.Start(ctx, "destination gogs", tracing.Destination("gogs", d.URL)...)
+					defer func() { finishDestination(summary, span, repo, "gogs", d.URL, repotime, status) }()
+
+					name, err := claim(r, d.NameTemplate, false, "gogs", ownerURL(d, r))
+					if err != nil {
+						log.Error().
+							Str("stage", "gogs").
+							Str("url", d.URL).
+							Msg(err.Error())
+						fail(summary, repo, "gogs", d.URL, prometheus.StageName, err)
+						return
+					}
+					r.Name = name
+					skipReleases(r, "gogs", d.URL, "gogs has no api to create releases")
+					if d.Mirror.Enabled {
+						log.Info().
+							Str("stage", "gogs").
+							Str("url", d.URL).
+							Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
+
+						if !cli.Dry {
+							tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("gogs-%x", repotime))
+							if err != nil {
+								log.Error().
+									Str("stage", "tempclone").
+									Str("url", r.URL).
+									Msg(err.Error())
+								fail(summary, repo, "gogs", d.URL, prometheus.StageTempdir, err)
+								return
+							}
+
+							defer os.RemoveAll(tempdir)
+							temprepo, err := local.TempClone(ctx, r, tempdir)
+							if err != nil {
+								if errors.Is(err, git.NoErrAlreadyUpToDate) {
+									log.Info().
+										Str("stage", "gogs").
+										Str("url", r.URL).
+										Msg(err.Error())
+								} else {
+									log.Error().
+										Str("stage", "tempclone").
+										Str("url", r.URL).
+										Str("git", "clone").
+										Msg(err.Error())
+									os.RemoveAll(tempdir)
+									fail(summary, repo, "gogs", d.URL, prometheus.StageClone, err)
+									return
+								}
+							}
+
+							cloneurl, err := gogs.GetOrCreate(d, r)
+							if err != nil {
+								log.Error().
+									Str("stage", "gogs").
+									Str("url", r.URL).
+									Msg(err.Error())
+								os.RemoveAll(tempdir)
+								fail(summary, repo, "gogs", d.URL, prometheus.StageCreate, err)
+								return
+							}
+
+							err = local.CreateRemotePush(ctx, temprepo, d, cloneurl, r.Origin.LFS, rewritten(summary, repo, "gogs", d.URL))
+							if err != nil {
+								if errors.Is(err, git.NoErrAlreadyUpToDate) {
+									log.Info().
+										Str("stage", "gogs").
+										Str("url", r.URL).
+										Msg(err.Error())
+								} else {
+									log.Error().
+										Str("stage", "gogs").
+										Str("url", r.URL).
+										Str("git", "push").
+										Msg(err.Error())
+									os.RemoveAll(tempdir)
+									fail(summary, repo, "gogs", d.URL, prometheus.StagePush, err)
+									return
+								}
+							}
+
+							prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gogs", d.URL).Set(time.Since(repotime).Seconds())
+							status = 1
+
+							prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gogs", d.URL).Set(float64(status))
+						}
+					} else if err := gogs.Backup(r, d, cli.Dry); err == nil {
+						prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gogs", d.URL).Set(time.Since(repotime).Seconds())
+						status = 1
+					} else if !cli.Dry {
+						fail(summary, repo, "gogs", d.URL, prometheus.StageBackup, err)
+					}
+
+					prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gogs", d.URL).Set(float64(status))
+					prometheus.DestinationBackupsComplete.WithLabelValues("gogs").Inc()
+				}
+			}(r)
+		}
+
+		for _, d := range conf.Destination.Gitlab {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
+			}
+
+			func(r types.Repo) {
+				if !strings.HasSuffix(r.Name, ".wiki") {
+					if d.URL == "" {
+						d.URL = "https://gitlab.com"
+					}
+
+					repotime := time.Now()
+					status := 0
+					ctx, span := tracing.Start(ctx, "destination gitlab", tracing.Destination("gitlab", d.URL)...)
+					defer func() { finishDestination(summary, span, repo, "gitlab", d.URL, repotime, status) }()
+
+					name, err := claim(r, d.NameTemplate, false, "gitlab", ownerURL(d, r))
+					if err != nil {
+						log.Error().
+							Str("stage", "gitlab").
+							Str("url", d.URL).
+							Msg(err.Error())
+						fail(summary, repo, "gitlab", d.URL, prometheus.StageName, err)
+						return
+					}
+					r.Name = name
+					if d.Mirror.Enabled {
+						log.Info().
+							Str("stage", "gitlab").
+							Str("url", d.URL).
+							Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
+
+						if !cli.Dry {
+							tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("gitlab-%x", repotime))
+							if err != nil {
+								log.Error().
+									Str("stage", "tempclone").
+									Str("url", r.URL).
+									Msg(err.Error())
+								fail(summary, repo, "gitlab", d.URL, prometheus.StageTempdir, err)
+								return
+							}
+
+							defer os.RemoveAll(tempdir)
+							temprepo, err := local.TempClone(ctx, r, tempdir)
+							if err != nil {
+								if errors.Is(err, git.NoErrAlreadyUpToDate) {
+									log.Info().
+										Str("stage", "gitlab").
+										Str("url", r.URL).
+										Msg(err.Error())
+								} else {
+									log.Error().
+										Str("stage", "tempclone").
+										Str("url", r.URL).
+										Str("git", "clone").
+										Msg(err.Error())
+									os.RemoveAll(tempdir)
+									fail(summary, repo, "gitlab", d.URL, prometheus.StageClone, err)
+									return
+								}
+							}
+
+							cloneurl, err := gitlab.GetOrCreate(d, r)
+							if err != nil {
+								log.Error().
+									Str("stage", "gitlab").
+									Str("url", r.URL).
+									Msg(err.Error())
+								os.RemoveAll(tempdir)
+								fail(summary, repo, "gitlab", d.URL, prometheus.StageCreate, err)
+								return
+							}
+
+							err = local.CreateRemotePush(ctx, temprepo, d, cloneurl, r.Origin.LFS, rewritten(summary, repo, "gitlab", d.URL))
+							if err != nil {
+								if errors.Is(err, git.NoErrAlreadyUpToDate) {
+									log.Info().
+										Str("stage", "gitlab").
+										Str("url", r.URL).
+										Msg(err.Error())
+								} else {
+									log.Error().
+										Str("stage", "gitlab").
+										Str("url", r.URL).
+										Str("git", "push").
+										Msg(err.Error())
+									os.RemoveAll(tempdir)
+									fail(summary, repo, "gitlab", d.URL, prometheus.StagePush, err)
+									return
+								}
+							}
+
+							if len(r.Releases) > 0 {
+								if err := gitlab.CreateReleases(ctx, d, r, cloneurl); err != nil {
+									log.Error().
+										Str("stage", "gitlab").
+										Str("url", r.URL).
+										Msg(err.Error())
+								}
+							}
+
+							prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitlab", d.URL).Set(time.Since(repotime).Seconds())
+							status = 1
+
+							prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitlab", d.URL).Set(float64(status))
+						}
+					} else if err := gitlab.Backup(r, d, cli.Dry); err == nil {
+						prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitlab", d.URL).Set(time.Since(repotime).Seconds())
+						status = 1
+					} else if !cli.Dry {
+						fail(summary, repo, "gitlab", d.URL, prometheus.StageBackup, err)
+					}
+
+					prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "gitlab", d.URL).Set(float64(status))
+					prometheus.DestinationBackupsComplete.WithLabelValues("gitlab").Inc()
+				}
+			}(r)
+		}
+
+		for _, d := range conf.Destination.Github {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
+			}
+
+			func(r types.Repo) {
+				if !strings.HasSuffix(r.Name, ".wiki") {
+					repotime := time.Now()
+					status := 0
+					ctx, span := tracing.Start(ctx, "destination github", tracing.Destination("github", "https://github.com")...)
+					defer func() { finishDestination(summary, span, repo, "github", "https://github.com", repotime, status) }()
+
+					name, err := claim(r, d.NameTemplate, false, "github", "https://github.com")
+					if err != nil {
+						log.Error().
+							Str("stage", "github").
+							Msg(err.Error())
+						fail(summary, repo, "github", "https://github.com", prometheus.StageName, err)
+						return
+					}
+					r.Name = name
+
+					log.Info().
+						Str("stage", "github").
+						Str("url", "https://github.com").
+						Msgf("mirroring %s to %s", types.Blue(r.Name), "https://github.com")
 
 					if !cli.Dry {
-						tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("gitea-%x", repotime))
+						tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("github-%x", repotime))
 						if err != nil {
 							log.Error().
 								Str("stage", "tempclone").
 								Str("url", r.URL).
 								Msg(err.Error())
-							continue
+							fail(summary, repo, "github", "https://github.com", prometheus.StageTempdir, err)
+							return
 						}
 
 						defer os.RemoveAll(tempdir)
-						temprepo, err := local.TempClone(r, tempdir)
+						temprepo, err := local.TempClone(ctx, r, tempdir)
 						if err != nil {
 							if errors.Is(err, git.NoErrAlreadyUpToDate) {
 								log.Info().
-									Str("stage", "gitea").
+									Str("stage", "github").
 									Str("url", r.URL).
 									Msg(err.Error())
 							} else {
@@ -551,247 +1167,310 @@ func backup(repos []types.Repo, conf *types.Conf) {
 									Str("git", "clone").
 									Msg(err.Error())
 								os.RemoveAll(tempdir)
-								continue
+								fail(summary, repo, "github", "https://github.com", prometheus.StageClone, err)
+								return
 							}
 						}
 
-						cloneurl, err := gitea.GetOrCreate(d, r)
+						cloneurl, err := github.GetOrCreate(d, r)
 						if err != nil {
 							log.Error().
-								Str("stage", "gitea").
+								Str("stage", "github").
 								Str("url", r.URL).
 								Msg(err.Error())
 							os.RemoveAll(tempdir)
-							continue
+							fail(summary, repo, "github", "https://github.com", prometheus.StageCreate, err)
+							return
 						}
 
-						err = local.CreateRemotePush(temprepo, d, cloneurl, r.Origin.LFS)
+						err = local.CreateRemotePush(ctx, temprepo, d, cloneurl, r.Origin.LFS, rewritten(summary, repo, "github", "https://github.com"))
 						if err != nil {
 							if errors.Is(err, git.NoErrAlreadyUpToDate) {
 								log.Info().
-									Str("stage", "gitea").
+									Str("stage", "github").
 									Str("url", r.URL).
 									Msg(err.Error())
 							} else {
 								log.Error().
-									Str("stage", "gitea").
+									Str("stage", "github").
 									Str("url", r.URL).
 									Str("git", "push").
 									Msg(err.Error())
 								os.RemoveAll(tempdir)
-								continue
+								fail(summary, repo, "github", "https://github.com", prometheus.StagePush, err)
+								return
+							}
+						}
+
+						if len(r.Releases) > 0 {
+							if err := github.CreateReleases(ctx, d, r, cloneurl); err != nil {
+								log.Error().
+									Str("stage", "github").
+									Str("url", r.URL).
+									Msg(err.Error())
 							}
 						}
 
-						prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitea", d.URL).Set(time.Since(repotime).Seconds())
+						prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "github", "https://github.com").Set(time.Since(repotime).Seconds())
 						status = 1
 
-						prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitea", d.URL).Set(float64(status))
+						prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "github", "https://github.com").Set(float64(status))
+						prometheus.DestinationBackupsComplete.WithLabelValues("github").Inc()
 					}
-				} else if gitea.Backup(r, d, cli.Dry) {
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitea", d.URL).Set(time.Since(repotime).Seconds())
-					status = 1
 				}
+			}(r)
+		}
 
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitea", d.URL).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("gitea").Inc()
+		for _, d := range conf.Destination.OneDev {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
 			}
-		}
 
-		for _, d := range conf.Destination.Gogs {
-			if !strings.HasSuffix(r.Name, ".wiki") {
-				repotime := time.Now()
-				status := 0
-				if d.Mirror.Enabled {
+			func(r types.Repo) {
+				if !strings.HasSuffix(r.Name, ".wiki") {
+					repotime := time.Now()
+					status := 0
+					ctx, span := tracing.Start(ctx, "destination onedev", tracing.Destination("onedev", d.URL)...)
+					defer func() { finishDestination(summary, span, repo, "onedev", d.URL, repotime, status) }()
+
+					name, err := claim(r, d.NameTemplate, false, "onedev", d.URL)
+					if err != nil {
+						log.Error().
+							Str("stage", "onedev").
+							Str("url", d.URL).
+							Msg(err.Error())
+						fail(summary, repo, "onedev", d.URL, prometheus.StageName, err)
+						return
+					}
+					r.Name = name
+					if d.URL == "" {
+						d.URL = "https://code.onedev.io/"
+					}
+
 					log.Info().
-						Str("stage", "gogs").
+						Str("stage", "onedev").
 						Str("url", d.URL).
 						Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
 
 					if !cli.Dry {
-						tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("gogs-%x", repotime))
+						tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("onedev-%x", repotime))
 						if err != nil {
 							log.Error().
 								Str("stage", "tempclone").
 								Str("url", r.URL).
 								Msg(err.Error())
-							continue
+							fail(summary, repo, "onedev", d.URL, prometheus.StageTempdir, err)
+							return
 						}
 
 						defer os.RemoveAll(tempdir)
-						temprepo, err := local.TempClone(r, tempdir)
+						temprepo, err := local.TempClone(ctx, r, tempdir)
 						if err != nil {
 							if errors.Is(err, git.NoErrAlreadyUpToDate) {
 								log.Info().
-									Str("stage", "gogs").
+									Str("stage", "onedev").
 									Str("url", r.URL).
 									Msg(err.Error())
 							} else {
 								log.Error().
 									Str("stage", "tempclone").
 									Str("url", r.URL).
-									Str("git", "clone").
 									Msg(err.Error())
 								os.RemoveAll(tempdir)
-								continue
+								fail(summary, repo, "onedev", d.URL, prometheus.StageClone, err)
+								return
 							}
 						}
 
-						cloneurl, err := gogs.GetOrCreate(d, r)
+						cloneurl, err := onedev.GetOrCreate(d, r)
 						if err != nil {
 							log.Error().
-								Str("stage", "gogs").
+								Str("stage", "onedev").
 								Str("url", r.URL).
 								Msg(err.Error())
 							os.RemoveAll(tempdir)
-							continue
+							fail(summary, repo, "onedev", d.URL, prometheus.StageCreate, err)
+							return
 						}
 
-						err = local.CreateRemotePush(temprepo, d, cloneurl, r.Origin.LFS)
+						err = local.CreateRemotePush(ctx, temprepo, d, cloneurl, r.Origin.LFS, rewritten(summary, repo, "onedev", d.URL))
 						if err != nil {
 							if errors.Is(err, git.NoErrAlreadyUpToDate) {
 								log.Info().
-									Str("stage", "gogs").
+									Str("stage", "onedev").
 									Str("url", r.URL).
 									Msg(err.Error())
 							} else {
 								log.Error().
-									Str("stage", "gogs").
+									Str("stage", "onedev").
 									Str("url", r.URL).
-									Str("git", "push").
 									Msg(err.Error())
 								os.RemoveAll(tempdir)
-								continue
+								fail(summary, repo, "onedev", d.URL, prometheus.StagePush, err)
+								return
 							}
 						}
 
-						prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "gogs", d.URL).Set(time.Since(repotime).Seconds())
+						prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "onedev", d.URL).Set(time.Since(repotime).Seconds())
 						status = 1
 
-						prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "gogs", d.URL).Set(float64(status))
+						prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "onedev", d.URL).Set(float64(status))
+						prometheus.DestinationBackupsComplete.WithLabelValues("onedev").Inc()
+						os.RemoveAll(tempdir)
 					}
-				} else if gogs.Backup(r, d, cli.Dry) {
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "gogs", d.URL).Set(time.Since(repotime).Seconds())
-					status = 1
 				}
+			}(r)
+		}
 
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "gogs", d.URL).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("gogs").Inc()
+		for _, d := range conf.Destination.Sourcehut {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
 			}
-		}
 
-		for _, d := range conf.Destination.Gitlab {
-			if !strings.HasSuffix(r.Name, ".wiki") {
-				if d.URL == "" {
-					d.URL = "https://gitlab.com"
-				}
+			func(r types.Repo) {
+				if !strings.HasSuffix(r.Name, "-docs") {
+					repotime := time.Now()
+					status := 0
+					ctx, span := tracing.Start(ctx, "destination sourcehut", tracing.Destination("sourcehut", d.URL)...)
+					defer func() { finishDestination(summary, span, repo, "sourcehut", d.URL, repotime, status) }()
+
+					name, err := claim(r, d.NameTemplate, false, "sourcehut", d.URL)
+					if err != nil {
+						log.Error().
+							Str("stage", "sourcehut").
+							Str("url", d.URL).
+							Msg(err.Error())
+						fail(summary, repo, "sourcehut", d.URL, prometheus.StageName, err)
+						return
+					}
+					r.Name = name
+					d.SSH = true
+					if d.URL == "" {
+						d.URL = "https://git.sr.ht"
+					}
 
-				repotime := time.Now()
-				status := 0
-				if d.Mirror.Enabled {
 					log.Info().
-						Str("stage", "gitlab").
+						Str("stage", "sourcehut").
 						Str("url", d.URL).
 						Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
 
 					if !cli.Dry {
-						tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("gitlab-%x", repotime))
+						tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("sourcehut-%x", repotime))
 						if err != nil {
 							log.Error().
 								Str("stage", "tempclone").
 								Str("url", r.URL).
 								Msg(err.Error())
-							continue
+							fail(summary, repo, "sourcehut", d.URL, prometheus.StageTempdir, err)
+							return
 						}
 
 						defer os.RemoveAll(tempdir)
-						temprepo, err := local.TempClone(r, tempdir)
+						temprepo, err := local.TempClone(ctx, r, tempdir)
 						if err != nil {
 							if errors.Is(err, git.NoErrAlreadyUpToDate) {
 								log.Info().
-									Str("stage", "gitlab").
+									Str("stage", "sourcehut").
 									Str("url", r.URL).
 									Msg(err.Error())
 							} else {
 								log.Error().
 									Str("stage", "tempclone").
 									Str("url", r.URL).
-									Str("git", "clone").
 									Msg(err.Error())
 								os.RemoveAll(tempdir)
-								continue
+								fail(summary, repo, "sourcehut", d.URL, prometheus.StageClone, err)
+								return
 							}
 						}
 
-						cloneurl, err := gitlab.GetOrCreate(d, r)
+						cloneurl, err := sourcehut.GetOrCreate(d, r)
 						if err != nil {
 							log.Error().
-								Str("stage", "gitlab").
+								Str("stage", "sourcehut").
 								Str("url", r.URL).
 								Msg(err.Error())
 							os.RemoveAll(tempdir)
-							continue
+							fail(summary, repo, "sourcehut", d.URL, prometheus.StageCreate, err)
+							return
 						}
 
-						err = local.CreateRemotePush(temprepo, d, cloneurl, r.Origin.LFS)
+						err = local.CreateRemotePush(ctx, temprepo, d, cloneurl, r.Origin.LFS, rewritten(summary, repo, "sourcehut", d.URL))
 						if err != nil {
 							if errors.Is(err, git.NoErrAlreadyUpToDate) {
 								log.Info().
-									Str("stage", "gitlab").
+									Str("stage", "sourcehut").
 									Str("url", r.URL).
 									Msg(err.Error())
 							} else {
 								log.Error().
-									Str("stage", "gitlab").
+									Str("stage", "sourcehut").
 									Str("url", r.URL).
-									Str("git", "push").
 									Msg(err.Error())
 								os.RemoveAll(tempdir)
-								continue
+								fail(summary, repo, "sourcehut", d.URL, prometheus.StagePush, err)
+								return
 							}
 						}
 
-						prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitlab", d.URL).Set(time.Since(repotime).Seconds())
+						prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "sourcehut", d.URL).Set(time.Since(repotime).Seconds())
 						status = 1
 
-						prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitlab", d.URL).Set(float64(status))
+						prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "sourcehut", d.URL).Set(float64(status))
+						prometheus.DestinationBackupsComplete.WithLabelValues("sourcehut").Inc()
+						os.RemoveAll(tempdir)
 					}
-				} else if gitlab.Backup(r, d, cli.Dry) {
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitlab", d.URL).Set(time.Since(repotime).Seconds())
-					status = 1
 				}
+			}(r)
+		}
 
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "gitlab", d.URL).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("gitlab").Inc()
+		for _, d := range conf.Destination.Radicle {
+			if !r.RoutedTo(d.Name, d.Routes) {
+				continue
 			}
-		}
 
-		for _, d := range conf.Destination.Github {
-			if !strings.HasSuffix(r.Name, ".wiki") {
-				repotime := time.Now()
-				status := 0
+			repotime := time.Now()
+			status := 0
 
-				log.Info().
-					Str("stage", "github").
-					Str("url", "https://github.com").
-					Msgf("mirroring %s to %s", types.Blue(r.Name), "https://github.com")
+			radhome, _ := radicle.Home()
+			ctx, span := tracing.Start(ctx, "destination radicle", tracing.Destination("radicle", radhome)...)
 
-				if !cli.Dry {
-					tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("github-%x", repotime))
+			log.Info().
+				Str("stage", "radicle").
+				Str("home", radhome).
+				Msgf("mirroring %s to %s", types.Blue(r.Name), radhome)
+
+			name, err := claim(r, d.NameTemplate, false, "radicle", radhome)
+			if err != nil {
+				log.Error().
+					Str("stage", "radicle").
+					Str("home", radhome).
+					Msg(err.Error())
+				fail(summary, repo, "radicle", radhome, prometheus.StageName, err)
+				finishDestination(summary, span, repo, "radicle", radhome, repotime, status)
+
+				continue
+			}
+
+			if !cli.Dry {
+				func(r types.Repo) {
+					r.Name = name
+					tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("radicle-%x", repotime))
 					if err != nil {
 						log.Error().
 							Str("stage", "tempclone").
 							Str("url", r.URL).
 							Msg(err.Error())
-						continue
+						fail(summary, repo, "radicle", radhome, prometheus.StageTempdir, err)
+						return
 					}
 
 					defer os.RemoveAll(tempdir)
-					temprepo, err := local.TempClone(r, tempdir)
+					_, err = local.TempClone(ctx, r, tempdir)
 					if err != nil {
 						if errors.Is(err, git.NoErrAlreadyUpToDate) {
 							log.Info().
-								Str("stage", "github").
+								Str("stage", "radicle").
 								Str("url", r.URL).
 								Msg(err.Error())
 						} else {
@@ -800,332 +1479,779 @@ func backup(repos []types.Repo, conf *types.Conf) {
 								Str("url", r.URL).
 								Str("git", "clone").
 								Msg(err.Error())
-							os.RemoveAll(tempdir)
-							continue
+							fail(summary, repo, "radicle", radhome, prometheus.StageClone, err)
+							return
 						}
 					}
 
-					cloneurl, err := github.GetOrCreate(d, r)
+					rid, err := radicle.Mirror(ctx, r, d, tempdir)
 					if err != nil {
 						log.Error().
-							Str("stage", "github").
+							Str("stage", "radicle").
 							Str("url", r.URL).
 							Msg(err.Error())
-						os.RemoveAll(tempdir)
-						continue
+						fail(summary, repo, "radicle", radhome, prometheus.StagePush, err)
+						return
 					}
 
-					err = local.CreateRemotePush(temprepo, d, cloneurl, r.Origin.LFS)
-					if err != nil {
-						if errors.Is(err, git.NoErrAlreadyUpToDate) {
-							log.Info().
-								Str("stage", "github").
-								Str("url", r.URL).
-								Msg(err.Error())
-						} else {
-							log.Error().
-								Str("stage", "github").
-								Str("url", r.URL).
-								Str("git", "push").
-								Msg(err.Error())
-							os.RemoveAll(tempdir)
-							continue
-						}
-					}
+					log.Info().
+						Str("stage", "radicle").
+						Str("rid", fmt.Sprintf("rad:%s", rid)).
+						Msgf("mirrored %s", types.Green(r.Name))
 
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "github", "https://github.com").Set(time.Since(repotime).Seconds())
+					prometheus.RepoTime.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "radicle", radhome).Set(time.Since(repotime).Seconds())
 					status = 1
+				}(r)
+
+				prometheus.RepoSuccess.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, "radicle", radhome).Set(float64(status))
+				prometheus.DestinationBackupsComplete.WithLabelValues("radicle").Inc()
+			}
+
+			finishDestination(summary, span, repo, "radicle", radhome, repotime, status)
+		}
+
+		prometheus.SourceBackupsComplete.WithLabelValues(r.Name).Inc()
+		span.End()
+	}
+}
+
+// finishDestination records the attempt to back up r to a destination and
+// ends its span, it failed unless the repository was backed up or it was a
+// dry run.
+func finishDestination(summary *notify.Summary, span trace.Span, r types.Repo, kind, url string, start time.Time, status int) {
+	var err error
+	if !cli.Dry {
+		prometheus.Attempt(r, kind, url, start, status == 1)
+		summary.AddAttempt(status == 1)
+
+		if status != 1 {
+			err = errBackupFailed
+		}
+	}
+
+	tracing.End(span, err)
+}
+
+// fail records a failed backup of r to a destination.
+func fail(summary *notify.Summary, r types.Repo, kind, url, stage string, err error) {
+	prometheus.Failure(r, kind, url, stage, err)
+	summary.AddFailure(r, kind, url, stage, prometheus.ClassifyError(err), err)
+}
+
+// skipReleases warns that the releases of r aren't backed up to a destination
+// that can't store them, for the reason why.
+func skipReleases(r types.Repo, kind, url, why string) {
+	if len(r.Releases) == 0 {
+		return
+	}
+
+	log.Warn().
+		Str("stage", kind).
+		Str("url", url).
+		Msgf("the releases of %s aren't backed up, %s", types.Blue(r.Name), why)
+}
+
+// rewritten returns the callback that records the refs of r rewritten or
+// deleted upstream, whose previous tips the destination kept.
+func rewritten(summary *notify.Summary, r types.Repo, kind, url string) func(local.RewrittenRef) {
+	return func(ref local.RewrittenRef) {
+		prometheus.RewrittenRefs.WithLabelValues(r.Hoster, r.Name, r.Owner, kind, url, ref.Change).Inc()
+		summary.AddEvent(notify.Event{
+			Hoster:      r.Hoster,
+			Owner:       r.Owner,
+			Repo:        r.Name,
+			Ref:         ref.Name.String(),
+			Event:       ref.Change,
+			Destination: kind,
+			URL:         url,
+			Action:      "kept as " + ref.Kept.String(),
+		}, nil)
+	}
+}
+
+// storeReleases writes the releases of r next to its clone in dir, failed
+// assets are logged.
+func storeReleases(ctx context.Context, dir string, r types.Repo, kind, url string) {
+	if len(r.Releases) == 0 {
+		return
+	}
+
+	log.Info().
+		Str("stage", kind).
+		Str("url", url).
+		Msgf("storing releases of %s", types.Blue(r.Name))
+
+	if _, err := releases.Write(ctx, dir, r); err != nil {
+		log.Error().
+			Str("stage", kind).
+			Str("url", url).
+			Str("repo", r.Name).
+			Msg(err.Error())
+	}
+}
+
+// fromSource sets the kind of source of the repositories, and routes them to
+// the destinations of their source if it names any.
+func fromSource(repos []types.Repo, kind string) []types.Repo {
+	for i := range repos {
+		repos[i].Source = kind
+		if len(repos[i].Origin.Destinations) > 0 {
+			repos[i].Destinations = repos[i].Origin.Destinations
+		}
+	}
+
+	return repos
+}
+
+// seenRepos are the canonical clone URLs of the repositories found in a run
+// by the destinations of the document that found them, with the source that
+// found them first. The documents that run together share them.
+type seenRepos map[string]string
+
+// unique drops the repositories that were found before in this run, by
+// another source, by another path of the same source, like starred and owned
+// repositories, or by another document with the same destinations. The first
+// repository found wins with the token and options of its source, sources
+// are asked in a fixed order and in the order of the config. destinations
+// identifies the destinations of the document.
+func (s seenRepos) unique(destinations string, repos []types.Repo) []types.Repo {
+	unique := []types.Repo{}
+
+	for _, r := range repos {
+		url := r.CanonicalURL()
+		if url == "" {
+			unique = append(unique, r)
+
+			continue
+		}
+
+		key := destinations + " " + url
+		if first, ok := s[key]; ok {
+			log.Debug().
+				Str("stage", "backup").
+				Str("repo", r.Name).
+				Str("source", r.Source).
+				Msgf("skipping duplicate of %s found by %s", url, first)
+
+			continue
+		}
+
+		s[key] = r.Source
+		unique = append(unique, r)
+	}
+
+	return unique
+}
+
+// destinationsKey identifies the destinations of conf in seenRepos.
+func destinationsKey(conf *types.Conf) string {
+	data, err := json.Marshal(conf.Destination)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// enrich fetches the details of the repositories that are left once the
+// duplicates are dropped.
+func enrich(ctx context.Context, repos []types.Repo) []types.Repo {
+	for i := range repos {
+		if repos[i].Enrich != nil {
+			repos[i].Enrich(ctx, &repos[i])
+			repos[i].Enrich = nil
+		}
+	}
+
+	return repos
+}
+
+// track follows the repositories a source of type kind found and applies the
+// rename actions of the destinations before they are backed up under their
+// new names. clean is false if the source logged errors.
+func track(ctx context.Context, tracker *tracking.Tracker, kind string, repos []types.Repo, clean bool, conf *types.Conf, summary *notify.Summary) {
+	for _, event := range tracker.Found(kind, repos, clean) {
+		upstream(ctx, event, conf, summary)
+	}
+}
+
+// upstreamDestination is a destination that may have backed up a repository
+// deleted or renamed upstream, with what it can do with the backup.
+// Destinations leave the functions nil they don't support.
+type upstreamDestination struct {
+	kind string
+	// location and renamed are where the destination keeps the repository
+	// under its previous and its new name.
+	location     string
+	renamed      string
+	upstream     types.Upstream
+	nameTemplate string
+	structured   bool
+	// move moves the backup on path destinations.
+	move    func(from, to string) (int, error)
+	archive func(name string) error
+	rename  func(name, newName string) error
+}
+
+// upstream reports a repository deleted or renamed upstream and applies the
+// actions of the destinations that backed it up.
+func upstream(ctx context.Context, event tracking.Event, conf *types.Conf, summary *notify.Summary) {
+	previous := event.Previous.Repo()
+	if event.Kind == tracking.Renamed {
+		log.Warn().
+			Str("stage", "upstream").
+			Str("repo", previous.Name).
+			Msgf("%s/%s was renamed to %s/%s upstream", previous.Owner, previous.Name, event.Repo.Owner, event.Repo.Name)
+	} else {
+		log.Warn().
+			Str("stage", "upstream").
+			Str("repo", previous.Name).
+			Msgf("%s/%s was deleted upstream", previous.Owner, previous.Name)
+	}
+
+	for _, d := range upstreamDestinations(ctx, conf, previous, event.Repo) {
+		applyUpstream(event, d, summary)
+	}
+}
+
+// upstreamDestinations returns the destinations of conf that may have backed
+// up previous, renamed is the repository under its new name.
+func upstreamDestinations(ctx context.Context, conf *types.Conf, previous, renamed types.Repo) []upstreamDestination {
+	destinations := []upstreamDestination{}
+	for _, d := range conf.Destination.Local {
+		destinations = append(destinations, upstreamDestination{
+			kind: "local", location: d.Path, renamed: d.Path,
+			upstream: d.Upstream, nameTemplate: d.NameTemplate, structured: d.Structured,
+			move: func(from, to string) (int, error) { return local.Move(d, from, to) },
+		})
+	}
+
+	for _, d := range conf.Destination.S3 {
+		destinations = append(destinations, upstreamDestination{
+			kind: "s3", location: d.Endpoint, renamed: d.Endpoint,
+			upstream: d.Upstream, nameTemplate: d.NameTemplate, structured: d.Structured,
+			move: func(from, to string) (int, error) {
+				d, err := s3Keys(d)
+				if err != nil {
+					return 0, err
+				}
+
+				return s3.Move(d, from, to)
+			},
+		})
+	}
+
+	for _, d := range conf.Destination.AzureBlob {
+		destinations = append(destinations, upstreamDestination{
+			kind: "azureblob", location: d.Container, renamed: d.Container,
+			upstream: d.Upstream, nameTemplate: d.NameTemplate, structured: d.Structured,
+			move: func(from, to string) (int, error) { return azureblob.Move(d, from, to) },
+		})
+	}
+
+	for _, d := range conf.Destination.WebDAV {
+		destinations = append(destinations, upstreamDestination{
+			kind: "webdav", location: d.Url, renamed: d.Url,
+			upstream: d.Upstream, nameTemplate: d.NameTemplate, structured: d.Structured,
+			move: func(from, to string) (int, error) { return webdav.Move(d, from, to) },
+		})
+	}
+
+	for _, d := range conf.Destination.Gitea {
+		owner := d.TargetOwner(previous.Owner)
+		destinations = append(destinations, upstreamDestination{
+			kind: "gitea", location: ownerURL(d, previous), renamed: ownerURL(d, renamed),
+			upstream: d.Upstream, nameTemplate: d.NameTemplate,
+			archive: func(name string) error { return gitea.Archive(d, owner, name) },
+			rename:  func(name, newName string) error { return gitea.Rename(d, owner, name, newName) },
+		})
+	}
+
+	for _, d := range conf.Destination.Gogs {
+		destinations = append(destinations, upstreamDestination{
+			kind: "gogs", location: ownerURL(d, previous), renamed: ownerURL(d, renamed),
+			upstream: d.Upstream, nameTemplate: d.NameTemplate,
+		})
+	}
+
+	for _, d := range conf.Destination.Gitlab {
+		namespace := d.TargetOwner(previous.Owner)
+		destinations = append(destinations, upstreamDestination{
+			kind: "gitlab", location: ownerURL(d, previous), renamed: ownerURL(d, renamed),
+			upstream: d.Upstream, nameTemplate: d.NameTemplate,
+			archive: func(name string) error { return gitlab.Archive(d, namespace, name) },
+			rename:  func(name, newName string) error { return gitlab.Rename(d, namespace, name, newName) },
+		})
+	}
+
+	for _, d := range conf.Destination.Github {
+		destinations = append(destinations, upstreamDestination{
+			kind: "github", location: "https://github.com", renamed: "https://github.com",
+			upstream: d.Upstream, nameTemplate: d.NameTemplate,
+			archive: func(name string) error { return github.Archive(ctx, d, name) },
+			rename:  func(name, newName string) error { return github.Rename(ctx, d, name, newName) },
+		})
+	}
+
+	for _, d := range conf.Destination.OneDev {
+		destinations = append(destinations, upstreamDestination{
+			kind: "onedev", location: d.URL, renamed: d.URL,
+			upstream: d.Upstream, nameTemplate: d.NameTemplate,
+		})
+	}
+
+	for _, d := range conf.Destination.Sourcehut {
+		destinations = append(destinations, upstreamDestination{
+			kind: "sourcehut", location: d.URL, renamed: d.URL,
+			upstream: d.Upstream, nameTemplate: d.NameTemplate,
+		})
+	}
+
+	if len(conf.Destination.Radicle) > 0 {
+		radhome, _ := radicle.Home()
+		for _, d := range conf.Destination.Radicle {
+			destinations = append(destinations, upstreamDestination{
+				kind: "radicle", location: radhome, renamed: radhome,
+				nameTemplate: d.NameTemplate,
+			})
+		}
+	}
+
+	return destinations
+}
+
+// migrateName moves the backups of r stored under r.PreviousName by earlier
+// versions of gickup to its name, on the destinations that keep files.
+func migrateName(ctx context.Context, r types.Repo, conf *types.Conf) {
+	previous := r
+	previous.Name = r.PreviousName
+
+	for _, d := range upstreamDestinations(ctx, conf, previous, r) {
+		if d.move == nil {
+			continue
+		}
+
+		name, err := types.RenderName(d.nameTemplate, d.structured, previous, time.Now())
+		if err != nil {
+			continue
+		}
+
+		newName, err := types.RenderName(d.nameTemplate, d.structured, r, time.Now())
+		if err != nil || newName == name {
+			continue
+		}
+
+		if cli.Dry {
+			log.Info().
+				Str("stage", "upstream").
+				Str("repo", r.Name).
+				Str("url", d.location).
+				Msgf("would move the backup of %s on %s to %s", name, d.kind, newName)
+
+			continue
+		}
+
+		moved, err := d.move(name, newName)
+		if err != nil {
+			log.Warn().
+				Str("stage", "upstream").
+				Str("repo", r.Name).
+				Str("url", d.location).
+				Msgf("can't move the backup of %s on %s: %s", name, d.kind, err)
+
+			continue
+		}
+
+		if moved > 0 {
+			log.Info().
+				Str("stage", "upstream").
+				Str("repo", r.Name).
+				Str("url", d.location).
+				Msgf("moved %d files and directories of the backup of %s on %s to %s", moved, name, d.kind, newName)
+		}
+	}
+}
+
+// applyUpstream applies the action of d for the event if d backed up the
+// repository, and reports it.
+func applyUpstream(event tracking.Event, d upstreamDestination, summary *notify.Summary) {
+	name, ok := event.Previous.Stored[tracking.Location(d.kind, d.location)]
+	if !ok {
+		return
+	}
+
+	previous := event.Previous.Repo()
+	report := notify.Event{
+		Hoster:      previous.Hoster,
+		Owner:       previous.Owner,
+		Repo:        previous.Name,
+		Event:       event.Kind,
+		Destination: d.kind,
+		URL:         d.location,
+	}
+
+	var (
+		action string
+		err    error
+	)
+	if event.Kind == tracking.Renamed {
+		report.NewName = event.Repo.Owner + "/" + event.Repo.Name
+		action, err = d.upstream.RenameAction()
+	} else {
+		action, err = d.upstream.DeleteAction()
+	}
+	report.Action = action
+
+	if err == nil && action != types.ActionKeep {
+		err = doUpstream(event, d, action, name)
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+		log.Error().
+			Str("stage", "upstream").
+			Str("repo", name).
+			Str("url", d.location).
+			Msgf("can't %s the backup on %s: %s", action, d.kind, err)
+	} else if action == types.ActionKeep {
+		log.Info().
+			Str("stage", "upstream").
+			Str("repo", name).
+			Str("url", d.location).
+			Msgf("keeping the backup on %s", d.kind)
+	}
+
+	prometheus.UpstreamEvents.WithLabelValues(previous.Hoster, previous.Name, previous.Owner, event.Kind, d.kind, d.location, action, result).Inc()
+	summary.AddEvent(report, err)
+}
 
-					prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "github", "https://github.com").Set(float64(status))
-					prometheus.DestinationBackupsComplete.WithLabelValues("github").Inc()
-				}
-			}
+// doUpstream moves, archives or renames the backup name on d.
+func doUpstream(event tracking.Event, d upstreamDestination, action, name string) error {
+	newName := name
+	if action == types.ActionRename {
+		var err error
+		newName, err = types.RenderName(d.nameTemplate, d.structured, event.Repo, time.Now())
+		if err != nil {
+			return err
 		}
 
-		for _, d := range conf.Destination.OneDev {
-			if !strings.HasSuffix(r.Name, ".wiki") {
-				repotime := time.Now()
-				status := 0
-				if d.URL == "" {
-					d.URL = "https://code.onedev.io/"
-				}
-
-				log.Info().
-					Str("stage", "onedev").
-					Str("url", d.URL).
-					Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
+		if newName == name && d.renamed == d.location {
+			return nil
+		}
+	}
 
-				if !cli.Dry {
-					tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("onedev-%x", repotime))
-					if err != nil {
-						log.Error().
-							Str("stage", "tempclone").
-							Str("url", r.URL).
-							Msg(err.Error())
-						continue
-					}
+	if action == types.ActionMove {
+		newName = path.Join(types.DeletedDir, name)
+	}
 
-					defer os.RemoveAll(tempdir)
-					temprepo, err := local.TempClone(r, tempdir)
-					if err != nil {
-						if errors.Is(err, git.NoErrAlreadyUpToDate) {
-							log.Info().
-								Str("stage", "onedev").
-								Str("url", r.URL).
-								Msg(err.Error())
-						} else {
-							log.Error().
-								Str("stage", "tempclone").
-								Str("url", r.URL).
-								Msg(err.Error())
-							os.RemoveAll(tempdir)
-							continue
-						}
-					}
+	if cli.Dry {
+		log.Info().
+			Str("stage", "upstream").
+			Str("repo", name).
+			Str("url", d.location).
+			Msgf("would %s the backup on %s to %s", action, d.kind, newName)
 
-					cloneurl, err := onedev.GetOrCreate(d, r)
-					if err != nil {
-						log.Error().
-							Str("stage", "onedev").
-							Str("url", r.URL).
-							Msg(err.Error())
-						os.RemoveAll(tempdir)
-						continue
-					}
+		return nil
+	}
 
-					err = local.CreateRemotePush(temprepo, d, cloneurl, r.Origin.LFS)
-					if err != nil {
-						if errors.Is(err, git.NoErrAlreadyUpToDate) {
-							log.Info().
-								Str("stage", "onedev").
-								Str("url", r.URL).
-								Msg(err.Error())
-						} else {
-							log.Error().
-								Str("stage", "onedev").
-								Str("url", r.URL).
-								Msg(err.Error())
-							os.RemoveAll(tempdir)
-							continue
-						}
-					}
+	switch {
+	case (action == types.ActionMove || action == types.ActionRename) && d.move != nil:
+		moved, err := d.move(name, newName)
+		if err != nil {
+			return err
+		}
 
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "onedev", d.URL).Set(time.Since(repotime).Seconds())
-					status = 1
+		log.Info().
+			Str("stage", "upstream").
+			Str("repo", name).
+			Str("url", d.location).
+			Msgf("moved %d files and directories of the backup on %s to %s", moved, d.kind, newName)
+
+		return nil
+	case action == types.ActionArchive && d.archive != nil:
+		if err := d.archive(name); err != nil {
+			return err
+		}
 
-					prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "onedev", d.URL).Set(float64(status))
-					prometheus.DestinationBackupsComplete.WithLabelValues("onedev").Inc()
-					os.RemoveAll(tempdir)
-				}
-			}
+		log.Info().
+			Str("stage", "upstream").
+			Str("repo", name).
+			Str("url", d.location).
+			Msgf("archived the repository on %s", d.kind)
+
+		return nil
+	case action == types.ActionRename && d.rename != nil:
+		if d.renamed != d.location {
+			return fmt.Errorf("the repository moved from %s to %s", d.location, d.renamed)
 		}
 
-		for _, d := range conf.Destination.Sourcehut {
-			if !strings.HasSuffix(r.Name, "-docs") {
-				repotime := time.Now()
-				status := 0
-				d.SSH = true
-				if d.URL == "" {
-					d.URL = "https://git.sr.ht"
-				}
+		if err := d.rename(name, newName); err != nil {
+			return err
+		}
 
-				log.Info().
-					Str("stage", "sourcehut").
-					Str("url", d.URL).
-					Msgf("mirroring %s to %s", types.Blue(r.Name), d.URL)
+		log.Info().
+			Str("stage", "upstream").
+			Str("repo", name).
+			Str("url", d.location).
+			Msgf("renamed the repository on %s to %s", d.kind, newName)
 
-				if !cli.Dry {
-					tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("sourcehut-%x", repotime))
-					if err != nil {
-						log.Error().
-							Str("stage", "tempclone").
-							Str("url", r.URL).
-							Msg(err.Error())
-						continue
-					}
+		return nil
+	}
 
-					defer os.RemoveAll(tempdir)
-					temprepo, err := local.TempClone(r, tempdir)
-					if err != nil {
-						if errors.Is(err, git.NoErrAlreadyUpToDate) {
-							log.Info().
-								Str("stage", "sourcehut").
-								Str("url", r.URL).
-								Msg(err.Error())
-						} else {
-							log.Error().
-								Str("stage", "tempclone").
-								Str("url", r.URL).
-								Msg(err.Error())
-							os.RemoveAll(tempdir)
-							continue
-						}
-					}
+	return fmt.Errorf("%s isn't supported on %s", action, d.kind)
+}
 
-					cloneurl, err := sourcehut.GetOrCreate(d, r)
-					if err != nil {
-						log.Error().
-							Str("stage", "sourcehut").
-							Str("url", r.URL).
-							Msg(err.Error())
-						os.RemoveAll(tempdir)
-						continue
-					}
+// s3Keys resolves the keys of d like backups to S3 do.
+func s3Keys(d types.S3Repo) (types.S3Repo, error) {
+	if !d.UseStaticCreds {
+		return d, nil
+	}
 
-					err = local.CreateRemotePush(temprepo, d, cloneurl, r.Origin.LFS)
-					if err != nil {
-						if errors.Is(err, git.NoErrAlreadyUpToDate) {
-							log.Info().
-								Str("stage", "sourcehut").
-								Str("url", r.URL).
-								Msg(err.Error())
-						} else {
-							log.Error().
-								Str("stage", "sourcehut").
-								Str("url", r.URL).
-								Msg(err.Error())
-							os.RemoveAll(tempdir)
-							continue
-						}
-					}
+	var err error
+	if d.AccessKey, err = d.GetKey(d.AccessKey); err != nil {
+		return d, err
+	}
 
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "sourcehut", d.URL).Set(time.Since(repotime).Seconds())
-					status = 1
+	if d.SecretKey, err = d.GetKey(d.SecretKey); err != nil {
+		return d, err
+	}
 
-					prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "sourcehut", d.URL).Set(float64(status))
-					prometheus.DestinationBackupsComplete.WithLabelValues("sourcehut").Inc()
-					os.RemoveAll(tempdir)
-				}
-			}
+	if d.Token != "" {
+		if d.Token, err = d.GetKey(d.Token); err != nil {
+			return d, err
 		}
+	}
 
-		for _, d := range conf.Destination.Radicle {
-			repotime := time.Now()
-			status := 0
+	return d, nil
+}
 
-			radhome, _ := radicle.Home()
+// limitSizes applies the size limits of the sources before anything is
+// cloned. Repositories smaller than minsize are skipped, larger than maxsize
+// handled by the oversize policy. Repositories of unknown size are kept.
+func limitSizes(repos []types.Repo) []types.Repo {
+	limited := []types.Repo{}
 
-			log.Info().
-				Str("stage", "radicle").
-				Str("home", radhome).
-				Msgf("mirroring %s to %s", types.Blue(r.Name), radhome)
+	for _, r := range repos {
+		minSize, maxSize, err := r.Origin.Filter.SizeLimits()
+		if err != nil {
+			log.Error().
+				Str("stage", "filter").
+				Str("repo", r.Name).
+				Msgf("skipping, invalid size filter: %s", err)
 
-			if !cli.Dry {
-				func() {
-					tempdir, err := os.MkdirTemp(os.TempDir(), fmt.Sprintf("radicle-%x", repotime))
-					if err != nil {
-						log.Error().
-							Str("stage", "tempclone").
-							Str("url", r.URL).
-							Msg(err.Error())
-						return
-					}
+			continue
+		}
 
-					defer os.RemoveAll(tempdir)
-					_, err = local.TempClone(r, tempdir)
-					if err != nil {
-						if errors.Is(err, git.NoErrAlreadyUpToDate) {
-							log.Info().
-								Str("stage", "radicle").
-								Str("url", r.URL).
-								Msg(err.Error())
-						} else {
-							log.Error().
-								Str("stage", "tempclone").
-								Str("url", r.URL).
-								Str("git", "clone").
-								Msg(err.Error())
-							return
-						}
-					}
+		if r.Size == 0 {
+			limited = append(limited, r)
 
-					rid, err := radicle.Mirror(r, d, tempdir)
-					if err != nil {
-						log.Error().
-							Str("stage", "radicle").
-							Str("url", r.URL).
-							Msg(err.Error())
-						return
-					}
+			continue
+		}
 
-					log.Info().
-						Str("stage", "radicle").
-						Str("rid", fmt.Sprintf("rad:%s", rid)).
-						Msgf("mirrored %s", types.Green(r.Name))
+		if minSize > 0 && r.Size < minSize {
+			log.Info().
+				Str("stage", "filter").
+				Msgf("skipping %s, %d KB is smaller than %s", types.Blue(r.Name), r.Size, r.Origin.Filter.MinSize)
 
-					prometheus.RepoTime.WithLabelValues(r.Hoster, r.Name, r.Owner, "radicle", radhome).Set(time.Since(repotime).Seconds())
-					status = 1
-				}()
+			continue
+		}
 
-				prometheus.RepoSuccess.WithLabelValues(r.Hoster, r.Name, r.Owner, "radicle", radhome).Set(float64(status))
-				prometheus.DestinationBackupsComplete.WithLabelValues("radicle").Inc()
+		if maxSize > 0 && r.Size > maxSize {
+			switch strings.ToLower(r.Origin.Filter.Oversize) {
+			case types.OversizeShallow:
+				log.Info().
+					Str("stage", "filter").
+					Msgf("%s has %d KB, cloning only its latest commits", types.Blue(r.Name), r.Size)
+				r.Shallow = true
+			case types.OversizeRoute:
+				log.Info().
+					Str("stage", "filter").
+					Msgf("%s has %d KB, backing it up to %s only", types.Blue(r.Name), r.Size, strings.Join(r.Origin.Filter.OversizeDestinations, ", "))
+				r.Destinations = r.Origin.Filter.OversizeDestinations
+			default:
+				log.Warn().
+					Str("stage", "filter").
+					Msgf("skipping %s, %d KB is larger than %s", types.Blue(r.Name), r.Size, r.Origin.Filter.MaxSize)
+
+				continue
 			}
 		}
 
-		prometheus.SourceBackupsComplete.WithLabelValues(r.Name).Inc()
+		limited = append(limited, r)
 	}
+
+	return limited
+}
+
+// dirSize returns the size of all files below dir.
+func dirSize(dir string) int64 {
+	var size int64
+
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size
 }
 
-func runBackup(conf *types.Conf, num int) {
+// running counts the runs in progress, the asset cache is pruned when the
+// last one ends.
+var running atomic.Int32
+
+// runBackup runs the document conf at index num, seen are the repositories
+// found by the documents that run together with it.
+func runBackup(conf *types.Conf, num int, seen seenRepos) {
 	log.Info().Msg("Backup run starting")
+	running.Add(1)
 
 	numstring := strconv.Itoa(num)
 
 	startTime := time.Now()
+	summary := &notify.Summary{Config: num, Start: startTime}
+	names := nameClaims{}
+	destinations := destinationsKey(conf)
+	// the state of the document stays locked until the run is complete
+	tracker, err := tracking.Load(conf.Source.StateKey())
+	if err != nil {
+		log.Warn().Str("stage", "upstream").Err(err).Msg("can't read the tracked repositories")
+	}
+	defer tracker.Close()
+	errorsBefore := logger.ErrorCount()
 
 	prometheus.JobsStarted.Inc()
 
+	ctx, span := tracing.Start(context.Background(), "run", attribute.Int("gickup.config", num))
+
+	if len(conf.Metrics.Heartbeat.URLs) > 0 {
+		heartbeat.Start(conf.Metrics.Heartbeat)
+	}
+
 	// Github
-	repos, ran := github.Get(conf)
+	getctx, getspan := tracing.Start(ctx, "github.get")
+	errs := logger.ErrorCount()
+	repos, ran := github.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("github", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "github")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "github", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
 
 	// Gitea
-	repos, ran = gitea.Get(conf)
+	getctx, getspan = tracing.Start(ctx, "gitea.get")
+	errs = logger.ErrorCount()
+	repos, ran = gitea.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("gitea", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "gitea")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "gitea", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
 
 	// Gogs
-	repos, ran = gogs.Get(conf)
+	getctx, getspan = tracing.Start(ctx, "gogs.get")
+	errs = logger.ErrorCount()
+	repos, ran = gogs.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("gogs", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "gogs")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "gogs", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
 
 	// Gitlab
-	repos, ran = gitlab.Get(conf)
+	getctx, getspan = tracing.Start(ctx, "gitlab.get")
+	errs = logger.ErrorCount()
+	repos, ran = gitlab.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("gitlab", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
-
-	repos, ran = bitbucket.Get(conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "gitlab")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "gitlab", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
+
+	getctx, getspan = tracing.Start(ctx, "bitbucket.get")
+	errs = logger.ErrorCount()
+	repos, ran = bitbucket.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("bitbucket", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
-
-	repos, ran = whatever.Get(conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "bitbucket")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "bitbucket", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
+
+	getctx, getspan = tracing.Start(ctx, "whatever.get")
+	errs = logger.ErrorCount()
+	repos, ran = whatever.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("whatever", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
-
-	repos, ran = onedev.Get(conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "any")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "any", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
+
+	getctx, getspan = tracing.Start(ctx, "onedev.get")
+	errs = logger.ErrorCount()
+	repos, ran = onedev.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("onedev", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
-
-	repos, ran = sourcehut.Get(conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "onedev")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "onedev", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
+
+	getctx, getspan = tracing.Start(ctx, "sourcehut.get")
+	errs = logger.ErrorCount()
+	repos, ran = sourcehut.Get(getctx, conf)
 	if ran {
 		prometheus.CountReposDiscovered.WithLabelValues("sourcehut", numstring).Set(float64(len(repos)))
 	}
-	backup(repos, conf)
+	repos = enrich(getctx, seen.unique(destinations, fromSource(repos, "sourcehut")))
+	getspan.End()
+	summary.Repos += len(repos)
+	track(ctx, tracker, "sourcehut", repos, logger.ErrorCount() == errs, conf, summary)
+	backup(ctx, repos, conf, summary, names, tracker)
+
+	for _, event := range tracker.Gone() {
+		upstream(ctx, event, conf, summary)
+	}
+
+	if !cli.Dry {
+		if err := tracker.Save(); err != nil {
+			log.Warn().Str("stage", "upstream").Err(err).Msg("can't store the tracked repositories")
+		}
+	}
+
+	if running.Add(-1) == 0 && !cli.Dry {
+		if err := releases.Prune(); err != nil {
+			log.Warn().Str("stage", "releases").Err(err).Msg("can't prune the asset cache")
+		}
+	}
 
 	endTime := time.Now()
 	duration := endTime.Sub(startTime)
@@ -1133,42 +2259,32 @@ func runBackup(conf *types.Conf, num int) {
 	prometheus.JobsComplete.Inc()
 	prometheus.JobDuration.Observe(duration.Seconds())
 
-	if len(conf.Metrics.Heartbeat.URLs) > 0 {
-		heartbeat.Send(conf.Metrics.Heartbeat)
+	span.End()
+	if err := tracing.Flush(ctx); err != nil {
+		log.Warn().Str("stage", "tracing").Err(err).Msg("couldn't export traces")
 	}
 
-	if len(conf.Metrics.PushConfigs.Ntfy) > 0 {
-		for _, pusher := range conf.Metrics.PushConfigs.Ntfy {
-			pusher.ResolveToken()
-			err := ntfy.Notify(fmt.Sprintf("backup took %v", duration), *pusher)
-			if err != nil {
-				log.Warn().Str("push", "ntfy").Err(err).Msg("couldn't send message")
-			}
-		}
+	exitCode := logger.GetExitCode()
+	if exitCode != 0 {
+		log.Warn().Msgf("Encountered at least one error during the run. Check the logs. Exiting with status=%d", exitCode)
 	}
 
-	if len(conf.Metrics.PushConfigs.Gotify) > 0 {
-		for _, pusher := range conf.Metrics.PushConfigs.Gotify {
-			pusher.ResolveToken()
-			err := gotify.Notify(fmt.Sprintf("backup took %v", duration), *pusher)
-			if err != nil {
-				log.Warn().Str("push", "gotify").Err(err).Msg("couldn't send message")
-			}
+	summary.Finish(logger.ErrorCount()-errorsBefore, exitCode)
+	notify.Send(conf.Metrics.PushConfigs, summary)
+
+	if len(conf.Metrics.Heartbeat.URLs) > 0 {
+		body, err := notify.Render("", notify.DefaultMessage, summary)
+		if err != nil {
+			log.Warn().Str("monitoring", "heartbeat").Err(err).Msg("couldn't render the summary")
 		}
+		heartbeat.Finish(conf.Metrics.Heartbeat, summary.Success(), int(exitCode), body)
 	}
 
-	if len(conf.Metrics.PushConfigs.Apprise) > 0 {
-		for _, pusher := range conf.Metrics.PushConfigs.Apprise {
-			err := apprise.Notify(fmt.Sprintf("backup took %v", duration), *pusher)
-			if err != nil {
-				log.Warn().Str("push", "apprise").Err(err).Msg("couldn't send message")
-			}
+	if conf.Metrics.Prometheus.Pushgateway.URL != "" {
+		if err := prometheus.Push(conf.Metrics.Prometheus.Pushgateway, summary.Success()); err != nil {
+			log.Warn().Str("stage", "pushgateway").Err(err).Msg("couldn't push metrics")
 		}
 	}
-	exitCode := logger.GetExitCode()
-	if exitCode != 0 {
-		log.Warn().Msgf("Encountered at least one error during the run. Check the logs. Exiting with status=%d", exitCode)
-	}
 
 	log.Info().
 		Str("duration", duration.String()).
@@ -1196,7 +2312,7 @@ func playsForever(c *cron.Cron, conffiles []string, confs []*types.Conf) bool {
 
 		if !cmp.Equal(confs, checkconfigs) {
 			log.Info().Msg("config changed")
-			log.Debug().Msg(cmp.Diff(confs, checkconfigs))
+			log.Debug().Msg(cmp.Diff(confs, checkconfigs, config.RedactSecrets()))
 			for _, entry := range c.Entries() {
 				c.Remove(entry.ID)
 			}
@@ -1268,7 +2384,29 @@ func main() {
 			logConf.Timeformat = timeformat
 		}
 
-		log.Logger = logger.CreateLogger(logConf)
+		// the flags take precedence over the level of the config file
+		switch {
+		case cli.Debug:
+			logConf.Level = zerolog.DebugLevel.String()
+		case cli.Quiet:
+			logConf.Level = zerolog.WarnLevel.String()
+		}
+
+		log.Logger = logger.CreateLogger(logConf, cli.Silent)
+
+		if err := tracing.Setup(context.Background(), confs[0].Metrics.Tracing); err != nil {
+			log.Error().Str("stage", "tracing").Msg(err.Error())
+		}
+
+		// dry runs don't change the state
+		state.Dry = cli.Dry
+		if err := state.Setup(confs[0].StateDir); err != nil {
+			log.Error().Str("stage", "state").Msg(err.Error())
+		}
+
+		if err := releases.Setup(confs[0].AssetCache); err != nil {
+			log.Error().Str("stage", "releases").Msg(err.Error())
+		}
 
 		validcron := confs[0].HasValidCronSpec()
 
@@ -1281,6 +2419,11 @@ func main() {
 
 		sourcecount := 0
 		destinationcount := 0
+		// documents that run at the same time run one after another and
+		// share the repositories found in the run
+		seen := seenRepos{}
+		schedules := map[string][]int{}
+		specs := []string{}
 		// one pair per source-destination
 		for num, conf := range confs {
 			pairs := conf.Source.Count() * conf.Destination.Count()
@@ -1297,26 +2440,31 @@ func main() {
 			}
 
 			if conf.HasValidCronSpec() && validcron {
-				conf := conf // https://stackoverflow.com/questions/57095167/how-do-i-create-multiple-cron-function-by-looping-through-a-list
-				num := num
-
 				logNextRun(conf)
 
-				_, err := c.AddFunc(conf.Cron, func() {
-					runBackup(conf, num)
-				})
-				if err != nil {
-					log.Fatal().
-						Int("sources", conf.Source.Count()).
-						Int("destinations", conf.Destination.Count()).
-						Int("pairs", pairs).
-						Msg(err.Error())
+				if _, ok := schedules[conf.Cron]; !ok {
+					specs = append(specs, conf.Cron)
 				}
+				schedules[conf.Cron] = append(schedules[conf.Cron], num)
 			} else {
-				runBackup(conf, num)
+				runBackup(conf, num, seen)
 			}
 		}
 
+		for _, spec := range specs {
+			nums := schedules[spec]
+			_, err := c.AddFunc(spec, func() {
+				seen := seenRepos{}
+				for _, num := range nums {
+					runBackup(confs[num], num, seen)
+				}
+			})
+			if err != nil {
+				log.Fatal().
+					Str("cron", spec).
+					Msg(err.Error())
+			}
+		}
 		if validcron {
 			if confs[0].HasAllPrometheusConf() {
 				prometheus.CountSourcesConfigured.Add(float64(sourcecount))
@@ -1333,6 +2481,11 @@ func main() {
 			break
 		}
 	}
+
+	if err := tracing.Shutdown(context.Background()); err != nil {
+		log.Warn().Str("stage", "tracing").Err(err).Msg("couldn't export traces")
+	}
+
 	os.Exit(int(logger.GetExitCode()))
 }
 
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/cooperspencer/gickup/metrics/notify"
+	"github.com/cooperspencer/gickup/tracking"
+	"github.com/cooperspencer/gickup/types"
 )
 
 func TestTildeReplacement_NoAction(t *testing.T) {
@@ -84,6 +90,44 @@ destination:
 	}
 }
 
+func TestReadConfigFile_DefaultsReplaceInheritedPushConfigs(t *testing.T) {
+	t.Parallel()
+
+	config := `defaults:
+  destination:
+    local:
+      - path: "/tmp/default"
+---
+metrics:
+  push:
+    ntfy:
+      - url: "https://ntfy.sh/topic"
+---
+source:
+  github:
+    - user: "someone"
+`
+	configPath := filepath.Join(t.TempDir(), "gickup-test.yml")
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	confs := readConfigFile(configPath)
+	if len(confs) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(confs))
+	}
+
+	if got := len(confs[1].Metrics.PushConfigs.Ntfy); got != 0 {
+		t.Fatalf("expected no inherited push config when defaults are declared, got %d", got)
+	}
+
+	for _, c := range confs {
+		if len(c.Destination.Local) != 1 || c.Destination.Local[0].Path != "/tmp/default" {
+			t.Fatalf("expected default destination, got %+v", c.Destination.Local)
+		}
+	}
+}
+
 func TestReadConfigFile_ExpandsHomeInFileBackedConfigKeys(t *testing.T) {
 	t.Parallel()
 
@@ -286,3 +330,189 @@ func TestReadConfigFile_S3UseStaticCredsAbsentSkipsKeyResolution(t *testing.T) {
 		t.Fatal("expected UseStaticCreds to be false when absent from config")
 	}
 }
+
+func TestLimitSizes(t *testing.T) {
+	t.Parallel()
+
+	filter := types.Filter{MinSize: "1M", MaxSize: "1G"}
+	shallow := filter
+	shallow.Oversize = types.OversizeShallow
+	route := filter
+	route.Oversize = types.OversizeRoute
+	route.OversizeDestinations = []string{"archive"}
+
+	repos := limitSizes([]types.Repo{
+		{Name: "tiny", Size: 10, Origin: types.GenRepo{Filter: filter}},
+		{Name: "unknown", Origin: types.GenRepo{Filter: filter}},
+		{Name: "fits", Size: 2048, Origin: types.GenRepo{Filter: filter}},
+		{Name: "huge", Size: 2 << 20, Origin: types.GenRepo{Filter: filter}},
+		{Name: "shallow", Size: 2 << 20, Origin: types.GenRepo{Filter: shallow}},
+		{Name: "routed", Size: 2 << 20, Origin: types.GenRepo{Filter: route}},
+		{Name: "invalid", Size: 10, Origin: types.GenRepo{Filter: types.Filter{MaxSize: "huge"}}},
+	})
+
+	names := []string{}
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+
+	if strings.Join(names, ",") != "unknown,fits,shallow,routed" {
+		t.Fatalf("unexpected repositories %v", names)
+	}
+
+	if repos[1].Shallow || !repos[2].Shallow {
+		t.Error("only oversized repositories are shallow")
+	}
+
+	if !repos[3].RoutedTo("archive", nil) || repos[3].RoutedTo("", nil) {
+		t.Errorf("routed to %v", repos[3].Destinations)
+	}
+}
+
+func TestNameClaims(t *testing.T) {
+	t.Parallel()
+
+	names := nameClaims{}
+	first := types.Repo{Name: "website", Owner: "acme", Hoster: "github.com", URL: "https://github.com/acme/website.git"}
+	second := types.Repo{Name: "website", Owner: "acme", Hoster: "gitlab.com", URL: "https://gitlab.com/acme/website.git"}
+
+	if _, err := names.claim(first, "", false, "local", "/backup"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same repository found again keeps its name
+	if _, err := names.claim(first, "", false, "local", "/backup"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := names.claim(second, "", false, "local", "/backup"); err == nil {
+		t.Error("expected a collision")
+	}
+
+	// other destinations and names don't collide
+	if _, err := names.claim(second, "", false, "local", "/other"); err != nil {
+		t.Error(err)
+	}
+
+	name, err := names.claim(second, "", true, "local", "/backup")
+	if err != nil || name != "gitlab.com/acme/website" {
+		t.Errorf("claimed %q: %v", name, err)
+	}
+
+	if _, err := names.claim(second, "{{.Owner}}/{{.Name}}", false, "gitea", "https://gitea.local"); err == nil {
+		t.Error("forges can't take names with slashes")
+	}
+}
+
+func TestSeenRepos(t *testing.T) {
+	t.Parallel()
+
+	seen := seenRepos{}
+	owned := types.Repo{Name: "website", Source: "github", URL: "https://github.com/acme/website.git", Origin: types.GenRepo{Token: "owner"}}
+	starred := types.Repo{Name: "website", Source: "github", URL: "https://github.com/acme/website.git", Origin: types.GenRepo{Token: "stars"}}
+	other := types.Repo{Name: "tools", Source: "github", URL: "https://github.com/acme/tools.git"}
+
+	repos := seen.unique("local", []types.Repo{owned, starred, other})
+	if len(repos) != 2 || repos[0].Origin.Token != "owner" || repos[1].Name != "tools" {
+		t.Errorf("unexpected repositories %+v", repos)
+	}
+
+	// found again by another source through its SSH URL
+	again := types.Repo{Name: "website", Source: "any", URL: "git@github.com:acme/website.git"}
+	if repos := seen.unique("local", []types.Repo{again}); len(repos) != 0 {
+		t.Errorf("expected the duplicate to be dropped, got %+v", repos)
+	}
+
+	// documents with other destinations back it up as well
+	if repos := seen.unique("s3", []types.Repo{again}); len(repos) != 1 {
+		t.Errorf("expected the repository for other destinations, got %+v", repos)
+	}
+}
+
+func TestEnrichAfterUnique(t *testing.T) {
+	t.Parallel()
+
+	enriched := []string{}
+	repo := func(name string) types.Repo {
+		return types.Repo{Name: name, URL: "https://github.com/acme/" + name + ".git", Enrich: func(_ context.Context, r *types.Repo) {
+			enriched = append(enriched, r.Name)
+			r.Issues = map[string]interface{}{"1": "issue"}
+		}}
+	}
+
+	seen := seenRepos{}
+	repos := enrich(t.Context(), seen.unique("local", []types.Repo{repo("website"), repo("website"), repo("tools")}))
+	if len(repos) != 2 || len(repos[0].Issues) != 1 || repos[0].Enrich != nil {
+		t.Fatalf("unexpected repositories %+v", repos)
+	}
+
+	if len(enriched) != 2 {
+		t.Errorf("expected the duplicate not to be enriched, enriched %v", enriched)
+	}
+}
+
+func TestApplyUpstream(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "website"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &types.Conf{Destination: types.Destination{
+		Local: []types.Local{{Path: dir, Upstream: types.Upstream{OnRename: types.ActionRename}}},
+		Gogs:  []types.GenRepo{{URL: "https://gogs.local", User: "backup", Upstream: types.Upstream{OnRename: types.ActionRename}}},
+	}}
+
+	previous := tracking.Entry{Hoster: "github.com", Owner: "acme", Name: "website", Stored: map[string]string{
+		tracking.Location("local", dir):                                    "website",
+		tracking.Location("gogs", "https://gogs.local/backup"):             "website",
+		tracking.Location("webdav", "https://webdav.local/not-configured"): "website",
+	}}
+	event := tracking.Event{Kind: tracking.Renamed, Previous: previous, Repo: types.Repo{Hoster: "github.com", Owner: "acme", Name: "site"}}
+
+	summary := &notify.Summary{}
+	upstream(t.Context(), event, conf, summary)
+
+	if _, err := os.Stat(filepath.Join(dir, "site")); err != nil {
+		t.Error(err)
+	}
+
+	if len(summary.Events) != 2 {
+		t.Fatalf("expected an event for local and gogs, got %+v", summary.Events)
+	}
+
+	for _, e := range summary.Events {
+		if e.Destination == "gogs" && !strings.Contains(e.Error, "isn't supported") {
+			t.Errorf("renaming on gogs isn't supported, got %+v", e)
+		}
+		if e.Destination == "local" && (e.Error != "" || e.NewName != "acme/site") {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
+
+func TestMigrateName(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"aa11", "aa11.comments"} {
+		if err := os.MkdirAll(filepath.Join(dir, "gists", name), 0o777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf := &types.Conf{Destination: types.Destination{Local: []types.Local{{Path: dir}}}}
+	repo := types.Repo{Hoster: "github.com", Owner: "alice", Name: "gists/notes", PreviousName: "gists/aa11"}
+	migrateName(t.Context(), repo, conf)
+
+	for _, name := range []string{"notes", "notes.comments"} {
+		if _, err := os.Stat(filepath.Join(dir, "gists", name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "gists", "aa11")); !os.IsNotExist(err) {
+		t.Errorf("the backup under the previous name is still there: %v", err)
+	}
+}
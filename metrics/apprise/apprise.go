@@ -12,9 +12,10 @@ import (
 )
 
 type Request struct {
-	Body string   `json:"body"`
-	Tags []string `json:"tags,omitempty"`
-	Urls []string `json:"urls,omitempty"`
+	Title string   `json:"title,omitempty"`
+	Body  string   `json:"body"`
+	Tags  []string `json:"tags,omitempty"`
+	Urls  []string `json:"urls,omitempty"`
 }
 
 type ErrorMsg struct {
@@ -23,9 +24,10 @@ type ErrorMsg struct {
 
 func Notify(msg string, config types.AppriseConfig) error {
 	payload := Request{
-		Body: msg,
-		Urls: config.Urls,
-		Tags: config.Tags,
+		Title: config.Title,
+		Body:  msg,
+		Urls:  config.Urls,
+		Tags:  config.Tags,
 	}
 
 	jsonData, err := json.Marshal(payload)
@@ -0,0 +1,61 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+// Discord rejects embeds with longer descriptions.
+const maxDescription = 4096
+
+type embed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description"`
+}
+
+type message struct {
+	Username string  `json:"username,omitempty"`
+	Embeds   []embed `json:"embeds"`
+}
+
+// Notify posts msg as embed to the Discord webhook.
+func Notify(msg string, config types.DiscordConfig) error {
+	if len(msg) > maxDescription {
+		msg = msg[:maxDescription-3] + "..."
+	}
+
+	body, err := json.Marshal(message{
+		Username: config.Username,
+		Embeds:   []embed{{Title: config.Title, Description: msg}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, config.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		response, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return fmt.Errorf("received status %d from discord: %s", res.StatusCode, response)
+	}
+
+	return nil
+}
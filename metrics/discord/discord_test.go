@@ -0,0 +1,42 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+func TestNotifySendsEmbed(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := message{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+
+		if payload.Username != "gickup" || len(payload.Embeds) != 1 {
+			t.Fatalf("unexpected payload: %#v", payload)
+		}
+
+		if payload.Embeds[0].Title != "Backup done" || len(payload.Embeds[0].Description) != maxDescription {
+			t.Errorf("unexpected embed: %q, %d characters", payload.Embeds[0].Title, len(payload.Embeds[0].Description))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := Notify(strings.Repeat("x", 5000), types.DiscordConfig{
+		Url:          server.URL,
+		Username:     "gickup",
+		Notification: types.Notification{Title: "Backup done"},
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+// TLS modes of an SMTP config.
+const (
+	ModeSTARTTLS = "starttls"
+	ModeTLS      = "tls"
+	ModeNone     = "none"
+)
+
+// Notify sends msg as email, the title is the subject.
+func Notify(msg string, config types.SMTPConfig) error {
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return fmt.Errorf("host, from and to are required")
+	}
+
+	mode := strings.ToLower(config.TLS)
+	if mode == "" {
+		mode = ModeSTARTTLS
+	}
+
+	port := config.Port
+	if port == 0 {
+		switch mode {
+		case ModeTLS:
+			port = 465
+		case ModeNone:
+			port = 25
+		default:
+			port = 587
+		}
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: config.Host, MinVersion: tls.VersionTLS12}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	switch mode {
+	case ModeTLS:
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, tlsConfig)
+	case ModeSTARTTLS, ModeNone:
+		conn, err = net.DialTimeout("tcp", addr, 30*time.Second)
+	default:
+		return fmt.Errorf("unknown tls mode %s, use starttls, tls or none", config.TLS)
+	}
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+	defer c.Close()
+
+	if mode == ModeSTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s doesn't support STARTTLS", addr)
+		}
+
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(config.From); err != nil {
+		return err
+	}
+
+	for _, to := range config.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message(msg, config)); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns the email with its headers.
+func message(msg string, config types.SMTPConfig) []byte {
+	subject := config.Title
+	if subject == "" {
+		subject = "Backup done"
+	}
+	// a header must not span lines
+	subject = strings.Join(strings.Fields(subject), " ")
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
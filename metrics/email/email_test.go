@@ -0,0 +1,142 @@
+package email
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+// fakeSMTP accepts one session and returns the commands and the data it
+// received, it offers neither STARTTLS nor checks the credentials.
+func fakeSMTP(t *testing.T) (int, <-chan []string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan []string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		lines := []string{}
+		r := bufio.NewReader(conn)
+		write := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+
+		write("220 localhost ESMTP")
+		data := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+
+			switch {
+			case data:
+				if line == "." {
+					data = false
+					write("250 queued")
+				}
+			case strings.HasPrefix(line, "EHLO"):
+				write("250-localhost")
+				write("250 AUTH PLAIN")
+			case strings.HasPrefix(line, "AUTH"):
+				write("235 authenticated")
+			case line == "DATA":
+				data = true
+				write("354 go ahead")
+			case line == "QUIT":
+				write("221 bye")
+				received <- lines
+
+				return
+			default:
+				write("250 ok")
+			}
+		}
+		received <- lines
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestNotifySendsMail(t *testing.T) {
+	t.Parallel()
+
+	port, received := fakeSMTP(t)
+
+	err := Notify("1 of 2 backups failed\n- alice/website", types.SMTPConfig{
+		Host:         "127.0.0.1",
+		Port:         port,
+		Username:     "gickup",
+		Password:     "secret",
+		From:         "gickup@example.com",
+		To:           []string{"ops@example.com", "alice@example.com"},
+		TLS:          ModeNone,
+		Notification: types.Notification{Title: "Backup failed"},
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	session := strings.Join(<-received, "\n")
+	for _, expected := range []string{
+		"AUTH PLAIN",
+		"MAIL FROM:<gickup@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<alice@example.com>",
+		"Subject: Backup failed",
+		"To: ops@example.com, alice@example.com",
+		"1 of 2 backups failed\n- alice/website",
+	} {
+		if !strings.Contains(session, expected) {
+			t.Errorf("%q missing in session:\n%s", expected, session)
+		}
+	}
+}
+
+func TestNotifyRequiresSTARTTLS(t *testing.T) {
+	t.Parallel()
+
+	port, _ := fakeSMTP(t)
+
+	err := Notify("backup done", types.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: port,
+		From: "gickup@example.com",
+		To:   []string{"ops@example.com"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected an error about STARTTLS, got %v", err)
+	}
+}
+
+func TestMessageHeaders(t *testing.T) {
+	t.Parallel()
+
+	msg := string(message("done", types.SMTPConfig{
+		From:         "gickup@example.com",
+		To:           []string{"ops@example.com"},
+		Notification: types.Notification{Title: "Backup\r\nBcc: evil@example.com"},
+	}))
+
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("subject injected a header:\n%s", msg)
+	}
+
+	if !strings.Contains(msg, "Subject: Backup Bcc: evil@example.com\r\n") {
+		t.Errorf("unexpected subject:\n%s", msg)
+	}
+}
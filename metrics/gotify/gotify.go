@@ -11,6 +11,12 @@ import (
 	"github.com/cooperspencer/gickup/types"
 )
 
+type message struct {
+	Message  string `json:"message"`
+	Title    string `json:"title"`
+	Priority int    `json:"priority,omitempty"`
+}
+
 func Notify(msg string, config types.PushConfig) error {
 	if !strings.HasSuffix(config.Url, "/") {
 		config.Url += "/"
@@ -18,9 +24,10 @@ func Notify(msg string, config types.PushConfig) error {
 
 	url := fmt.Sprintf("%smessage?token=%s", config.Url, config.Token)
 
-	payload := map[string]string{}
-	payload["message"] = msg
-	payload["title"] = "Backup done"
+	payload := message{Message: msg, Title: config.Title, Priority: config.Priority}
+	if payload.Title == "" {
+		payload.Title = "Backup done"
+	}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
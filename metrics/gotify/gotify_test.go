@@ -57,3 +57,34 @@ func TestNotifyReturnsStatusError(t *testing.T) {
 		t.Fatal("expected status error")
 	}
 }
+
+func TestNotifySendsTitleAndPriority(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := struct {
+			Title    string `json:"title"`
+			Priority int    `json:"priority"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+
+		if payload.Title != "Backup failed" || payload.Priority != 8 {
+			t.Fatalf("unexpected payload: %#v", payload)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := Notify("backup failed", types.PushConfig{
+		Url:          server.URL,
+		Token:        "secret-token",
+		Notification: types.Notification{Title: "Backup failed"},
+		Priority:     8,
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+}
@@ -1,22 +1,149 @@
 package heartbeat
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cooperspencer/gickup/types"
 	"github.com/rs/zerolog/log"
 )
 
-func Send(conf types.HeartbeatConfig) {
+// Failure signals of a heartbeat config.
+const (
+	FailureFail       = "fail"
+	FailureExitStatus = "exit-status"
+	FailureNone       = "none"
+)
+
+// healthchecks.io truncates bodies after 100 kB.
+const maxBody = 100_000
+
+// retryDelay is the delay before the first retry, it doubles with every try.
+var retryDelay = time.Second
+
+// Start pings <url>/start of every URL when a run begins, if configured.
+func Start(conf types.HeartbeatConfig) {
+	if !conf.Start {
+		return
+	}
+
+	for _, u := range conf.URLs {
+		ping(conf, u, "start", "")
+	}
+}
+
+// Finish pings every URL with the outcome of a run. Failed runs never ping
+// the success URL. With body set, summary is posted along with the ping.
+func Finish(conf types.HeartbeatConfig, success bool, exitStatus int, summary string) {
+	if !conf.Body {
+		summary = ""
+	}
+
+	failure := strings.ToLower(conf.Failure)
+
 	for _, u := range conf.URLs {
-		log.Info().Str("url", u).Msg("sending heartbeat")
-		resp, err := http.Get(u) //nolint:noctx
+		switch {
+		case failure == FailureExitStatus:
+			if success {
+				exitStatus = 0
+			} else if exitStatus == 0 {
+				exitStatus = 1
+			}
+			ping(conf, u, strconv.Itoa(exitStatus), summary)
+		case success:
+			ping(conf, u, "", summary)
+		case failure == FailureNone:
+			log.Warn().Str("monitoring", "heartbeat").Msg("run failed, not sending heartbeat")
+		default:
+			ping(conf, u, FailureFail, summary)
+		}
+	}
+}
+
+// ping sends the signal to u, retrying failed requests.
+func ping(conf types.HeartbeatConfig, u, signal, body string) {
+	target := u
+	if signal != "" {
+		parsed, err := url.Parse(u)
 		if err != nil {
 			log.Error().Str("monitoring", "heartbeat").Msg(err.Error())
-			continue
+
+			return
 		}
-		if err := resp.Body.Close(); err != nil {
-			log.Error().Str("monitoring", "heartbeat").Str("url", u).Msg(err.Error())
+		target = parsed.JoinPath(signal).String()
+	}
+
+	retries := 3
+	if conf.Retries != nil {
+		retries = *conf.Retries
+	}
+
+	log.Info().Str("signal", signal).Msg("sending heartbeat")
+
+	delay := retryDelay
+	for try := 0; ; try++ {
+		err := request(target, body)
+		if err == nil {
+			return
+		}
+
+		if try >= retries {
+			log.Error().Str("monitoring", "heartbeat").Str("signal", signal).Msg(err.Error())
+
+			return
 		}
+
+		log.Warn().Str("monitoring", "heartbeat").Str("signal", signal).Err(err).
+			Msgf("retry %d from %d", try+1, retries)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func request(target, body string) error {
+	method := http.MethodGet
+	var payload io.Reader
+	if body != "" {
+		if len(body) > maxBody {
+			body = body[:maxBody]
+		}
+		method = http.MethodPost
+		payload = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, target, payload)
+	if err != nil {
+		return err
 	}
+
+	if body != "" {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the URL is a secret, drop it from the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+		}
+
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("received status %d", resp.StatusCode)
+	}
+
+	return nil
 }
@@ -1,15 +1,19 @@
 package heartbeat
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cooperspencer/gickup/types"
 )
 
-func TestSendCallsEachHeartbeatURL(t *testing.T) {
+func TestFinishCallsEachHeartbeatURL(t *testing.T) {
 	t.Parallel()
 
 	var hits int32
@@ -20,9 +24,106 @@ func TestSendCallsEachHeartbeatURL(t *testing.T) {
 	}))
 	defer server.Close()
 
-	Send(types.HeartbeatConfig{URLs: []string{server.URL, server.URL}})
+	Finish(types.HeartbeatConfig{URLs: []string{server.URL, server.URL}}, true, 0, "")
 
 	if got := atomic.LoadInt32(&hits); got != 2 {
 		t.Fatalf("hits = %d, want 2", got)
 	}
 }
+
+type recorder struct {
+	mu       sync.Mutex
+	requests []string
+	bodies   []string
+}
+
+func (rec *recorder) server(t *testing.T, fail int32) *httptest.Server {
+	t.Helper()
+
+	var failures int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, 1) <= fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		rec.mu.Lock()
+		rec.requests = append(rec.requests, r.Method+" "+r.URL.Path)
+		rec.bodies = append(rec.bodies, string(body))
+		rec.mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestStartAndFailure(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{}
+	server := rec.server(t, 0)
+	conf := types.HeartbeatConfig{URLs: []string{server.URL + "/ping/uuid"}, Start: true, Body: true}
+
+	Start(conf)
+	Finish(conf, false, 1, "1 of 2 backups failed")
+
+	expected := []string{"GET /ping/uuid/start", "POST /ping/uuid/fail"}
+	if strings.Join(rec.requests, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, got %v", expected, rec.requests)
+	}
+
+	if rec.bodies[1] != "1 of 2 backups failed" {
+		t.Errorf("unexpected body: %q", rec.bodies[1])
+	}
+}
+
+func TestExitStatusAndNone(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{}
+	server := rec.server(t, 0)
+
+	conf := types.HeartbeatConfig{URLs: []string{server.URL + "/uuid"}, Failure: FailureExitStatus}
+	Finish(conf, true, 1, "ignored without body")
+	Finish(conf, false, 0, "")
+
+	// no success ping for failed runs
+	conf.Failure = FailureNone
+	Finish(conf, false, 1, "")
+
+	expected := []string{"GET /uuid/0", "GET /uuid/1"}
+	if strings.Join(rec.requests, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, got %v", expected, rec.requests)
+	}
+}
+
+//nolint:paralleltest // shortens the package-global retry delay
+func TestRetries(t *testing.T) {
+	retryDelay = time.Millisecond
+	t.Cleanup(func() { retryDelay = time.Second })
+
+	rec := &recorder{}
+	server := rec.server(t, 2)
+
+	Finish(types.HeartbeatConfig{URLs: []string{server.URL}}, true, 0, "")
+
+	if len(rec.requests) != 1 {
+		t.Fatalf("expected the third try to succeed, got %v", rec.requests)
+	}
+
+	rec = &recorder{}
+	server = rec.server(t, 2)
+	retries := 1
+
+	Finish(types.HeartbeatConfig{URLs: []string{server.URL}, Retries: &retries}, true, 0, "")
+
+	if len(rec.requests) != 0 {
+		t.Fatalf("expected to give up after one retry, got %v", rec.requests)
+	}
+}
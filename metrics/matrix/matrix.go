@@ -0,0 +1,65 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+type message struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+// Notify sends msg to the Matrix room, the title is bold.
+func Notify(msg string, config types.MatrixConfig) error {
+	m := message{MsgType: "m.text", Body: msg}
+	if config.Title != "" {
+		m.Body = config.Title + "\n" + msg
+		m.Format = "org.matrix.custom.html"
+		m.FormattedBody = fmt.Sprintf("<strong>%s</strong><br>%s",
+			html.EscapeString(config.Title), strings.ReplaceAll(html.EscapeString(msg), "\n", "<br>"))
+	}
+
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// the transaction id makes retries of the same request idempotent
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/gickup-%d",
+		strings.TrimSuffix(config.Homeserver, "/"), url.PathEscape(config.RoomID), time.Now().UnixNano())
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.Token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		response, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return fmt.Errorf("received status %d from %s: %s", res.StatusCode, config.Homeserver, response)
+	}
+
+	return nil
+}
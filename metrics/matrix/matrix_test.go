@@ -0,0 +1,55 @@
+package matrix
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+func TestNotifySendsRoomMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method = %s, want PUT", r.Method)
+		}
+
+		if !strings.HasPrefix(r.URL.EscapedPath(), "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/") {
+			t.Errorf("unexpected path: %s", r.URL.EscapedPath())
+		}
+
+		if got := r.Header.Get("Authorization"); got != "Bearer secret-token" {
+			t.Errorf("unexpected authorization header: %q", got)
+		}
+
+		payload := message{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+
+		if payload.MsgType != "m.text" || payload.Body != "Backup failed\n<repo> failed" {
+			t.Errorf("unexpected payload: %#v", payload)
+		}
+
+		if payload.FormattedBody != "<strong>Backup failed</strong><br>&lt;repo&gt; failed" {
+			t.Errorf("unexpected formatted body: %q", payload.FormattedBody)
+		}
+
+		_, _ = w.Write([]byte(`{"event_id":"$event"}`))
+	}))
+	defer server.Close()
+
+	err := Notify("<repo> failed", types.MatrixConfig{
+		Homeserver:   server.URL + "/",
+		Token:        "secret-token",
+		RoomID:       "!room:example.org",
+		Notification: types.Notification{Title: "Backup failed"},
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+}
@@ -0,0 +1,352 @@
+// Package notify sends the summary of a backup run to the configured push
+// services.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cooperspencer/gickup/metrics/apprise"
+	"github.com/cooperspencer/gickup/metrics/discord"
+	"github.com/cooperspencer/gickup/metrics/email"
+	"github.com/cooperspencer/gickup/metrics/gotify"
+	"github.com/cooperspencer/gickup/metrics/matrix"
+	"github.com/cooperspencer/gickup/metrics/ntfy"
+	"github.com/cooperspencer/gickup/metrics/slack"
+	"github.com/cooperspencer/gickup/metrics/webhook"
+	"github.com/cooperspencer/gickup/types"
+	"github.com/rs/zerolog/log"
+)
+
+// Conditions of a push config.
+const (
+	// WhenAlways notifies after every run, it is the default.
+	WhenAlways = "always"
+	// WhenFailure notifies only after runs with failures.
+	WhenFailure = "failure"
+	// WhenChange notifies when the failed repositories differ from the
+	// previous run of the configuration.
+	WhenChange = "change"
+)
+
+// DefaultTitle is the title template used when a push config has none.
+const DefaultTitle = `Backup {{if .Success}}done{{else}}failed{{end}}`
+
+// DefaultMessage is the message template used when a push config has none.
+const DefaultMessage = `backup took {{.Duration}}
+{{- if not .Success}}, {{len .Failed}} of {{.Backups}} backups failed, {{.Errors}} errors logged (exit code {{.ExitCode}})
+{{- range .Failed}}
+- {{.Owner}}/{{.Repo}} to {{.Destination}} {{.URL}}: {{.Stage}} {{.Error}}
+{{- end}}
+{{- end}}
+{{- range .Events}}
+- {{.Owner}}/{{.Repo}}{{if .Ref}} {{.Ref}}{{end}} {{.Event}} upstream{{if .NewName}} to {{.NewName}}{{end}}, {{.Action}} on {{.Destination}} {{.URL}}{{if .Error}}: {{.Error}}{{end}}
+{{- end}}`
+
+// Failure is a failed backup of a repository to a destination.
+type Failure struct {
+	Hoster      string
+	Owner       string
+	Repo        string
+	Destination string
+	URL         string
+	Stage       string
+	Class       string
+	Error       string
+}
+
+// Event is a repository deleted or renamed upstream, or a ref of it
+// force-pushed or deleted, and the action a destination took on its backup.
+type Event struct {
+	Hoster string
+	Owner  string
+	Repo   string
+	// Ref is the branch or tag of ref events.
+	Ref string
+	// Event is deleted, renamed or force-pushed.
+	Event string
+	// NewName is the new name of renamed repositories.
+	NewName     string
+	Destination string
+	URL         string
+	Action      string
+	Error       string
+}
+
+// Summary describes a backup run, it is the data of the templates.
+type Summary struct {
+	Config    int
+	Start     time.Time
+	Duration  time.Duration
+	Repos     int
+	Backups   int
+	Succeeded int
+	Failed    []Failure
+	// Errors is the count of errors logged during the run.
+	Errors int64
+	// ExitCode is the exit code gickup reports, it stays set once an error
+	// was logged since startup.
+	ExitCode int32
+	// Changed is set when the failed repositories differ from the previous
+	// run, or repositories or their refs changed upstream.
+	Changed bool
+	// Events are the repositories deleted or renamed upstream, and the refs
+	// force-pushed or deleted.
+	Events []Event
+}
+
+// Success reports whether the run went through without failures and errors.
+func (s *Summary) Success() bool {
+	return len(s.Failed) == 0 && s.Errors == 0
+}
+
+// credentialsRx matches the credentials of URLs.
+var credentialsRx = regexp.MustCompile(`(\w+://)[^/@\s]+@`)
+
+// AddFailure records a failed backup of repo to a destination.
+func (s *Summary) AddFailure(repo types.Repo, destination, url, stage, class string, err error) {
+	failure := Failure{
+		Hoster:      repo.Hoster,
+		Owner:       repo.Owner,
+		Repo:        repo.Name,
+		Destination: destination,
+		URL:         url,
+		Stage:       stage,
+		Class:       class,
+	}
+
+	if err != nil {
+		failure.Error = credentialsRx.ReplaceAllString(err.Error(), "$1")
+	}
+
+	s.Failed = append(s.Failed, failure)
+}
+
+// AddEvent records the action a destination took on the backup of a
+// repository or ref changed upstream, err is the error of the action.
+func (s *Summary) AddEvent(event Event, err error) {
+	if err != nil {
+		event.Error = credentialsRx.ReplaceAllString(err.Error(), "$1")
+	}
+
+	s.Events = append(s.Events, event)
+}
+
+// AddAttempt counts a backup of a repository to a destination.
+func (s *Summary) AddAttempt(success bool) {
+	s.Backups++
+	if success {
+		s.Succeeded++
+	}
+}
+
+var (
+	previousMu sync.Mutex
+	previous   = map[int][]string{}
+)
+
+// Finish completes the summary at the end of a run and compares its failures
+// to the previous run of the same configuration.
+func (s *Summary) Finish(errors int64, exitCode int32) {
+	s.Duration = time.Since(s.Start)
+	s.Errors = errors
+	s.ExitCode = exitCode
+
+	failed := []string{}
+	for _, f := range s.Failed {
+		failed = append(failed, strings.Join([]string{f.Hoster, f.Owner, f.Repo, f.Destination, f.URL}, "/"))
+	}
+	slices.Sort(failed)
+	failed = slices.Compact(failed)
+	if s.Errors > 0 && len(failed) == 0 {
+		failed = append(failed, "errors")
+	}
+
+	previousMu.Lock()
+	defer previousMu.Unlock()
+
+	last, ok := previous[s.Config]
+	s.Changed = !ok || !slices.Equal(last, failed) || len(s.Events) > 0
+	previous[s.Config] = failed
+}
+
+// ShouldNotify reports whether a push config with the condition when is
+// notified about the run.
+func ShouldNotify(when string, s *Summary) (bool, error) {
+	switch strings.ToLower(when) {
+	case "", WhenAlways:
+		return true, nil
+	case WhenFailure:
+		return !s.Success(), nil
+	case WhenChange:
+		return s.Changed, nil
+	}
+
+	return false, fmt.Errorf("unknown condition %s, use always, failure or change", when)
+}
+
+// funcs are available in the templates.
+var funcs = template.FuncMap{
+	// json quotes a value for JSON bodies of webhooks
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+
+		return string(data), err
+	},
+}
+
+// Render executes the template text, or fallback if it is empty, with the
+// summary.
+func Render(text, fallback string, s *Summary) (string, error) {
+	if text == "" {
+		text = fallback
+	}
+
+	tmpl, err := template.New("notification").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, s); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// send renders the title and message of a push config and hands them to fn
+// if its condition is met.
+func send(push string, n types.Notification, s *Summary, fn func(title, msg string) error) {
+	ok, err := ShouldNotify(n.When, s)
+	if err != nil {
+		log.Warn().Str("push", push).Err(err).Msg("couldn't send message")
+
+		return
+	}
+
+	if !ok {
+		return
+	}
+
+	title, err := Render(n.Title, DefaultTitle, s)
+	if err != nil {
+		log.Warn().Str("push", push).Err(err).Msg("invalid title template")
+
+		return
+	}
+
+	msg, err := Render(n.Message, DefaultMessage, s)
+	if err != nil {
+		log.Warn().Str("push", push).Err(err).Msg("invalid message template")
+
+		return
+	}
+
+	if err := fn(title, msg); err != nil {
+		log.Warn().Str("push", push).Err(err).Msg("couldn't send message")
+	}
+}
+
+// webhookBody renders the body template of a webhook, by default the title,
+// message and summary as JSON.
+func webhookBody(body, title, msg string, s *Summary) (string, error) {
+	if body != "" {
+		return Render(body, "", s)
+	}
+
+	data, err := json.Marshal(struct {
+		Title   string   `json:"title"`
+		Message string   `json:"message"`
+		Success bool     `json:"success"`
+		Summary *Summary `json:"summary"`
+	}{title, msg, s.Success(), s})
+
+	return string(data), err
+}
+
+// Send notifies every push config whose condition is met about the run.
+func Send(conf types.PushConfigs, s *Summary) {
+	for _, pusher := range conf.Ntfy {
+		send("ntfy", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.ResolveToken()
+			p.Title = title
+
+			return ntfy.Notify(msg, p)
+		})
+	}
+
+	for _, pusher := range conf.Gotify {
+		send("gotify", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.ResolveToken()
+			p.Title = title
+
+			return gotify.Notify(msg, p)
+		})
+	}
+
+	for _, pusher := range conf.Apprise {
+		send("apprise", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.Title = title
+
+			return apprise.Notify(msg, p)
+		})
+	}
+
+	for _, pusher := range conf.Webhook {
+		send("webhook", pusher.Notification, s, func(title, msg string) error {
+			body, err := webhookBody(pusher.Body, title, msg, s)
+			if err != nil {
+				return err
+			}
+
+			return webhook.Notify(body, *pusher)
+		})
+	}
+
+	for _, pusher := range conf.SMTP {
+		send("smtp", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.Title = title
+
+			return email.Notify(msg, p)
+		})
+	}
+
+	for _, pusher := range conf.Slack {
+		send("slack", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.Title = title
+
+			return slack.Notify(msg, p)
+		})
+	}
+
+	for _, pusher := range conf.Discord {
+		send("discord", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.Title = title
+
+			return discord.Notify(msg, p)
+		})
+	}
+
+	for _, pusher := range conf.Matrix {
+		send("matrix", pusher.Notification, s, func(title, msg string) error {
+			p := *pusher
+			p.Title = title
+
+			return matrix.Notify(msg, p)
+		})
+	}
+}
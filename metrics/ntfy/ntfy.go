@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/cooperspencer/gickup/types"
@@ -21,7 +22,17 @@ func Notify(msg string, config types.PushConfig) error {
 	}
 
 	req.Header.Add("Content-Type", "text/plain")
-	req.Header.Add("Title", "Backup done")
+	title := config.Title
+	if title == "" {
+		title = "Backup done"
+	}
+	req.Header.Add("Title", title)
+	if config.Priority > 0 {
+		req.Header.Add("Priority", strconv.Itoa(config.Priority))
+	}
+	if len(config.Tags) > 0 {
+		req.Header.Add("Tags", strings.Join(config.Tags, ","))
+	}
 	if config.Email != "" {
 		req.Header.Add("Email", config.Email)
 	}
@@ -1,9 +1,15 @@
 package prometheus
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/cooperspencer/gickup/types"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -35,9 +41,10 @@ var JobsStarted = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "The count of scheduled jobs started since process startup",
 })
 
-var JobDuration = promauto.NewSummary(prometheus.SummaryOpts{
-	Name: "gickup_job_duration",
-	Help: "The duration of scheduled jobs started since process startup",
+var JobDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "gickup_job_duration",
+	Help:    "The duration of scheduled jobs started since process startup",
+	Buckets: prometheus.ExponentialBuckets(10, 2, 12),
 })
 
 var SourceBackupsComplete = promauto.NewCounterVec(prometheus.CounterOpts{
@@ -60,6 +67,174 @@ var RepoTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Help: "How long did the task take",
 }, []string{"hoster", "repository", "owner", "type", "path"})
 
+var RepoLastAttempt = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gickup_repo_last_attempt_timestamp_seconds",
+	Help: "When the last backup of the repository to the destination was attempted",
+}, []string{"hoster", "repository", "owner", "type", "path"})
+
+var RepoLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gickup_repo_last_success_timestamp_seconds",
+	Help: "When the repository was last backed up to the destination successfully",
+}, []string{"hoster", "repository", "owner", "type", "path"})
+
+var RepoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gickup_repo_duration_seconds",
+	Help:    "How long the backups of a repository to a destination take",
+	Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+}, []string{"type"})
+
+var RepoBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gickup_repo_bytes",
+	Help: "The size of the last backup of the repository uploaded to the destination",
+}, []string{"hoster", "repository", "owner", "type", "path"})
+
+var BytesTransferred = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gickup_transferred_bytes_total",
+	Help: "The bytes uploaded to destinations since process startup",
+}, []string{"type"})
+
+var RepoFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gickup_repo_failures_total",
+	Help: "The count of failed backups of the repository to the destination by stage and error class",
+}, []string{"hoster", "repository", "owner", "type", "path", "stage", "class"})
+
+var UpstreamEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gickup_upstream_events_total",
+	Help: "The count of repositories deleted or renamed upstream by the action the destination took and its result",
+}, []string{"hoster", "repository", "owner", "event", "type", "path", "action", "result"})
+
+var RewrittenRefs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gickup_rewritten_refs_total",
+	Help: "The count of branches and tags force-pushed or deleted upstream whose previous tips the destination kept",
+}, []string{"hoster", "repository", "owner", "type", "path", "change"})
+
+var IssuesBackedUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gickup_repo_issues",
+	Help: "The count of issues of the repository written in the last backup to a local destination",
+}, []string{"hoster", "repository", "owner", "type", "path"})
+
+var PullRequestsBackedUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gickup_repo_pullrequests",
+	Help: "The count of pull requests of the repository written in the last backup to a local destination",
+}, []string{"hoster", "repository", "owner", "type", "path"})
+
+var APIRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gickup_api_requests_total",
+	Help: "The count of requests sent to the API of a hoster",
+}, []string{"hoster", "code", "method"})
+
+var APIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gickup_api_request_duration_seconds",
+	Help:    "The latency of requests sent to the API of a hoster",
+	Buckets: prometheus.DefBuckets,
+}, []string{"hoster", "code", "method"})
+
+// Stages of a backup, used as the stage of RepoFailures.
+const (
+	StageTempdir = "tempdir"
+	StageClone   = "clone"
+	StageCreate  = "create"
+	StagePush    = "push"
+	StageZip     = "zip"
+	StageUpload  = "upload"
+	StageBackup  = "backup"
+	StageExport  = "export"
+	StageName    = "name"
+)
+
+// Classes of errors, used as the class of RepoFailures.
+const (
+	ClassAuth     = "auth"
+	ClassNotFound = "not_found"
+	ClassTimeout  = "timeout"
+	ClassNetwork  = "network"
+	ClassUnknown  = "unknown"
+)
+
+// ClassifyError returns the class of err for RepoFailures.
+func ClassifyError(err error) string {
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ClassUnknown
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return ClassAuth
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return ClassNotFound
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	case errors.As(err, &netErr):
+		return ClassNetwork
+	}
+
+	// the git command line only reports its errors as text
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "authentication failed"),
+		strings.Contains(msg, "could not read username"),
+		strings.Contains(msg, "permission denied"):
+		return ClassAuth
+	case strings.Contains(msg, "not found"),
+		strings.Contains(msg, "does not exist"):
+		return ClassNotFound
+	case strings.Contains(msg, "timed out"):
+		return ClassTimeout
+	case strings.Contains(msg, "could not resolve host"),
+		strings.Contains(msg, "connection refused"):
+		return ClassNetwork
+	}
+
+	return ClassUnknown
+}
+
+// Attempt records the outcome of backing up repo to a destination of type
+// kind at path that started at start.
+func Attempt(repo types.Repo, kind, path string, start time.Time, success bool) {
+	labels := []string{repo.Hoster, repo.Name, repo.Owner, kind, path}
+
+	RepoLastAttempt.WithLabelValues(labels...).Set(float64(start.Unix()))
+	RepoDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+
+	if success {
+		RepoLastSuccess.WithLabelValues(labels...).SetToCurrentTime()
+	}
+}
+
+// Failure counts a failed backup of repo to a destination.
+func Failure(repo types.Repo, kind, path, stage string, err error) {
+	RepoFailures.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, kind, path, stage, ClassifyError(err)).Inc()
+}
+
+// Bytes records the size of a backup of repo uploaded to a destination.
+func Bytes(repo types.Repo, kind, path string, n int64) {
+	RepoBytes.WithLabelValues(repo.Hoster, repo.Name, repo.Owner, kind, path).Set(float64(n))
+	BytesTransferred.WithLabelValues(kind).Add(float64(n))
+}
+
+// InstrumentTransport counts the requests of base to the API of hoster and
+// observes their latency.
+func InstrumentTransport(hoster string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	labels := prometheus.Labels{"hoster": hoster}
+
+	return promhttp.InstrumentRoundTripperCounter(APIRequests.MustCurryWith(labels),
+		promhttp.InstrumentRoundTripperDuration(APIRequestDuration.MustCurryWith(labels), base))
+}
+
+// InstrumentClient instruments the transport of client, see InstrumentTransport.
+func InstrumentClient(hoster string, client *http.Client) *http.Client {
+	client.Transport = InstrumentTransport(hoster, client.Transport)
+
+	return client
+}
+
 func Serve(conf types.PrometheusConfig) {
 	log.Info().
 		Str("listenAddr", conf.ListenAddr).
@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClassifyError(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{nil, ClassUnknown},
+		{fmt.Errorf("clone: %w", transport.ErrAuthenticationRequired), ClassAuth},
+		{transport.ErrRepositoryNotFound, ClassNotFound},
+		{fmt.Errorf("push: %w", context.DeadlineExceeded), ClassTimeout},
+		{&net.OpError{Op: "dial", Err: errors.New("no route to host")}, ClassNetwork},
+		{errors.New("fatal: Authentication failed for 'https://example.com/repo.git/'"), ClassAuth},
+		{errors.New("fatal: could not resolve host: example.com"), ClassNetwork},
+		{errors.New("disk full"), ClassUnknown},
+	} {
+		if class := ClassifyError(tc.err); class != tc.expected {
+			t.Errorf("%v: expected %s, got %s", tc.err, tc.expected, class)
+		}
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	t.Parallel()
+
+	repo := types.Repo{Hoster: "github.com", Name: "attempt", Owner: "alice"}
+	start := time.Now().Add(-time.Minute)
+
+	Attempt(repo, "s3", "https://s3.example.com", start, false)
+
+	attempt := testutil.ToFloat64(RepoLastAttempt.WithLabelValues("github.com", "attempt", "alice", "s3", "https://s3.example.com"))
+	if attempt != float64(start.Unix()) {
+		t.Errorf("expected last attempt %d, got %f", start.Unix(), attempt)
+	}
+
+	if testutil.ToFloat64(RepoLastSuccess.WithLabelValues("github.com", "attempt", "alice", "s3", "https://s3.example.com")) != 0 {
+		t.Error("a failed attempt set the last success")
+	}
+
+	Attempt(repo, "s3", "https://s3.example.com", start, true)
+
+	if testutil.ToFloat64(RepoLastSuccess.WithLabelValues("github.com", "attempt", "alice", "s3", "https://s3.example.com")) < float64(start.Unix()) {
+		t.Error("a successful attempt didn't set the last success")
+	}
+}
+
+func TestInstrumentClient(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := InstrumentClient("instrumented", &http.Client{})
+	for range 2 {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	if count := testutil.ToFloat64(APIRequests.WithLabelValues("instrumented", "404", "get")); count != 2 {
+		t.Errorf("expected 2 requests, got %f", count)
+	}
+}
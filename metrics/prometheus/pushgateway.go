@@ -0,0 +1,56 @@
+package prometheus
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cooperspencer/gickup/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gickupMetrics gathers the gickup_* metrics of the default registry, the
+// metrics of the go runtime and the process are left out.
+var gickupMetrics = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+	families, err := prometheus.DefaultGatherer.Gather()
+
+	filtered := []*dto.MetricFamily{}
+	for _, family := range families {
+		if strings.HasPrefix(family.GetName(), "gickup_") {
+			filtered = append(filtered, family)
+		}
+	}
+
+	return filtered, err
+})
+
+// Push sends the metrics to the pushgateway, grouped by job and instance.
+// With delete_on_success the group is deleted instead after a successful
+// run, so only failed runs remain on the pushgateway.
+func Push(conf types.PushgatewayConfig, success bool) error {
+	job := conf.Job
+	if job == "" {
+		job = "gickup"
+	}
+
+	instance := conf.Instance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+
+	pusher := push.New(conf.URL, job).Gatherer(gickupMetrics)
+	if instance != "" {
+		pusher = pusher.Grouping("instance", instance)
+	}
+
+	if conf.Username != "" || conf.Password != "" {
+		pusher = pusher.BasicAuth(conf.Username, conf.Password)
+	}
+
+	if conf.DeleteOnSuccess && success {
+		return pusher.Delete()
+	}
+
+	return pusher.Push()
+}
@@ -0,0 +1,83 @@
+package prometheus
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+type pushgateway struct {
+	mu       sync.Mutex
+	requests []string
+	body     string
+}
+
+func newPushgateway(t *testing.T) (*pushgateway, *httptest.Server) {
+	t.Helper()
+
+	gw := &pushgateway{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		gw.mu.Lock()
+		gw.requests = append(gw.requests, r.Method+" "+r.URL.Path)
+		gw.body = string(body)
+		gw.mu.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	return gw, server
+}
+
+func TestPushGroupsByJobAndInstance(t *testing.T) {
+	t.Parallel()
+
+	JobsStarted.Inc()
+
+	gw, server := newPushgateway(t)
+
+	err := Push(types.PushgatewayConfig{URL: server.URL, Job: "backup", Instance: "nas"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(gw.requests) != 1 || gw.requests[0] != "PUT /metrics/job/backup/instance/nas" {
+		t.Fatalf("unexpected requests: %v", gw.requests)
+	}
+
+	// the body is protobuf encoded, the names are readable nevertheless
+	if !strings.Contains(gw.body, "gickup_jobs_started") {
+		t.Error("gickup_jobs_started wasn't pushed")
+	}
+
+	if strings.Contains(gw.body, "go_goroutines") {
+		t.Error("runtime metrics were pushed")
+	}
+}
+
+func TestPushDeletesOnSuccess(t *testing.T) {
+	t.Parallel()
+
+	gw, server := newPushgateway(t)
+	conf := types.PushgatewayConfig{URL: server.URL, Instance: "nas", DeleteOnSuccess: true}
+
+	if err := Push(conf, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Push(conf, true); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"PUT /metrics/job/gickup/instance/nas", "DELETE /metrics/job/gickup/instance/nas"}
+	if strings.Join(gw.requests, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, gw.requests)
+	}
+}
@@ -0,0 +1,52 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+type message struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// Notify posts msg to the Slack incoming webhook, the title is bold.
+func Notify(msg string, config types.SlackConfig) error {
+	text := msg
+	if config.Title != "" {
+		text = fmt.Sprintf("*%s*\n%s", config.Title, msg)
+	}
+
+	body, err := json.Marshal(message{Text: text, Channel: config.Channel, Username: config.Username})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, config.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		response, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+		return fmt.Errorf("received status %d from slack: %s", res.StatusCode, response)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package slack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+func TestNotifySendsMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+
+		if payload["text"] != "*Backup failed*\n1 of 2 backups failed" || payload["channel"] != "#backups" {
+			t.Errorf("unexpected payload: %#v", payload)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	err := Notify("1 of 2 backups failed", types.SlackConfig{
+		Url:          server.URL,
+		Channel:      "#backups",
+		Notification: types.Notification{Title: "Backup failed"},
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+}
+
+func TestNotifyReturnsStatusError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("no_service"))
+	}))
+	defer server.Close()
+
+	if err := Notify("backup done", types.SlackConfig{Url: server.URL}); err == nil {
+		t.Fatal("expected status error")
+	}
+}
@@ -0,0 +1,209 @@
+// Package tracing exports the spans of backup runs via OTLP.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/cooperspencer/gickup"
+
+// the provider installed by Setup, nil when tracing is disabled.
+var provider *sdktrace.TracerProvider
+
+// Enabled reports whether conf or the standard OTLP environment variables
+// configure an endpoint.
+func Enabled(conf types.TracingConfig) bool {
+	return conf.Endpoint != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs the global tracer provider. A previous provider is flushed
+// and shut down, so Setup can be called again after a config reload.
+func Setup(ctx context.Context, conf types.TracingConfig) error {
+	if err := Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if !Enabled(conf) {
+		return nil
+	}
+
+	exporter, err := newExporter(ctx, conf)
+	if err != nil {
+		return err
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = "gickup"
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return err
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return nil
+}
+
+func newExporter(ctx context.Context, conf types.TracingConfig) (*otlptrace.Exporter, error) {
+	switch strings.ToLower(conf.Protocol) {
+	case "", "grpc":
+		opts := []otlptracegrpc.Option{}
+		if strings.Contains(conf.Endpoint, "://") {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(conf.Endpoint))
+		} else if conf.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(conf.Headers))
+		}
+
+		return otlptracegrpc.New(ctx, opts...)
+	case "http", "http/protobuf":
+		opts := []otlptracehttp.Option{}
+		if strings.Contains(conf.Endpoint, "://") {
+			opts = append(opts, otlptracehttp.WithEndpointURL(conf.Endpoint))
+		} else if conf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+		}
+
+		return otlptracehttp.New(ctx, opts...)
+	}
+
+	return nil, fmt.Errorf("unknown tracing protocol %s, use grpc or http", conf.Protocol)
+}
+
+// Flush exports all finished spans, it is called at the end of every run.
+func Flush(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return provider.ForceFlush(ctx)
+}
+
+// Shutdown flushes and stops the tracer provider installed by Setup.
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := provider.Shutdown(ctx)
+	provider = nil
+
+	return err
+}
+
+// Start starts a span, without Setup it is a no-op.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span and records err as its status.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Repo returns the attributes describing a repository.
+func Repo(repo types.Repo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("gickup.repo", repo.Name),
+		attribute.String("gickup.owner", repo.Owner),
+		attribute.String("gickup.hoster", repo.Hoster),
+	}
+}
+
+// Destination returns the attributes describing a destination.
+func Destination(kind, url string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("gickup.destination", kind),
+		attribute.String("gickup.destination.url", url),
+	}
+}
+
+// Bytes returns the attribute for the amount of data transferred.
+func Bytes(n int64) attribute.KeyValue {
+	return attribute.Int64("gickup.bytes", n)
+}
+
+// parentTransport makes the spans of requests without a span in their
+// context children of the span in ctx. Many API clients don't pass a context
+// to their requests. Requests outside of any span are not traced at all.
+type parentTransport struct {
+	ctx    context.Context
+	base   http.RoundTripper
+	traced http.RoundTripper
+}
+
+func (t parentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		parent := trace.SpanFromContext(t.ctx)
+		if !parent.SpanContext().IsValid() {
+			return t.base.RoundTrip(req)
+		}
+
+		req = req.WithContext(trace.ContextWithSpan(req.Context(), parent))
+	}
+
+	return t.traced.RoundTrip(req)
+}
+
+// Transport wraps base so every request becomes a span below the span in ctx.
+func Transport(ctx context.Context, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return parentTransport{ctx: ctx, base: base, traced: otelhttp.NewTransport(base)}
+}
+
+// Client returns an HTTP client whose requests are traced below the span in ctx.
+func Client(ctx context.Context) *http.Client {
+	return &http.Client{Transport: Transport(ctx, nil)}
+}
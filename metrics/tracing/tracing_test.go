@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+//nolint:paralleltest // replaces the global tracer provider
+func TestClientParentsRequestsWithoutContext(t *testing.T) {
+	recorder := recordSpans(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	ctx, span := Start(context.Background(), "github.get")
+
+	// like most API clients, the request doesn't carry ctx
+	resp, err := Client(ctx).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	if spans[0].Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("request span %q isn't a child of github.get", spans[0].Name())
+	}
+}
+
+//nolint:paralleltest // replaces the global tracer provider
+func TestClientSkipsRequestsOutsideOfSpans(t *testing.T) {
+	recorder := recordSpans(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("traceparent") != "" {
+			t.Error("untraced request propagated a trace")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	resp, err := Client(context.Background()).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("got %d spans, want none", len(spans))
+	}
+}
+
+//nolint:paralleltest // replaces the global tracer provider
+func TestEndRecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := Start(context.Background(), "destination s3")
+	End(span, errors.New("backup failed"))
+
+	_, span = Start(context.Background(), "destination local")
+	End(span, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	if spans[0].Status().Code != codes.Error || spans[0].Status().Description != "backup failed" {
+		t.Errorf("unexpected status of failed span: %+v", spans[0].Status())
+	}
+
+	if spans[1].Status().Code != codes.Unset {
+		t.Errorf("unexpected status of successful span: %+v", spans[1].Status())
+	}
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+func TestNotifySendsBodyAndHeaders(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method = %s, want PUT", r.Method)
+		}
+
+		if got := r.Header.Get("X-Api-Key"); got != "secret" {
+			t.Errorf("unexpected api key header: %q", got)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"text":"backup done"}` {
+			t.Errorf("unexpected body: %s", body)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	err := Notify(`{"text":"backup done"}`, types.WebhookConfig{
+		Url:     server.URL,
+		Method:  "put",
+		Headers: map[string]string{"X-Api-Key": "secret"},
+	})
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+}
+
+func TestNotifyReturnsStatusError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := Notify("{}", types.WebhookConfig{Url: server.URL}); err == nil {
+		t.Fatal("expected status error")
+	}
+}
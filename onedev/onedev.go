@@ -1,8 +1,10 @@
 package onedev
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -15,7 +17,10 @@ import (
 
 var sub zerolog.Logger
 
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+// Get gets the repositories of the OneDev sources of conf and reports whether
+// there were any. The onedev client always uses http.DefaultClient, so its
+// requests are neither traced nor counted in the API request metrics.
+func Get(_ context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 
@@ -30,9 +35,14 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
-		include := types.GetMap(repo.Include)
-		exclude := types.GetMap(repo.Exclude)
-		excludeorgs := types.GetMap(repo.ExcludeOrgs)
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
+		include := types.NewMatcher(repo.Include)
+		exclude := types.NewMatcher(repo.Exclude)
+		includeorgs := types.NewMatcher(repo.IncludeOrgs)
+		excludeorgs := types.NewMatcher(repo.ExcludeOrgs)
 
 		if repo.Password == "" && repo.Token != "" {
 			repo.Password = repo.Token
@@ -95,12 +105,12 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					continue
 				}
 			}
-			if exclude[r.Name] {
+			if exclude.MatchRepo(repo.User, r.Name) {
 				continue
 			}
 
-			if len(repo.Include) > 0 {
-				if !include[r.Name] {
+			if !include.Empty() {
+				if !include.MatchRepo(repo.User, r.Name) {
 					continue
 				}
 			}
@@ -122,14 +132,20 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 				continue
 			}
 
+			env := filterEnv(r, repo.User)
 			if len(commits) > 0 {
 				lastactive := time.UnixMicro(commits[0].Author.When)
 				if time.Since(lastactive) > repo.Filter.LastActivityDuration && repo.Filter.LastActivityDuration != 0 {
 					continue
 				}
+				env.LastActivity = lastactive
+			}
+			if !repo.Filter.Match(env) {
+				continue
 			}
 
 			repos = append(repos, types.Repo{
+				ID:          strconv.Itoa(r.ID),
 				Name:        r.Name,
 				URL:         urls.HTTP,
 				SSHURL:      urls.SSH,
@@ -138,12 +154,25 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 				Owner:       repo.User,
 				Hoster:      types.GetHost(repo.URL),
 				Description: r.Description,
-				Issues:      GetIssues(&r, client, repo, urls.HTTP),
+				Enrich:      enrich(&r, client, repo, urls.HTTP),
+				Metadata:    getMetadata(r),
 				NoTokenUser: true,
 			})
 		}
 
-		if repo.Username != "" && repo.Password != "" && len(repo.IncludeOrgs) == 0 && user.Name != "" {
+		// named organizations are queried directly, patterns are matched
+		// against the groups the user is a member of
+		orgs := []string{}
+		patterns := false
+		for _, org := range repo.IncludeOrgs {
+			if types.IsPattern(org) {
+				patterns = true
+			} else {
+				orgs = append(orgs, org)
+			}
+		}
+
+		if repo.Username != "" && repo.Password != "" && (len(repo.IncludeOrgs) == 0 || patterns) && user.Name != "" {
 			memberships, _, err := client.GetUserMemberships(user.ID)
 			if err != nil {
 				sub.Error().
@@ -156,14 +185,14 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					sub.Error().
 						Msgf("couldn't get group with id %d", membership.GroupID)
 				}
-				if !excludeorgs[group.Name] {
-					repo.IncludeOrgs = append(repo.IncludeOrgs, group.Name)
+				if !excludeorgs.Match(group.Name) && (includeorgs.Empty() || includeorgs.Match(group.Name)) && !slices.Contains(orgs, group.Name) {
+					orgs = append(orgs, group.Name)
 				}
 			}
 		}
 
-		if len(repo.IncludeOrgs) > 0 {
-			for _, org := range repo.IncludeOrgs {
+		if len(orgs) > 0 {
+			for _, org := range orgs {
 				query.Query = fmt.Sprintf("children of \"%s\"", org)
 
 				orgrepos, _, err := client.GetProjects(&query)
@@ -178,6 +207,15 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 							continue
 						}
 					}
+					if exclude.MatchRepo(org, r.Name) {
+						continue
+					}
+					if !include.Empty() && !include.MatchRepo(org, r.Name) {
+						continue
+					}
+					if !repo.Filter.Match(filterEnv(r, org)) {
+						continue
+					}
 					urls, _, err := client.GetCloneUrl(r.ID)
 					if err != nil {
 						sub.Error().
@@ -186,6 +224,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					}
 
 					repos = append(repos, types.Repo{
+						ID:          strconv.Itoa(r.ID),
 						Name:        r.Name,
 						URL:         urls.HTTP,
 						SSHURL:      urls.SSH,
@@ -194,7 +233,8 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 						Owner:       org,
 						Hoster:      types.GetHost(repo.URL),
 						Description: r.Description,
-						Issues:      GetIssues(&r, client, repo, urls.HTTP),
+						Enrich:      enrich(&r, client, repo, urls.HTTP),
+						Metadata:    getMetadata(r),
 						NoTokenUser: true,
 					})
 				}
@@ -268,7 +308,7 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 		}
 	}
 
-	project, _, err := client.CreateProject(&onedev.CreateProjectOptions{Name: repo.Name, ParentID: parentid, CodeManagement: true})
+	project, _, err := client.CreateProject(&onedev.CreateProjectOptions{Name: repo.Name, ParentID: parentid, CodeManagement: true, Description: repo.GetMetadata().Description})
 	if err != nil {
 		return "", err
 	}
@@ -281,6 +321,14 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	return cloneUrls.HTTP, nil
 }
 
+// enrich returns the function that fetches the issues of r, once it is known
+// that r is backed up.
+func enrich(r *onedev.Project, client *onedev.Client, conf types.GenRepo, repourl string) func(context.Context, *types.Repo) {
+	return func(_ context.Context, repo *types.Repo) {
+		repo.Issues = GetIssues(r, client, conf, repourl)
+	}
+}
+
 // GetIssues get issues
 func GetIssues(repo *onedev.Project, client *onedev.Client, conf types.GenRepo, repourl string) map[string]interface{} {
 	issues := map[string]interface{}{}
@@ -305,12 +353,12 @@ func GetIssues(repo *onedev.Project, client *onedev.Client, conf types.GenRepo,
 			} else {
 				if len(i) > 0 {
 					for _, issue := range i {
-						onedevissue := Issue{Issue: issue}
-						comments, _, err := client.GetIssueComments(onedevissue.ID)
+						onedevissue := types.NewIssue(issue)
+						comments, _, err := client.GetIssueComments(issue.ID)
 						if err != nil {
 							sub.Error().Err(err).Str("repo", repo.Name).Msg("can't fetch issues")
 						} else {
-							onedevissue.Comments = comments
+							onedevissue.Comments = types.List(comments)
 						}
 
 						issues[strconv.Itoa(issue.Number)] = onedevissue
@@ -325,8 +373,20 @@ func GetIssues(repo *onedev.Project, client *onedev.Client, conf types.GenRepo,
 	return issues
 }
 
-type Issue struct {
-	onedev.Issue
+// filterEnv get the attributes of a project for filter expressions
+func filterEnv(project onedev.Project, owner string) types.FilterEnv {
+	return types.FilterEnv{
+		Name:  project.Name,
+		Owner: owner,
+		Fork:  project.ForkedFromID != 0,
+	}
+}
 
-	Comments []onedev.Comment
+// getMetadata get the metadata of a project
+func getMetadata(project onedev.Project) *types.Metadata {
+	return &types.Metadata{
+		Description: project.Description,
+		Fork:        project.ForkedFromID != 0,
+		CreatedAt:   &project.CreateDate,
+	}
 }
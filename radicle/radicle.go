@@ -14,8 +14,10 @@ import (
 	"strings"
 
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/tracing"
 	"github.com/cooperspencer/gickup/types"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var sub zerolog.Logger
@@ -43,7 +45,7 @@ type payload struct {
 // Mirror pushes the repository cloned at tempdir into the Radicle storage
 // configured by d, initializing it with `rad init` on first sight. It returns
 // the RID of the mirror.
-func Mirror(repo types.Repo, dest types.Radicle, tempdir string) (string, error) {
+func Mirror(ctx context.Context, repo types.Repo, dest types.Radicle, tempdir string) (string, error) {
 	home, _ := Home()
 	sub = logger.CreateSubLogger("stage", "radicle", "home", home)
 
@@ -55,18 +57,18 @@ func Mirror(repo types.Repo, dest types.Radicle, tempdir string) (string, error)
 	// environment themselves, so the ambient environment is all they need.
 	env := os.Environ()
 
-	nid, err := nodeID(env)
+	nid, err := nodeID(ctx, env)
 	if err != nil {
 		return "", err
 	}
 
-	rid, err := scanStorage(repo, nid, env)
+	rid, err := scanStorage(ctx, repo, nid, env)
 	if err != nil {
 		return "", err
 	}
 
 	if rid == "" {
-		rid, err = initRepo(repo, dest, tempdir, env)
+		rid, err = initRepo(ctx, repo, dest, tempdir, env)
 		if err != nil {
 			return "", err
 		}
@@ -75,12 +77,12 @@ func Mirror(repo types.Repo, dest types.Radicle, tempdir string) (string, error)
 			Str("rid", fmt.Sprintf("rad:%s", rid)).
 			Msgf("initialized %s", types.Green(repo.Name))
 	} else if dest.Force || dest.Prune {
-		if err := fetchMirrorState(tempdir, rid, nid, env); err != nil {
+		if err := fetchMirrorState(ctx, tempdir, rid, nid, env); err != nil {
 			return "", err
 		}
 	}
 
-	if err := push(dest, tempdir, rid, nid, env); err != nil {
+	if err := push(ctx, dest, tempdir, rid, nid, env); err != nil {
 		return "", err
 	}
 
@@ -111,8 +113,8 @@ func probe() error {
 // so refs and signature update together. Pushes without force and prune are
 // fast-forward only, where the old targets are always present, so the fetch
 // is skipped.
-func fetchMirrorState(tempdir, rid, nid string, env []string) error {
-	_, err := run(tempdir, env, "git", "fetch", "--no-tags",
+func fetchMirrorState(ctx context.Context, tempdir, rid, nid string, env []string) error {
+	_, err := run(ctx, tempdir, env, "git", "fetch", "--no-tags",
 		fmt.Sprintf("rad://%s/%s", rid, nid),
 		"+refs/heads/*:refs/gickup/heads/*",
 		"+refs/tags/*:refs/gickup/tags/*")
@@ -123,13 +125,19 @@ func fetchMirrorState(tempdir, rid, nid string, env []string) error {
 // Home returns the profile's Radicle home as reported by `rad self --home`.
 // Propagates error accordingly, so it can be handled at call sites.
 func Home() (string, error) {
-	return run("", os.Environ(), "rad", "self", "--home")
+	return run(context.Background(), "", os.Environ(), "rad", "self", "--home")
 }
 
 // run executes name with args in dir, returning trimmed stdout. Stderr is
 // folded into the returned error.
-func run(dir string, env []string, name string, args ...string) (string, error) {
-	cmd := exec.CommandContext(context.Background(), name, args...)
+func run(ctx context.Context, dir string, env []string, name string, args ...string) (string, error) {
+	span := name
+	if len(args) > 0 {
+		span += " " + args[0]
+	}
+	ctx, s := tracing.Start(ctx, span, attribute.String("radicle.dir", dir))
+
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Dir = dir
 	cmd.Env = env
 
@@ -143,8 +151,12 @@ func run(dir string, env []string, name string, args ...string) (string, error)
 			msg = strings.TrimSpace(stdout.String())
 		}
 
-		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		err = fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		tracing.End(s, err)
+
+		return "", err
 	}
+	tracing.End(s, nil)
 
 	return strings.TrimSpace(stdout.String()), nil
 }
@@ -152,10 +164,10 @@ func run(dir string, env []string, name string, args ...string) (string, error)
 // nodeID returns the node ID of the configured profile, which namespaces the
 // push URL. `rad self --nid` is deprecated but still works without a running
 // node, so it is used as the fallback.
-func nodeID(env []string) (string, error) {
-	nid, err := run("", env, "rad", "node", "status", "--only", "nid")
+func nodeID(ctx context.Context, env []string) (string, error) {
+	nid, err := run(ctx, "", env, "rad", "node", "status", "--only", "nid")
 	if err != nil {
-		nid, err = run("", env, "rad", "self", "--nid")
+		nid, err = run(ctx, "", env, "rad", "self", "--nid")
 		if err != nil {
 			return "", err
 		}
@@ -202,8 +214,8 @@ func stripCredentials(upstream string) string {
 // that identity's delegates. The second check is what makes adoption
 // unforgeable: the source claim lives in the identity document, whose contents
 // are only authoritative because its delegates signed them.
-func scanStorage(repo types.Repo, nid string, env []string) (string, error) {
-	inspected, err := payloadsFor(env)
+func scanStorage(ctx context.Context, repo types.Repo, nid string, env []string) (string, error) {
+	inspected, err := payloadsFor(ctx, env)
 	if err != nil {
 		return "", err
 	}
@@ -212,7 +224,7 @@ func scanStorage(repo types.Repo, nid string, env []string) (string, error) {
 	source := stripCredentials(repo.URL)
 
 	for rid, p := range inspected {
-		if p.Gickup.Source == source && isDelegate(rid, nid, env) {
+		if p.Gickup.Source == source && isDelegate(ctx, rid, nid, env) {
 			matches = append(matches, rid)
 		}
 	}
@@ -232,8 +244,8 @@ func scanStorage(repo types.Repo, nid string, env []string) (string, error) {
 // isDelegate reports whether this profile's key (nid) is a delegate of the
 // stored repository's identity. We consider this enough evidence that the
 // information we read from the identity doc can be trusted.
-func isDelegate(rid, nid string, env []string) bool {
-	out, err := run("", env, "rad", "inspect", fmt.Sprintf("rad:%s", rid), "--delegates")
+func isDelegate(ctx context.Context, rid, nid string, env []string) bool {
+	out, err := run(ctx, "", env, "rad", "inspect", fmt.Sprintf("rad:%s", rid), "--delegates")
 	if err != nil {
 		return false
 	}
@@ -253,7 +265,7 @@ func isDelegate(rid, nid string, env []string) bool {
 // profile storage. The storage is inspected the first time a given RAD_HOME is asked
 // about and the result is cached, so the repeated scanStorage calls across a
 // run's repositories don't each re-inspect it.
-func payloadsFor(env []string) (map[string]payload, error) {
+func payloadsFor(ctx context.Context, env []string) (map[string]payload, error) {
 	home, err := Home()
 	if err != nil {
 		return nil, err
@@ -280,7 +292,7 @@ func payloadsFor(env []string) (map[string]payload, error) {
 			continue
 		}
 
-		out, err := run("", env, "rad", "inspect", fmt.Sprintf("rad:%s", entry.Name()), "--payload")
+		out, err := run(ctx, "", env, "rad", "inspect", fmt.Sprintf("rad:%s", entry.Name()), "--payload")
 		if err != nil {
 			sub.Debug().
 				Str("rid", fmt.Sprintf("rad:%s", entry.Name())).
@@ -306,8 +318,8 @@ func payloadsFor(env []string) (map[string]payload, error) {
 // identity in storage, and returns the new RID. The upstream URL is recorded
 // in a dev.gickup extension of the identity document `payload`, which is what
 // scanStorage matches on, on the next run.
-func initRepo(repo types.Repo, dest types.Radicle, tempdir string, env []string) (string, error) {
-	branch, err := run(tempdir, env, "git", "symbolic-ref", "--short", "HEAD")
+func initRepo(ctx context.Context, repo types.Repo, dest types.Radicle, tempdir string, env []string) (string, error) {
+	branch, err := run(ctx, tempdir, env, "git", "symbolic-ref", "--short", "HEAD")
 	if err != nil {
 		return "", err
 	}
@@ -319,7 +331,7 @@ func initRepo(repo types.Repo, dest types.Radicle, tempdir string, env []string)
 		return "", err
 	}
 
-	_, err = run(tempdir, env, "rad", "init",
+	_, err = run(ctx, tempdir, env, "rad", "init",
 		fmt.Sprintf("--name=%s", repo.Name),
 		fmt.Sprintf("--description=%s", description),
 		fmt.Sprintf("--default-branch=%s", branch),
@@ -329,7 +341,7 @@ func initRepo(repo types.Repo, dest types.Radicle, tempdir string, env []string)
 		return "", err
 	}
 
-	rid, err := run(tempdir, env, "rad", ".")
+	rid, err := run(ctx, tempdir, env, "rad", ".")
 	if err != nil {
 		return "", err
 	}
@@ -341,7 +353,7 @@ func initRepo(repo types.Repo, dest types.Radicle, tempdir string, env []string)
 		return rid, err
 	}
 
-	if err := recordMirrorSource(tempdir, env, source, rid); err != nil {
+	if err := recordMirrorSource(ctx, tempdir, env, source, rid); err != nil {
 		return rid, err
 	}
 
@@ -370,8 +382,8 @@ func updatePayloadCache(repo types.Repo, rid string) {
 // backup, and the error names the repository because the storage offers
 // no rollback for a created identity: the operator has to record the
 // source or remove the repository by hand.
-func recordMirrorSource(tempdir string, env []string, source []byte, rid string) error {
-	if _, err := run(tempdir, env, "rad", "id", "update",
+func recordMirrorSource(ctx context.Context, tempdir string, env []string, source []byte, rid string) error {
+	if _, err := run(ctx, tempdir, env, "rad", "id", "update",
 		"--payload", "dev.gickup", "source", string(source),
 		"--title", "Record mirror source",
 		"--no-confirm"); err != nil {
@@ -422,8 +434,8 @@ func pushArgs(dest types.Radicle, rid, nid string) []string {
 // push mirrors all branches and tags of the temporary clone into the profile's
 // namespace of the stored repository. The remote helper updates and signs
 // rad/sigrefs and announces to the node, so nothing else has to touch storage.
-func push(dest types.Radicle, tempdir, rid, nid string, env []string) error {
-	_, err := run(tempdir, env, "git", pushArgs(dest, rid, nid)...)
+func push(ctx context.Context, dest types.Radicle, tempdir, rid, nid string, env []string) error {
+	_, err := run(ctx, tempdir, env, "git", pushArgs(dest, rid, nid)...)
 
 	return err
 }
@@ -0,0 +1,453 @@
+// Package releases stores the releases of repositories with their assets.
+// Assets are downloaded once into a cache addressed by their SHA-256 checksum
+// and linked into the destinations, so unchanged assets aren't downloaded
+// or stored again on the next run. The cache is pruned to MaxSize after every
+// run.
+package releases
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+// CacheDir is the directory of the downloaded assets, by default gickup/assets
+// in the user's cache directory.
+var CacheDir = defaultCacheDir()
+
+// MaxSize is the size in bytes Prune shrinks the cache to.
+var MaxSize int64
+
+// mu guards the cache, its index and used.
+var mu sync.Mutex
+
+// used are the times the cached assets were used by this process.
+var used = map[string]time.Time{}
+
+// Setup applies the cache configuration.
+func Setup(conf types.AssetCache) error {
+	CacheDir = defaultCacheDir()
+	if conf.Dir != "" {
+		CacheDir = conf.Dir
+	}
+
+	MaxSize = 0
+	if conf.MaxSize != "" {
+		size, err := types.ParseSize(conf.MaxSize)
+		if err != nil {
+			return fmt.Errorf("assetcache maxsize: %w", err)
+		}
+		MaxSize = size * 1024
+	}
+
+	return nil
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "gickup", "assets")
+}
+
+// indexFile maps the keys of assets to their checksums.
+func indexFile() string {
+	return filepath.Join(CacheDir, "index.json")
+}
+
+func loadIndex() map[string]string {
+	index := map[string]string{}
+
+	data, err := os.ReadFile(indexFile())
+	if err == nil {
+		_ = json.Unmarshal(data, &index)
+	}
+
+	return index
+}
+
+func saveIndex(index map[string]string) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(indexFile(), data, 0o644)
+}
+
+// usesFile holds the times the cached assets were last used.
+func usesFile() string {
+	return filepath.Join(CacheDir, "used.json")
+}
+
+func loadUses() map[string]time.Time {
+	uses := map[string]time.Time{}
+
+	data, err := os.ReadFile(usesFile())
+	if err == nil {
+		_ = json.Unmarshal(data, &uses)
+	}
+
+	for sum, at := range used {
+		uses[sum] = at
+	}
+
+	return uses
+}
+
+// cached returns the path of the cached content with the checksum sum if it
+// exists and has the expected size.
+func cached(sum string, size int64) (string, bool) {
+	if sum == "" {
+		return "", false
+	}
+
+	path := filepath.Join(CacheDir, sum)
+	info, err := os.Stat(path)
+	if err != nil || (size > 0 && info.Size() != size) {
+		return "", false
+	}
+	used[sum] = time.Now()
+
+	return path, true
+}
+
+// Fetch returns the path of the asset in the cache. It is only downloaded if
+// neither its checksum nor its key are known from an earlier download. The
+// checksum of the asset is set.
+func Fetch(ctx context.Context, asset *types.Asset) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if path, ok := cached(asset.SHA256, asset.Size); ok {
+		return path, nil
+	}
+
+	index := loadIndex()
+	if path, ok := cached(index[asset.Key], asset.Size); ok && asset.Key != "" {
+		asset.SHA256 = index[asset.Key]
+
+		return path, nil
+	}
+
+	if asset.Open == nil {
+		return "", fmt.Errorf("asset %s can't be downloaded", asset.Name)
+	}
+
+	if err := os.MkdirAll(CacheDir, 0o755); err != nil {
+		return "", err
+	}
+
+	sum, err := download(ctx, asset)
+	if err != nil {
+		return "", err
+	}
+
+	asset.SHA256 = sum
+	used[sum] = time.Now()
+	if asset.Key != "" {
+		index[asset.Key] = sum
+		if err := saveIndex(index); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Join(CacheDir, sum), nil
+}
+
+// download writes the asset into the cache and returns its checksum.
+func download(ctx context.Context, asset *types.Asset) (string, error) {
+	body, err := asset.Open(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(CacheDir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if asset.Size > 0 && n != asset.Size {
+		return "", fmt.Errorf("asset %s is incomplete, got %d of %d bytes", asset.Name, n, asset.Size)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if asset.SHA256 != "" && asset.SHA256 != sum {
+		return "", fmt.Errorf("checksum of asset %s doesn't match, got %s, want %s", asset.Name, sum, asset.SHA256)
+	}
+
+	// keep the cached file of identical content, it may be linked already
+	if _, err := os.Stat(filepath.Join(CacheDir, sum)); err == nil {
+		return sum, nil
+	}
+
+	return sum, os.Rename(tmp.Name(), filepath.Join(CacheDir, sum))
+}
+
+// Prune removes the least recently used assets from the cache until it holds
+// at most MaxSize bytes. The assets stored in destinations aren't affected,
+// they are links or copies. It must not run while assets are fetched or
+// stored.
+func Prune() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entries, err := os.ReadDir(CacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		sum  string
+		size int64
+		used time.Time
+	}
+
+	uses := loadUses()
+	files := []file{}
+	total := int64(0)
+	for _, entry := range entries {
+		// the cached assets are named after their checksum
+		if len(entry.Name()) != sha256.Size*2 || !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		at, ok := uses[entry.Name()]
+		if !ok {
+			at = info.ModTime()
+		}
+
+		files = append(files, file{sum: entry.Name(), size: info.Size(), used: at})
+		total += info.Size()
+	}
+
+	slices.SortFunc(files, func(a, b file) int {
+		return a.used.Compare(b.used)
+	})
+
+	errs := []error{}
+	kept := map[string]bool{}
+	for _, f := range files {
+		if total <= MaxSize {
+			kept[f.sum] = true
+
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(CacheDir, f.sum)); err != nil {
+			errs = append(errs, err)
+			kept[f.sum] = true
+
+			continue
+		}
+		total -= f.size
+	}
+
+	index := loadIndex()
+	for key, sum := range index {
+		if !kept[sum] {
+			delete(index, key)
+		}
+	}
+	for sum := range uses {
+		if !kept[sum] {
+			delete(uses, sum)
+		}
+	}
+	clear(used)
+
+	if err := saveIndex(index); err != nil {
+		errs = append(errs, err)
+	}
+
+	data, err := json.Marshal(uses)
+	if err == nil {
+		err = os.WriteFile(usesFile(), data, 0o644)
+	}
+
+	return errors.Join(append(errs, err)...)
+}
+
+// Link places the cached file src at dst, as a hard link if possible.
+func Link(src, dst string) error {
+	if info, err := os.Stat(dst); err == nil {
+		srcInfo, err := os.Stat(src)
+		if err == nil && os.SameFile(info, srcInfo) {
+			return nil
+		}
+
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+
+		return err
+	}
+
+	return out.Close()
+}
+
+// Dir returns the directory of the releases of the repository name in path.
+func Dir(path, name string) string {
+	return filepath.Join(path, fmt.Sprintf("%s.releases", name))
+}
+
+// Write stores every release of repo in its own directory below Dir, named
+// after the escaped tag. release.json holds the metadata, the assets are
+// stored in the assets directory next to it.
+// Assets that fail are skipped, their errors are returned together. It
+// returns the count of stored assets.
+func Write(ctx context.Context, path string, repo types.Repo) (int, error) {
+	stored := 0
+	errs := []error{}
+
+	for _, release := range repo.Releases {
+		dir := filepath.Join(Dir(path, repo.Name), url.PathEscape(release.TagName))
+		if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o777); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		previous := storedAssets(dir)
+		for i := range release.Assets {
+			// the checksum is kept in the repo for the other destinations
+			asset := &release.Assets[i]
+
+			name := filepath.Base(asset.Name)
+			dst := filepath.Join(dir, "assets", name)
+			// assets were stored next to release.json before, move them
+			if info, err := os.Lstat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() && name != "release.json" {
+				_ = os.Rename(filepath.Join(dir, name), dst)
+			}
+
+			if sum, ok := unchanged(previous[asset.Name], *asset, dst); ok {
+				asset.SHA256 = sum
+				stored++
+
+				continue
+			}
+
+			src, err := Fetch(ctx, asset)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("release %s: %w", release.TagName, err))
+
+				continue
+			}
+
+			if err := Link(src, dst); err != nil {
+				errs = append(errs, err)
+
+				continue
+			}
+
+			stored++
+		}
+
+		data, err := json.MarshalIndent(release, "", "  ")
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "release.json"), data, 0o644); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return stored, errors.Join(errs...)
+}
+
+// storedAssets returns the assets in the release.json of the release
+// directory dir by name.
+func storedAssets(dir string) map[string]types.Asset {
+	assets := map[string]types.Asset{}
+
+	data, err := os.ReadFile(filepath.Join(dir, "release.json"))
+	if err != nil {
+		return assets
+	}
+
+	release := types.Release{}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return assets
+	}
+
+	for _, asset := range release.Assets {
+		assets[asset.Name] = asset
+	}
+
+	return assets
+}
+
+// unchanged returns the checksum of the asset stored at path by an earlier
+// run if it is the same asset at the hoster, so it doesn't need to be fetched
+// even if it isn't cached anymore.
+func unchanged(previous, asset types.Asset, path string) (string, bool) {
+	if previous.SHA256 == "" || previous.URL != asset.URL || previous.Size != asset.Size {
+		return "", false
+	}
+
+	if asset.SHA256 != "" && asset.SHA256 != previous.SHA256 {
+		return "", false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != previous.Size {
+		return "", false
+	}
+
+	return previous.SHA256, true
+}
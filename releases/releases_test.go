@@ -0,0 +1,222 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cooperspencer/gickup/types"
+)
+
+// asset returns an asset with content, downloads counts its downloads.
+func asset(name, key, content string, downloads *int) types.Asset {
+	return types.Asset{
+		Name: name,
+		Size: int64(len(content)),
+		Key:  key,
+		Open: func(context.Context) (io.ReadCloser, error) {
+			*downloads++
+
+			return io.NopCloser(strings.NewReader(content)), nil
+		},
+	}
+}
+
+func useCache(t *testing.T) {
+	t.Helper()
+
+	previous := CacheDir
+	CacheDir = t.TempDir()
+	t.Cleanup(func() { CacheDir = previous })
+}
+
+//nolint:paralleltest // replaces the global cache directory
+func TestWriteDeduplicatesAssets(t *testing.T) {
+	useCache(t)
+
+	downloads := 0
+	repo := types.Repo{
+		Name: "website",
+		Releases: []types.Release{
+			{TagName: "v1.0.0", Assets: []types.Asset{asset("website.tar.gz", "1", "first", &downloads)}},
+			// the same content attached to another release
+			{TagName: "release/v1.0.1", Assets: []types.Asset{asset("website.tar.gz", "2", "first", &downloads)}},
+		},
+	}
+
+	path := t.TempDir()
+	stored, err := Write(context.Background(), path, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored != 2 || downloads != 2 {
+		t.Fatalf("stored %d assets with %d downloads, want 2 and 2", stored, downloads)
+	}
+
+	first, err := os.Stat(filepath.Join(path, "website.releases", "v1.0.0", "assets", "website.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := os.Stat(filepath.Join(path, "website.releases", "release%2Fv1.0.1", "assets", "website.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !os.SameFile(first, second) {
+		t.Error("identical assets are stored twice")
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, "website.releases", "v1.0.0", "release.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := types.Release{}
+	if err := json.Unmarshal(data, &release); err != nil {
+		t.Fatal(err)
+	}
+
+	// sha256 of "first"
+	if release.Assets[0].SHA256 != "a7937b64b8caa58f03721bb6bacf5c78cb235febe0e70b1b84cd99541461a08e" {
+		t.Errorf("unexpected checksum in %s", data)
+	}
+
+	// the next run downloads nothing
+	downloads = 0
+	repo.Releases[0].Assets = []types.Asset{asset("website.tar.gz", "1", "first", &downloads)}
+	repo.Releases[1].Assets = []types.Asset{asset("website.tar.gz", "2", "first", &downloads)}
+	if _, err := Write(context.Background(), t.TempDir(), repo); err != nil {
+		t.Fatal(err)
+	}
+
+	if downloads != 0 {
+		t.Errorf("downloaded %d unchanged assets again", downloads)
+	}
+
+	// assets stored in the destination aren't downloaded without the cache
+	if err := Prune(); err != nil {
+		t.Fatal(err)
+	}
+	repo.Releases[0].Assets = []types.Asset{asset("website.tar.gz", "1", "first", &downloads)}
+	repo.Releases[1].Assets = []types.Asset{asset("website.tar.gz", "2", "first", &downloads)}
+	if _, err := Write(context.Background(), path, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	if downloads != 0 || repo.Releases[0].Assets[0].SHA256 == "" {
+		t.Errorf("downloaded %d stored assets again", downloads)
+	}
+}
+
+//nolint:paralleltest // replaces the global cache directory
+func TestFetchVerifiesAssets(t *testing.T) {
+	useCache(t)
+
+	downloads := 0
+	incomplete := asset("website.tar.gz", "1", "first", &downloads)
+	incomplete.Size = 100
+
+	if _, err := Fetch(context.Background(), &incomplete); err == nil {
+		t.Error("expected an error for an incomplete download")
+	}
+
+	tampered := asset("website.tar.gz", "2", "first", &downloads)
+	tampered.SHA256 = strings.Repeat("0", 64)
+
+	if _, err := Fetch(context.Background(), &tampered); err == nil {
+		t.Error("expected an error for a wrong checksum")
+	}
+
+	files, err := os.ReadDir(CacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 0 {
+		t.Errorf("failed downloads left %d files in the cache", len(files))
+	}
+}
+
+//nolint:paralleltest // replaces the global cache directory
+func TestWriteKeepsMetadata(t *testing.T) {
+	useCache(t)
+
+	downloads := 0
+	repo := types.Repo{
+		Name: "website",
+		Releases: []types.Release{
+			{TagName: "v1.0.0", Name: "first release", Assets: []types.Asset{asset("release.json", "1", "asset", &downloads)}},
+		},
+	}
+
+	path := t.TempDir()
+	if _, err := Write(context.Background(), path, repo); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, "website.releases", "v1.0.0", "release.json"))
+	if err != nil || !strings.Contains(string(data), "first release") {
+		t.Errorf("the metadata was overwritten: %q, %v", data, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(path, "website.releases", "v1.0.0", "assets", "release.json"))
+	if err != nil || string(data) != "asset" {
+		t.Errorf("the asset wasn't stored: %q, %v", data, err)
+	}
+}
+
+//nolint:paralleltest // replaces the global cache directory
+func TestPrune(t *testing.T) {
+	useCache(t)
+
+	previous := MaxSize
+	t.Cleanup(func() { MaxSize = previous })
+
+	downloads := 0
+	old := asset("old.tar.gz", "1", "old asset", &downloads)
+	recent := asset("recent.tar.gz", "2", "recent asset", &downloads)
+	for _, a := range []*types.Asset{&old, &recent} {
+		if _, err := Fetch(context.Background(), a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used[old.SHA256] = used[old.SHA256].Add(-time.Hour)
+
+	// the cache holds one asset
+	MaxSize = recent.Size
+	if err := Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cached(old.SHA256, old.Size); ok {
+		t.Error("the least recently used asset was kept")
+	}
+	if _, ok := cached(recent.SHA256, recent.Size); !ok {
+		t.Error("the recently used asset was removed")
+	}
+
+	// the index forgets the removed asset, it is downloaded again
+	downloads = 0
+	old.SHA256 = ""
+	if _, err := Fetch(context.Background(), &old); err != nil || downloads != 1 {
+		t.Errorf("expected one download, got %d, %v", downloads, err)
+	}
+
+	MaxSize = 0
+	if err := Prune(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range []types.Asset{old, recent} {
+		if _, ok := cached(a.SHA256, a.Size); ok {
+			t.Errorf("%s is still cached", a.Name)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cooperspencer/gickup/logger"
 	"github.com/cooperspencer/gickup/types"
@@ -112,3 +113,49 @@ func DeleteObjectsNotInRepo(directory, bucketdir string, s3repo types.S3Repo) er
 
 	return nil
 }
+
+// Move moves the objects of the repository named from, with everything stored
+// next to it, to the name to.
+func Move(s3repo types.S3Repo, from, to string) (int, error) {
+	sub = logger.CreateSubLogger("stage", "s3", "endpoint", s3repo.Endpoint, "bucket", s3repo.Bucket)
+	client, err := minio.New(s3repo.Endpoint, &minio.Options{
+		Creds:  getCredentials(s3repo),
+		Secure: s3repo.UseSSL,
+		Region: s3repo.Region,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	keys := []string{}
+	for object := range client.ListObjects(ctx, s3repo.Bucket, minio.ListObjectsOptions{
+		Prefix:    from,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return 0, object.Err
+		}
+
+		if types.StoredAs(object.Key, from) {
+			keys = append(keys, object.Key)
+		}
+	}
+
+	for _, key := range keys {
+		target := to + strings.TrimPrefix(key, from)
+		sub.Debug().Msgf("Moving %s to %s in bucket %s", key, target, s3repo.Bucket)
+		_, err := client.CopyObject(ctx,
+			minio.CopyDestOptions{Bucket: s3repo.Bucket, Object: target},
+			minio.CopySrcOptions{Bucket: s3repo.Bucket, Object: key})
+		if err != nil {
+			return 0, err
+		}
+
+		if err := client.RemoveObject(ctx, s3repo.Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(keys), nil
+}
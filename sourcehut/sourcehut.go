@@ -7,10 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/metrics/prometheus"
+	"github.com/cooperspencer/gickup/metrics/tracing"
 	"github.com/cooperspencer/gickup/types"
 	graphqlclient "github.com/hasura/go-graphql-client"
 	"github.com/rs/zerolog"
@@ -50,9 +53,9 @@ func graphQLEndpoint(rawURL string) string {
 	return fmt.Sprintf("%s/query", normalizeURL(rawURL))
 }
 
-func newGraphQLClient(endpoint, token string) *graphqlclient.Client {
+func newGraphQLClient(ctx context.Context, endpoint, token string) *graphqlclient.Client {
 	token = normalizeBearerToken(token)
-	client := graphqlclient.NewClient(endpoint, &http.Client{})
+	client := graphqlclient.NewClient(endpoint, prometheus.InstrumentClient("sourcehut", tracing.Client(ctx)))
 	if token != "" {
 		client = client.WithRequestModifier(func(r *http.Request) {
 			r.Header.Set("Authorization", "Bearer "+token)
@@ -61,9 +64,9 @@ func newGraphQLClient(endpoint, token string) *graphqlclient.Client {
 	return client
 }
 
-func execGraphQL(endpoint, token, query string, variables map[string]interface{}, dataTarget interface{}) error {
-	client := newGraphQLClient(endpoint, token)
-	raw, err := client.ExecRaw(context.Background(), query, variables)
+func execGraphQL(ctx context.Context, endpoint, token, query string, variables map[string]interface{}, dataTarget interface{}) error {
+	client := newGraphQLClient(ctx, endpoint, token)
+	raw, err := client.ExecRaw(ctx, query, variables)
 	if err != nil {
 		return err
 	}
@@ -76,14 +79,14 @@ func execGraphQL(endpoint, token, query string, variables map[string]interface{}
 	return json.Unmarshal(raw, dataTarget)
 }
 
-func resolveSourcehutUsername(endpoint, token, configuredUser string) (string, error) {
+func resolveSourcehutUsername(ctx context.Context, endpoint, token, configuredUser string) (string, error) {
 	if configuredUser != "" {
 		return strings.TrimPrefix(configuredUser, "~"), nil
 	}
 
 	query := `query { me { username } }`
 	response := queryMe{}
-	if err := execGraphQL(endpoint, token, query, nil, &response); err != nil {
+	if err := execGraphQL(ctx, endpoint, token, query, nil, &response); err != nil {
 		return "", err
 	}
 
@@ -94,7 +97,7 @@ func resolveSourcehutUsername(endpoint, token, configuredUser string) (string, e
 	return response.Me.Username, nil
 }
 
-func getRepositoriesForUser(endpoint, token, username string) ([]repository, error) {
+func getRepositoriesForUser(ctx context.Context, endpoint, token, username string) ([]repository, error) {
 	query := `query($username: String!, $cursor: Cursor) {
 		user(username: $username) {
 			repositories(cursor: $cursor) {
@@ -124,7 +127,7 @@ func getRepositoriesForUser(endpoint, token, username string) ([]repository, err
 		}
 
 		response := queryUser{}
-		if err := execGraphQL(endpoint, token, query, variables, &response); err != nil {
+		if err := execGraphQL(ctx, endpoint, token, query, variables, &response); err != nil {
 			return nil, err
 		}
 
@@ -143,7 +146,7 @@ func getRepositoriesForUser(endpoint, token, username string) ([]repository, err
 	return allRepos, nil
 }
 
-func getRepositoryByName(endpoint, token, username, repoName string) (*repository, error) {
+func getRepositoryByName(ctx context.Context, endpoint, token, username, repoName string) (*repository, error) {
 	if username != "" {
 		query := `query($username: String!, $name: String!) {
 			user(username: $username) {
@@ -163,7 +166,7 @@ func getRepositoryByName(endpoint, token, username, repoName string) (*repositor
 			"name":     repoName,
 		}
 
-		if err := execGraphQL(endpoint, token, query, variables, &response); err != nil {
+		if err := execGraphQL(ctx, endpoint, token, query, variables, &response); err != nil {
 			return nil, err
 		}
 
@@ -188,14 +191,14 @@ func getRepositoryByName(endpoint, token, username, repoName string) (*repositor
 
 	response := queryMe{}
 	variables := map[string]interface{}{"name": repoName}
-	if err := execGraphQL(endpoint, token, query, variables, &response); err != nil {
+	if err := execGraphQL(ctx, endpoint, token, query, variables, &response); err != nil {
 		return nil, err
 	}
 
 	return response.Me.Repository, nil
 }
 
-func createRepository(endpoint, token string, repo types.Repo, visibility string) (*repository, error) {
+func createRepository(ctx context.Context, endpoint, token string, repo types.Repo, visibility string) (*repository, error) {
 	query := `mutation($name: String!, $visibility: Visibility!, $description: String) {
 		createRepository(name: $name, visibility: $visibility, description: $description) {
 			id
@@ -210,10 +213,10 @@ func createRepository(endpoint, token string, repo types.Repo, visibility string
 	variables := map[string]interface{}{
 		"name":        repo.Name,
 		"visibility":  visibility,
-		"description": repo.Description,
+		"description": repo.GetMetadata().Description,
 	}
 
-	if err := execGraphQL(endpoint, token, query, variables, &response); err != nil {
+	if err := execGraphQL(ctx, endpoint, token, query, variables, &response); err != nil {
 		return nil, err
 	}
 
@@ -244,7 +247,7 @@ func buildSSHURL(baseURL, canonicalOwner, repoName string) string {
 }
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(ctx context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	for _, repo := range conf.Source.Sourcehut {
@@ -256,13 +259,17 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			sub.Warn().
 				Msg(err.Error())
 		}
+		if err := repo.Filter.Compile(); err != nil {
+			sub.Error().Err(err).Msg("invalid filter expression")
+			continue
+		}
 		ran = true
 
 		endpoint := graphQLEndpoint(repo.URL)
 
 		token := repo.GetToken()
 
-		repo.User, err = resolveSourcehutUsername(endpoint, token, repo.User)
+		repo.User, err = resolveSourcehutUsername(ctx, endpoint, token, repo.User)
 		if err != nil {
 			sub.Error().
 				Msg(err.Error())
@@ -272,10 +279,10 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 		sub.Info().
 			Msgf("grabbing repositories from %s", repo.User)
 
-		include := types.GetMap(repo.Include)
-		exclude := types.GetMap(repo.Exclude)
+		include := types.NewMatcher(repo.Include)
+		exclude := types.NewMatcher(repo.Exclude)
 
-		repositories, err := getRepositoriesForUser(endpoint, token, repo.User)
+		repositories, err := getRepositoriesForUser(ctx, endpoint, token, repo.User)
 		if err != nil {
 			sub.Error().
 				Msg(err.Error())
@@ -306,12 +313,17 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 			ownerName := strings.TrimPrefix(ownerCanonicalName, "~")
 			isPrivate := strings.EqualFold(r.Visibility, "PRIVATE") || strings.EqualFold(r.Visibility, "private")
 
-			if exclude[r.Name] {
+			if !repo.Filter.Match(filterEnv(r, ownerName)) {
+				continue
+			}
+
+			if exclude.MatchRepo(ownerName, r.Name) {
 				continue
 			}
 
-			if include[r.Name] {
+			if include.MatchRepo(ownerName, r.Name) {
 				repos = append(repos, types.Repo{
+					ID:          strconv.Itoa(r.ID),
 					Name:        r.Name,
 					URL:         repoURL,
 					SSHURL:      sshURL,
@@ -321,6 +333,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     isPrivate,
+					Metadata:    getMetadata(r),
 				})
 				if repo.Wiki {
 					repos = append(repos, types.Repo{
@@ -339,8 +352,9 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 				continue
 			}
 
-			if len(include) == 0 {
+			if include.Empty() {
 				repos = append(repos, types.Repo{
+					ID:          strconv.Itoa(r.ID),
 					Name:        r.Name,
 					URL:         repoURL,
 					SSHURL:      sshURL,
@@ -350,6 +364,7 @@ func Get(conf *types.Conf) ([]types.Repo, bool) {
 					Hoster:      types.GetHost(repo.URL),
 					Description: r.Description,
 					Private:     isPrivate,
+					Metadata:    getMetadata(r),
 				})
 				if repo.Wiki {
 					repos = append(repos, types.Repo{
@@ -379,14 +394,15 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 	token := destination.GetToken()
 	endpoint := graphQLEndpoint(destination.URL)
 	configuredUser := strings.TrimPrefix(destination.User, "~")
+	ctx := context.Background()
 
-	remoteRepo, err := getRepositoryByName(endpoint, token, configuredUser, repo.Name)
+	remoteRepo, err := getRepositoryByName(ctx, endpoint, token, configuredUser, repo.Name)
 	if err != nil {
 		return "", err
 	}
 
 	if remoteRepo == nil {
-		remoteRepo, err = createRepository(endpoint, token, repo, mapVisibilityToGraphQLEnum(destination.Visibility.Repositories))
+		remoteRepo, err = createRepository(ctx, endpoint, token, repo, mapVisibilityToGraphQLEnum(destination.Visibility.Repositories))
 		if err != nil {
 			return "", err
 		}
@@ -398,3 +414,31 @@ func GetOrCreate(destination types.GenRepo, repo types.Repo) (string, error) {
 
 	return buildSSHURL(destination.URL, remoteRepo.Owner.CanonicalName, repo.Name), nil
 }
+
+// filterEnv get the attributes of a repository for filter expressions
+func filterEnv(repo repository, owner string) types.FilterEnv {
+	return types.FilterEnv{
+		Name:         repo.Name,
+		Owner:        owner,
+		Visibility:   strings.ToLower(repo.Visibility),
+		LastActivity: repo.Updated,
+	}
+}
+
+// getMetadata get the metadata of a repository
+func getMetadata(repo repository) *types.Metadata {
+	meta := &types.Metadata{
+		Description: repo.Description,
+		Visibility:  strings.ToLower(repo.Visibility),
+	}
+
+	if !repo.Created.IsZero() {
+		meta.CreatedAt = &repo.Created
+	}
+
+	if !repo.Updated.IsZero() {
+		meta.UpdatedAt = &repo.Updated
+	}
+
+	return meta
+}
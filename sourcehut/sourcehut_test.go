@@ -1,6 +1,7 @@
 package sourcehut
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -76,7 +77,7 @@ func TestNormalizeHelpers(t *testing.T) {
 func TestResolveSourcehutUsernameUsesConfiguredUser(t *testing.T) {
 	t.Parallel()
 
-	got, err := resolveSourcehutUsername("https://unused.invalid/query", "ignored", "~alice")
+	got, err := resolveSourcehutUsername(context.Background(), "https://unused.invalid/query", "ignored", "~alice")
 	if err != nil {
 		t.Fatalf("resolveSourcehutUsername() error = %v", err)
 	}
@@ -102,7 +103,7 @@ func TestResolveSourcehutUsernameQueriesGraphQL(t *testing.T) {
 	})
 	defer server.Close()
 
-	got, err := resolveSourcehutUsername(server.URL+"/query", "Token secret-token", "")
+	got, err := resolveSourcehutUsername(context.Background(), server.URL+"/query", "Token secret-token", "")
 	if err != nil {
 		t.Fatalf("resolveSourcehutUsername() error = %v", err)
 	}
@@ -161,7 +162,7 @@ func TestGetRepositoriesForUserPaginates(t *testing.T) {
 	})
 	defer server.Close()
 
-	repos, err := getRepositoriesForUser(server.URL+"/query", "secret-token", "alice")
+	repos, err := getRepositoriesForUser(context.Background(), server.URL+"/query", "secret-token", "alice")
 	if err != nil {
 		t.Fatalf("getRepositoriesForUser() error = %v", err)
 	}
@@ -197,7 +198,7 @@ func TestCreateRepository(t *testing.T) {
 	})
 	defer server.Close()
 
-	repo, err := createRepository(server.URL+"/query", "secret-token", types.Repo{Name: "repo-one", Description: "mirror"}, "PRIVATE")
+	repo, err := createRepository(context.Background(), server.URL+"/query", "secret-token", types.Repo{Name: "repo-one", Description: "mirror"}, "PRIVATE")
 	if err != nil {
 		t.Fatalf("createRepository() error = %v", err)
 	}
@@ -246,7 +247,7 @@ func TestGetBuildsRepositoriesAndWikiMirrors(t *testing.T) {
 		},
 	}
 
-	repos, ran := Get(conf)
+	repos, ran := Get(context.Background(), conf)
 	if !ran {
 		t.Fatal("expected sourcehut adapter to run")
 	}
@@ -0,0 +1,170 @@
+// Package state keeps data between runs of gickup, like the names given to
+// repositories, as JSON files.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Dir is the directory of the state files, by default gickup/state in the
+// user's config directory. The state has to survive between runs, the
+// repositories would look new or gone otherwise.
+var Dir = defaultDir()
+
+// Dry keeps Save from writing anything, for dry runs.
+var Dry bool
+
+// mu guards the state files.
+var mu sync.Mutex
+
+func defaultDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "gickup", "state")
+}
+
+// legacyDir is where earlier versions kept the state.
+func legacyDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "gickup", "state")
+}
+
+// Setup sets Dir to dir, or to the default if dir is empty. The state of
+// earlier versions in the user's cache directory is moved there if Dir
+// doesn't exist yet.
+func Setup(dir string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	Dir = defaultDir()
+	if dir != "" {
+		Dir = dir
+	}
+
+	return migrate(legacyDir(), Dir)
+}
+
+// migrate moves the state files in from to to if to doesn't exist.
+func migrate(from, to string) error {
+	if _, err := os.Stat(to); !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	files, err := os.ReadDir(from)
+	if err != nil || from == to {
+		return nil
+	}
+
+	if err := os.MkdirAll(to, 0o755); err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, f := range files {
+		if !f.Type().IsRegular() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(from, f.Name()))
+		if err == nil {
+			err = os.WriteFile(filepath.Join(to, f.Name()), data, 0o644)
+		}
+		if err == nil {
+			err = os.Remove(filepath.Join(from, f.Name()))
+		}
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Lock takes the lock of the state name, it waits until no other run, in
+// this or another process, holds it. The returned function releases it.
+func Lock(name string) (func(), error) {
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(Dir, name+".lock"), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lock(f); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	// closing the file releases the lock
+	return func() { f.Close() }, nil
+}
+
+func file(name string) string {
+	return filepath.Join(Dir, name+".json")
+}
+
+// Load reads the state name into v. v is left as it is if there is no state
+// yet.
+func Load(name string, v any) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := os.ReadFile(file(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Save replaces the state name with v.
+func Save(name string, v any) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if Dry {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(Dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(Dir, "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file(name))
+}
@@ -0,0 +1,121 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//nolint:paralleltest // replaces the global state directory
+func TestLoadAndSave(t *testing.T) {
+	previous := Dir
+	Dir = filepath.Join(t.TempDir(), "state")
+	t.Cleanup(func() { Dir = previous })
+
+	names := map[string]string{"a": "untouched"}
+	if err := Load("names", &names); err != nil {
+		t.Fatal(err)
+	}
+
+	if names["a"] != "untouched" {
+		t.Errorf("missing state changed the value: %v", names)
+	}
+
+	if err := Save("names", map[string]string{"b": "saved"}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := map[string]string{}
+	if err := Load("names", &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 1 || loaded["b"] != "saved" {
+		t.Errorf("unexpected state: %v", loaded)
+	}
+
+	files, err := os.ReadDir(Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 {
+		t.Errorf("expected only the state file, got %d files", len(files))
+	}
+}
+
+//nolint:paralleltest // replaces the global state directory
+func TestLock(t *testing.T) {
+	previous := Dir
+	Dir = t.TempDir()
+	t.Cleanup(func() { Dir = previous })
+
+	unlock, err := Lock("repos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := Lock("repos")
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("the lock was taken twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case unlock := <-locked:
+		unlock()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't released")
+	}
+}
+
+//nolint:paralleltest // replaces the global state directory
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "cache")
+	if err := os.MkdirAll(legacy, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(legacy, "gists.json"), []byte(`{"1": "notes"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := Dir
+	Dir = filepath.Join(dir, "state")
+	t.Cleanup(func() { Dir = previous })
+
+	if err := migrate(legacy, Dir); err != nil {
+		t.Fatal(err)
+	}
+
+	aliases := map[string]string{}
+	if err := Load("gists", &aliases); err != nil || aliases["1"] != "notes" {
+		t.Errorf("the state wasn't moved: %v, %v", aliases, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(legacy, "gists.json")); !os.IsNotExist(err) {
+		t.Errorf("the previous state is still there: %v", err)
+	}
+
+	// an existing state isn't replaced
+	if err := os.WriteFile(filepath.Join(legacy, "gists.json"), []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(legacy, Dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load("gists", &aliases); err != nil || aliases["1"] != "notes" {
+		t.Errorf("the state was replaced: %v, %v", aliases, err)
+	}
+}
@@ -0,0 +1,291 @@
+// Package tracking follows repositories between runs by their ID on the
+// hoster, to find the ones deleted or renamed upstream. Every config document
+// has a state of its own, in which every source entry tracks the
+// repositories it found.
+package tracking
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/cooperspencer/gickup/logger"
+	"github.com/cooperspencer/gickup/state"
+	"github.com/cooperspencer/gickup/types"
+	"github.com/rs/zerolog"
+)
+
+var sub zerolog.Logger
+
+// stateName is the name of the state of the tracked repositories.
+const stateName = "repos"
+
+// Events of tracked repositories.
+const (
+	Deleted = "deleted"
+	Renamed = "renamed"
+)
+
+// Entry is a repository as it was seen last.
+type Entry struct {
+	Source string `json:"source"`
+	// Scope is the source entry that found the repository.
+	Scope  string `json:"scope,omitempty"`
+	Hoster string `json:"hoster"`
+	Owner  string `json:"owner"`
+	Name   string `json:"name"`
+	// URL and SSHURL are the clone URLs without credentials.
+	URL    string `json:"url"`
+	SSHURL string `json:"ssh_url,omitempty"`
+	// Stored are the names of the repository on the destinations it was
+	// backed up to, by Location.
+	Stored   map[string]string `json:"stored,omitempty"`
+	LastSeen time.Time         `json:"last_seen"`
+}
+
+// Repo returns the repository as it was seen last.
+func (e Entry) Repo() types.Repo {
+	return types.Repo{
+		Name:   e.Name,
+		Owner:  e.Owner,
+		Hoster: e.Hoster,
+		URL:    e.URL,
+		SSHURL: e.SSHURL,
+		Source: e.Source,
+	}
+}
+
+// Event is a repository deleted or renamed upstream.
+type Event struct {
+	// Kind is Deleted or Renamed.
+	Kind string
+	// Previous is the repository as it was seen last.
+	Previous Entry
+	// Repo is the renamed repository.
+	Repo types.Repo
+}
+
+// Tracker follows the repositories found in a run.
+type Tracker struct {
+	// name is the state the tracker is stored in, nothing is stored if it is
+	// empty.
+	name    string
+	unlock  func()
+	entries map[string]*Entry
+	seen    map[string]bool
+	// via are repositories found in the run by source entry, their
+	// credentials confirm deletions.
+	via map[string]types.Repo
+	// unclean are the sources that logged errors while finding repositories,
+	// repositories they missed aren't deleted.
+	unclean map[string]bool
+	// Exists reports whether the repository of e still answers upstream,
+	// with the credentials of via.
+	Exists func(e Entry, via types.Repo) bool
+}
+
+// New returns a tracker without tracked repositories.
+func New() *Tracker {
+	sub = logger.CreateSubLogger("stage", "upstream")
+
+	return &Tracker{
+		name:    stateName,
+		entries: map[string]*Entry{},
+		seen:    map[string]bool{},
+		via:     map[string]types.Repo{},
+		unclean: map[string]bool{},
+		Exists:  exists,
+	}
+}
+
+// Load locks the state of the config document with the key document, see
+// types.Source.StateKey, and returns a tracker with the repositories tracked
+// by its previous runs. The lock is held until Close, overlapping runs of the
+// document wait for each other. If the state can't be locked, the tracker
+// doesn't store anything.
+func Load(document string) (*Tracker, error) {
+	t := New()
+	t.name = stateName + "-" + document
+
+	unlock, err := state.Lock(t.name)
+	if err != nil {
+		t.name = ""
+
+		return t, err
+	}
+	t.unlock = unlock
+
+	return t, state.Load(t.name, &t.entries)
+}
+
+// Save stores the tracked repositories for the next run.
+func (t *Tracker) Save() error {
+	if t.name == "" {
+		return nil
+	}
+
+	return state.Save(t.name, t.entries)
+}
+
+// Close releases the lock of the state.
+func (t *Tracker) Close() {
+	if t.unlock != nil {
+		t.unlock()
+		t.unlock = nil
+	}
+}
+
+// Key identifies a repository across renames, it is empty if its source
+// doesn't know the ID of the repository.
+func Key(r types.Repo) string {
+	if r.ID == "" {
+		return ""
+	}
+
+	return r.Hoster + "/" + r.ID
+}
+
+// scopedKey is the key of the repository in the state, every source entry
+// tracks the repositories it found.
+func scopedKey(r types.Repo) string {
+	key := Key(r)
+	if key == "" || r.Origin.Scope == "" {
+		return key
+	}
+
+	return r.Origin.Scope + " " + key
+}
+
+// viaKey identifies the source entry of a repository in via.
+func viaKey(kind, hoster, scope string) string {
+	if scope != "" {
+		return scope
+	}
+
+	return kind + " " + hoster
+}
+
+// Location identifies the destination of type kind at location in Stored.
+func Location(kind, location string) string {
+	return kind + " " + redact(location)
+}
+
+// Found tracks the repositories a source of type kind found, clean is false
+// if the source logged errors. It returns the repositories renamed since the
+// previous run.
+func (t *Tracker) Found(kind string, repos []types.Repo, clean bool) []Event {
+	if !clean {
+		t.unclean[kind] = true
+	}
+
+	events := []Event{}
+	for _, r := range repos {
+		key := scopedKey(r)
+		if key == "" {
+			continue
+		}
+
+		t.seen[key] = true
+		via := viaKey(kind, r.Hoster, r.Origin.Scope)
+		if _, ok := t.via[via]; !ok {
+			t.via[via] = r
+		}
+
+		e, ok := t.entries[key]
+		if !ok {
+			e = &Entry{Stored: map[string]string{}}
+			t.entries[key] = e
+		} else if e.Owner != r.Owner || e.Name != r.Name {
+			previous := *e
+			previous.Stored = maps.Clone(e.Stored)
+			events = append(events, Event{Kind: Renamed, Previous: previous, Repo: r})
+
+			// the backups under the old name are handled by the event
+			e.Stored = map[string]string{}
+		}
+
+		e.Source = kind
+		e.Scope = r.Origin.Scope
+		e.Hoster = r.Hoster
+		e.Owner = r.Owner
+		e.Name = r.Name
+		e.URL = redact(r.URL)
+		e.SSHURL = redact(r.SSHURL)
+		e.LastSeen = time.Now()
+	}
+
+	return events
+}
+
+// Stored records the name of the repository on the destination of type kind
+// at location.
+func (t *Tracker) Stored(r types.Repo, kind, location, name string) {
+	e, ok := t.entries[scopedKey(r)]
+	if !ok {
+		return
+	}
+
+	if e.Stored == nil {
+		e.Stored = map[string]string{}
+	}
+	e.Stored[Location(kind, location)] = name
+}
+
+// Gone returns the repositories deleted upstream since the previous run and
+// stops tracking them. Repositories are only deleted if their source entry
+// found repositories without errors in this run, and they don't answer
+// anymore. The ones that still answer were left out by the config and
+// are forgotten.
+func (t *Tracker) Gone() []Event {
+	events := []Event{}
+
+	for _, key := range slices.Sorted(maps.Keys(t.entries)) {
+		e := t.entries[key]
+		if t.seen[key] || t.unclean[e.Source] {
+			continue
+		}
+
+		via, ok := t.via[viaKey(e.Source, e.Hoster, e.Scope)]
+		if !ok {
+			continue
+		}
+
+		delete(t.entries, key)
+
+		if t.Exists(*e, via) {
+			sub.Info().
+				Str("repo", e.Name).
+				Msgf("%s/%s isn't backed up anymore, forgetting it", e.Owner, e.Name)
+
+			continue
+		}
+
+		events = append(events, Event{Kind: Deleted, Previous: *e})
+	}
+
+	return events
+}
+
+// exists lists the refs of the repository of e with the credentials of via.
+func exists(e Entry, via types.Repo) bool {
+	origin := via.Origin
+	if via.Token != "" {
+		origin.Token = via.Token
+	}
+
+	return types.RemoteExists(e.URL, e.SSHURL, origin)
+}
+
+// redact removes the credentials of URLs, nothing with credentials is
+// written to the state.
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+
+	u.User = nil
+
+	return u.String()
+}
@@ -1,14 +1,28 @@
 package types
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -56,21 +70,28 @@ func (dest Destination) Count() int {
 // the profile in RAD_HOME. When that key has a passphrase, export it in the
 // RAD_PASSPHRASE environment variable, which rad reads itself.
 type Radicle struct {
-	Force      bool   `yaml:"force"`      // overwrite diverged refs on the mirror (non-fast-forward updates)
-	Prune      bool   `yaml:"prune"`      // delete refs on the mirror that no longer exist upstream
-	Visibility string `yaml:"visibility"` // public, private or source, default: source
-	Issues     bool   `yaml:"issues"`     // [NOT YET SUPPORTED] recreate upstream issues as radicle issues (source must also fetch them with issues: true)
+	Name         string  `yaml:"name"`         // name of the destination for routing
+	Routes       []Route `yaml:"routes"`       // only mirror the repositories matching one of them
+	NameTemplate string  `yaml:"nametemplate"` // name of the mirrored repositories, see RenderName
+	Force        bool    `yaml:"force"`        // overwrite diverged refs on the mirror (non-fast-forward updates)
+	Prune        bool    `yaml:"prune"`        // delete refs on the mirror that no longer exist upstream
+	Visibility   string  `yaml:"visibility"`   // public, private or source, default: source
+	Issues       bool    `yaml:"issues"`       // [NOT YET SUPPORTED] recreate upstream issues as radicle issues (source must also fetch them with issues: true)
 }
 
 // Local TODO.
 type Local struct {
-	Bare       bool   `yaml:"bare"`
-	Mirror     bool   `yaml:"mirror" default:"false"`
-	Path       string `yaml:"path"`
-	Structured bool   `yaml:"structured"`
-	Zip        bool   `yaml:"zip"`
-	Keep       int    `yaml:"keep"`
-	LFS        bool   `yaml:"lfs"`
+	Name         string  `yaml:"name"`
+	Routes       []Route `yaml:"routes"`
+	NameTemplate string  `yaml:"nametemplate"`
+	Bare         bool    `yaml:"bare"`
+	Mirror       bool    `yaml:"mirror" default:"false"`
+	Path         string  `yaml:"path"`
+	Structured   bool    `yaml:"structured"`
+	Zip          bool    `yaml:"zip"`
+	Keep         int     `yaml:"keep"`
+	LFS          bool    `yaml:"lfs"`
+	Upstream     `yaml:",inline"`
 }
 
 // Conf TODO.
@@ -80,34 +101,79 @@ type Conf struct {
 	Cron        string      `yaml:"cron"`
 	Log         Logging     `yaml:"log"`
 	Metrics     Metrics     `yaml:"metrics"`
+	AssetCache  AssetCache  `yaml:"assetcache"`
+	// StateDir keeps the state between runs, like the tracked repositories.
+	// It is gickup/state in the user's config directory if it is empty.
+	StateDir string `yaml:"statedir"`
+}
+
+// AssetCache configures the cache of downloaded release assets.
+type AssetCache struct {
+	// Dir is gickup/assets in the user's cache directory if it is empty.
+	Dir string `yaml:"dir"`
+	// MaxSize is the size the cache is pruned to after every run, like 5GB.
+	// The cache is emptied if it isn't set.
+	MaxSize string `yaml:"maxsize"`
 }
 
 // PrometheusConfig TODO.
 type PrometheusConfig struct {
-	ListenAddr string `yaml:"listen_addr"`
-	Endpoint   string `yaml:"endpoint"`
+	ListenAddr  string            `yaml:"listen_addr"`
+	Endpoint    string            `yaml:"endpoint"`
+	Pushgateway PushgatewayConfig `yaml:"pushgateway"`
+}
+
+// PushgatewayConfig configures pushing the metrics at the end of every run.
+type PushgatewayConfig struct {
+	URL             string `yaml:"url"`
+	Job             string `yaml:"job"`
+	Instance        string `yaml:"instance"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password" secret:"true"`
+	DeleteOnSuccess bool   `yaml:"delete_on_success"`
 }
 
 // HeartbeatConfig TODO.
 type HeartbeatConfig struct {
-	URLs []string `yaml:"urls"`
+	URLs []string `yaml:"urls" secret:"true"`
+	// Start pings <url>/start when a run begins.
+	Start bool `yaml:"start"`
+	// Failure is how failed runs are signaled: fail pings <url>/fail,
+	// exit-status pings <url>/<exit status> after every run, none doesn't
+	// ping at all.
+	Failure string `yaml:"failure"`
+	// Body posts the summary of the run instead of a GET.
+	Body    bool `yaml:"body"`
+	Retries *int `yaml:"retries"`
 }
 
 // PushConfig TODO.
 type PushConfig struct {
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Token    string `yaml:"token"`
-	Email    string `yaml:"email"`
-	Url      string `yaml:"url"`
+	User         string `yaml:"user"`
+	Password     string `yaml:"password" secret:"true"`
+	Token        string `yaml:"token" secret:"true"`
+	Email        string `yaml:"email"`
+	Url          string `yaml:"url"`
+	Notification `yaml:",inline"`
+	Priority     int      `yaml:"priority"`
+	Tags         []string `yaml:"tags"`
 }
 
 // AppriseConfig TODO
 type AppriseConfig struct {
-	Url    string   `yaml:"url"`
-	Tags   []string `yaml:"tags"`
-	Config string   `yaml:"config"`
-	Urls   []string `yaml:"notification_urls"`
+	Url          string   `yaml:"url"`
+	Tags         []string `yaml:"tags"`
+	Config       string   `yaml:"config"`
+	Urls         []string `yaml:"notification_urls" secret:"true"`
+	Notification `yaml:",inline"`
+}
+
+// Notification configures when a push config is notified and the templates
+// of its title and message.
+type Notification struct {
+	When    string `yaml:"when"`
+	Title   string `yaml:"title"`
+	Message string `yaml:"message"`
 }
 
 func (p *PushConfig) ResolveToken() {
@@ -131,11 +197,62 @@ func resolve(value string) string {
 	return value
 }
 
+// WebhookConfig sends the run summary as JSON, or the rendered body
+// template, to any URL.
+type WebhookConfig struct {
+	Url          string            `yaml:"url" secret:"true"`
+	Method       string            `yaml:"method"`
+	Headers      map[string]string `yaml:"headers" secret:"true"`
+	Body         string            `yaml:"body"`
+	Notification `yaml:",inline"`
+}
+
+// SMTPConfig sends the notifications as email.
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password" secret:"true"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	// TLS is starttls (default), tls or none.
+	TLS          string `yaml:"tls"`
+	Notification `yaml:",inline"`
+}
+
+// SlackConfig posts to a Slack incoming webhook.
+type SlackConfig struct {
+	Url          string `yaml:"url" secret:"true"`
+	Channel      string `yaml:"channel"`
+	Username     string `yaml:"username"`
+	Notification `yaml:",inline"`
+}
+
+// DiscordConfig posts to a Discord webhook.
+type DiscordConfig struct {
+	Url          string `yaml:"url" secret:"true"`
+	Username     string `yaml:"username"`
+	Notification `yaml:",inline"`
+}
+
+// MatrixConfig sends a message to a Matrix room.
+type MatrixConfig struct {
+	Homeserver   string `yaml:"homeserver"`
+	Token        string `yaml:"token" secret:"true"`
+	RoomID       string `yaml:"room_id"`
+	Notification `yaml:",inline"`
+}
+
 // PushConfigs TODO.
 type PushConfigs struct {
 	Ntfy    []*PushConfig    `yaml:"ntfy"`
 	Gotify  []*PushConfig    `yaml:"gotify"`
 	Apprise []*AppriseConfig `yaml:"apprise"`
+	Webhook []*WebhookConfig `yaml:"webhook"`
+	SMTP    []*SMTPConfig    `yaml:"smtp"`
+	Slack   []*SlackConfig   `yaml:"slack"`
+	Discord []*DiscordConfig `yaml:"discord"`
+	Matrix  []*MatrixConfig  `yaml:"matrix"`
 }
 
 // Metrics TODO.
@@ -143,11 +260,23 @@ type Metrics struct {
 	Prometheus  PrometheusConfig `yaml:"prometheus"`
 	Heartbeat   HeartbeatConfig  `yaml:"heartbeat"`
 	PushConfigs PushConfigs      `yaml:"push"`
+	Tracing     TracingConfig    `yaml:"tracing"`
+}
+
+// TracingConfig configures the OTLP trace export.
+type TracingConfig struct {
+	Endpoint    string            `yaml:"endpoint"`
+	Protocol    string            `yaml:"protocol"`
+	Insecure    bool              `yaml:"insecure"`
+	Headers     map[string]string `yaml:"headers" secret:"true"`
+	ServiceName string            `yaml:"service_name"`
 }
 
 // Logging TODO.
 type Logging struct {
 	Timeformat  string      `yaml:"timeformat"`
+	Format      string      `yaml:"format"`
+	Level       string      `yaml:"level"`
 	FileLogging FileLogging `yaml:"file-logging"`
 }
 
@@ -156,6 +285,8 @@ type FileLogging struct {
 	Dir    string `yaml:"dir"`
 	File   string `yaml:"file"`
 	MaxAge int    `yaml:"maxage"`
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
 }
 
 // CheckAllValuesOrNone TODO.
@@ -248,6 +379,70 @@ type Source struct {
 	Any       []GenRepo `yaml:"any"`
 }
 
+// SetScopes sets the Scope of every entry to its kind and a hash of the
+// settings that select its repositories, without secrets. Entries that only
+// differ in their secrets are told apart by their position.
+func (source *Source) SetScopes() {
+	kinds := map[string][]GenRepo{
+		"gogs": source.Gogs, "gitlab": source.Gitlab, "github": source.Github, "gitea": source.Gitea,
+		"bitbucket": source.BitBucket, "onedev": source.OneDev, "sourcehut": source.Sourcehut, "any": source.Any,
+	}
+
+	for kind, entries := range kinds {
+		seen := map[string]int{}
+		for i := range entries {
+			e := &entries[i]
+			hash := sha256.Sum256([]byte(strings.Join([]string{
+				e.URL, e.User, e.Username, e.Organization, e.Name, e.TokenFile, e.SSHKey,
+				strconv.FormatInt(e.AppID, 10), strconv.FormatInt(e.AppInstallationID, 10),
+			}, "\x00")))
+			id := hex.EncodeToString(hash[:8])
+
+			e.Scope = fmt.Sprintf("%s/%s/%d", kind, id, seen[id])
+			seen[id]++
+		}
+	}
+}
+
+// StateKey identifies the document of the source in the state kept between
+// runs by the Scopes of its entries, so documents keep their state when they
+// are reordered. Documents with the same source entries share it. Call
+// SetScopes first.
+func (source Source) StateKey() string {
+	scopes := []string{}
+	for _, entries := range [][]GenRepo{
+		source.Gogs, source.Gitlab, source.Github, source.Gitea,
+		source.BitBucket, source.OneDev, source.Sourcehut, source.Any,
+	} {
+		for _, e := range entries {
+			scopes = append(scopes, e.Scope)
+		}
+	}
+	slices.Sort(scopes)
+
+	hash := sha256.Sum256([]byte(strings.Join(scopes, "\n")))
+
+	return hex.EncodeToString(hash[:8])
+}
+
+// CompileFilters compiles the filter expressions of all entries, see
+// Filter.Compile.
+func (source Source) CompileFilters() error {
+	errs := []error{}
+	for kind, entries := range map[string][]GenRepo{
+		"gogs": source.Gogs, "gitlab": source.Gitlab, "github": source.Github, "gitea": source.Gitea,
+		"bitbucket": source.BitBucket, "onedev": source.OneDev, "sourcehut": source.Sourcehut, "any": source.Any,
+	} {
+		for _, e := range entries {
+			if err := e.Filter.Compile(); err != nil {
+				errs = append(errs, fmt.Errorf("invalid filter expression of a %s source: %w", kind, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // Count TODO.
 func (source Source) Count() int {
 	return len(source.Gogs) +
@@ -262,7 +457,8 @@ func (source Source) Count() int {
 
 // GenRepo Generell Repo.
 type GenRepo struct {
-	Token             string     `yaml:"token"`
+	Name              string     `yaml:"name"`
+	Token             string     `yaml:"token" secret:"true"`
 	TokenFile         string     `yaml:"token_file"`
 	User              string     `yaml:"user"`
 	Email             string     `yaml:"email"`
@@ -270,14 +466,20 @@ type GenRepo struct {
 	SSH               bool       `yaml:"ssh"`
 	SSHKey            string     `yaml:"sshkey"`
 	Username          string     `yaml:"username"`
-	Password          string     `yaml:"password"`
+	Password          string     `yaml:"password" secret:"true"`
 	URL               string     `yaml:"url"`
 	Exclude           []string   `yaml:"exclude"`
 	ExcludeOrgs       []string   `yaml:"excludeorgs"`
 	Include           []string   `yaml:"include"`
 	IncludeOrgs       []string   `yaml:"includeorgs"`
 	Issues            bool       `yaml:"issues"`
+	PullRequests      bool       `yaml:"pullrequests"`
+	Releases          bool       `yaml:"releases"`
+	Export            bool       `yaml:"export"`
+	Metadata          bool       `yaml:"metadata"`
 	Wiki              bool       `yaml:"wiki"`
+	GroupWikis        bool       `yaml:"groupwikis"`
+	Snippets          bool       `yaml:"snippets"`
 	Starred           bool       `yaml:"starred"`
 	CreateOrg         bool       `yaml:"createorg"`
 	Visibility        Visibility `yaml:"visibility"`
@@ -288,9 +490,143 @@ type GenRepo struct {
 	LFS               bool       `yaml:"lfs"`
 	Mirror            Mirror     `yaml:"mirror"`
 	Gists             bool       `yaml:"gists"`
+	MemberGists       bool       `yaml:"membergists"`
 	AppID             int64      `yaml:"app_id"`
 	AppInstallationID int64      `yaml:"app_installation_id"`
 	AppPrivateKeyFile string     `yaml:"app_private_key_file"`
+	// Destinations restricts the repositories of a source to the destinations
+	// with these names.
+	Destinations []string `yaml:"destinations"`
+	// Routes select the repositories a destination backs up.
+	Routes []Route `yaml:"routes"`
+	// NameTemplate is the name of repositories on a destination, see
+	// RenderName.
+	NameTemplate string `yaml:"nametemplate"`
+	// OwnerMap maps owners of sources to owners on a destination, see
+	// TargetOwner.
+	OwnerMap      map[string]string `yaml:"ownermap"`
+	OwnerFallback string            `yaml:"ownerfallback"`
+	// Subgroups places repositories in GitLab subgroups below User named
+	// after the owner in the source.
+	Subgroups bool `yaml:"subgroups"`
+	// Upstream is what a destination does with repositories deleted or
+	// renamed upstream.
+	Upstream `yaml:",inline"`
+	// Scope identifies a source entry in the state kept between runs, see
+	// Source.SetScopes.
+	Scope string `yaml:"-"`
+}
+
+// Actions of destinations for repositories deleted or renamed upstream.
+const (
+	// ActionKeep leaves the backup as it is, it is the default.
+	ActionKeep = "keep"
+	// ActionArchive archives the repository on a forge.
+	ActionArchive = "archive"
+	// ActionMove moves the backup to DeletedDir on path destinations.
+	ActionMove = "move"
+	// ActionRename renames the backup to the new name of the repository.
+	ActionRename = "rename"
+)
+
+// DeletedDir is where path destinations move the backups of repositories
+// deleted upstream.
+const DeletedDir = "_deleted"
+
+// Upstream configures what a destination does with the backups of
+// repositories deleted or renamed upstream.
+type Upstream struct {
+	// OnDelete is keep, archive or move.
+	OnDelete string `yaml:"ondelete"`
+	// OnRename is keep or rename, keep starts a new backup under the new
+	// name.
+	OnRename string `yaml:"onrename"`
+}
+
+// DeleteAction returns the action for deleted repositories.
+func (u Upstream) DeleteAction() (string, error) {
+	return action(u.OnDelete, "ondelete", ActionKeep, ActionArchive, ActionMove)
+}
+
+// RenameAction returns the action for renamed repositories.
+func (u Upstream) RenameAction() (string, error) {
+	return action(u.OnRename, "onrename", ActionKeep, ActionRename)
+}
+
+// upstreamActions are the actions besides keep the kinds of destinations can
+// carry out.
+var upstreamActions = map[string][]string{
+	"local":     {ActionMove, ActionRename},
+	"s3":        {ActionMove, ActionRename},
+	"azureblob": {ActionMove, ActionRename},
+	"webdav":    {ActionMove, ActionRename},
+	"gitea":     {ActionArchive, ActionRename},
+	"gitlab":    {ActionArchive, ActionRename},
+	"github":    {ActionArchive, ActionRename},
+}
+
+// Check returns an error if an action of u is unknown or a destination of
+// kind can't carry it out.
+func (u Upstream) Check(kind string) error {
+	for _, get := range []func() (string, error){u.DeleteAction, u.RenameAction} {
+		action, err := get()
+		if err != nil {
+			return err
+		}
+
+		if action != ActionKeep && !slices.Contains(upstreamActions[kind], action) {
+			return fmt.Errorf("%s destinations don't support the upstream action %s", kind, action)
+		}
+	}
+
+	return nil
+}
+
+// CheckUpstream returns the errors of the ondelete and onrename actions of
+// all destinations, see Upstream.Check.
+func (dest Destination) CheckUpstream() error {
+	errs := []error{}
+	check := func(kind string, u Upstream) {
+		if err := u.Check(kind); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, d := range dest.Local {
+		check("local", d.Upstream)
+	}
+	for _, d := range dest.S3 {
+		check("s3", d.Upstream)
+	}
+	for _, d := range dest.AzureBlob {
+		check("azureblob", d.Upstream)
+	}
+	for _, d := range dest.WebDAV {
+		check("webdav", d.Upstream)
+	}
+	for kind, repos := range map[string][]GenRepo{
+		"gitea": dest.Gitea, "gogs": dest.Gogs, "gitlab": dest.Gitlab, "github": dest.Github,
+		"onedev": dest.OneDev, "sourcehut": dest.Sourcehut,
+	} {
+		for _, d := range repos {
+			check(kind, d.Upstream)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func action(value, option string, valid ...string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return ActionKeep, nil
+	}
+
+	if !slices.Contains(valid, value) {
+		return "", fmt.Errorf("unknown %s action %s, use %s", option, value, strings.Join(valid, ", "))
+	}
+
+	return value, nil
 }
 
 // Mirror struct
@@ -313,6 +649,176 @@ type Filter struct {
 	Languages            []string `yaml:"languages"`
 	ExcludeArchived      bool     `yaml:"excludearchived"`
 	ExcludeForks         bool     `yaml:"excludeforks"`
+	// Expr is an expression on the attributes of FilterEnv, repositories are
+	// only backed up if it is true.
+	Expr string `yaml:"expr"`
+	// MaxSize and MinSize limit the size of repositories, like 500MB or 20G.
+	MaxSize string `yaml:"maxsize"`
+	MinSize string `yaml:"minsize"`
+	// Oversize is what happens to repositories larger than MaxSize, one of
+	// OversizeSkip, OversizeShallow and OversizeRoute.
+	Oversize string `yaml:"oversize"`
+	// OversizeDestinations are the names of the destinations oversized
+	// repositories are routed to.
+	OversizeDestinations []string `yaml:"oversizedestinations"`
+}
+
+// Policies for repositories larger than the maxsize of their filter.
+const (
+	// OversizeSkip skips them, it is the default.
+	OversizeSkip = "skip"
+	// OversizeShallow backs up only their latest commits.
+	OversizeShallow = "shallow"
+	// OversizeRoute backs them up to the oversize destinations only.
+	OversizeRoute = "route"
+)
+
+var sizeRx = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kmgt]?)i?b?$`)
+
+// ParseSize parses a size like 500MB, 1.5G or 20GiB into kilobytes, units are
+// powers of 1024. A plain number is in bytes.
+func ParseSize(size string) (int64, error) {
+	match := sizeRx.FindStringSubmatch(strings.ToLower(strings.TrimSpace(size)))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	exponent := strings.Index("kmgt", match[2]) + 1
+	if match[2] == "" {
+		exponent = 0
+	}
+
+	for range exponent {
+		value *= 1024
+	}
+
+	return int64(value / 1024), nil
+}
+
+// SizeLimits returns the minimum and maximum size in kilobytes, 0 if unset.
+func (f Filter) SizeLimits() (int64, int64, error) {
+	minSize, maxSize := int64(0), int64(0)
+
+	if f.MinSize != "" {
+		size, err := ParseSize(f.MinSize)
+		if err != nil {
+			return 0, 0, fmt.Errorf("minsize: %w", err)
+		}
+		minSize = size
+	}
+
+	if f.MaxSize != "" {
+		size, err := ParseSize(f.MaxSize)
+		if err != nil {
+			return 0, 0, fmt.Errorf("maxsize: %w", err)
+		}
+		maxSize = size
+	}
+
+	switch strings.ToLower(f.Oversize) {
+	case "", OversizeSkip, OversizeShallow:
+	case OversizeRoute:
+		if len(f.OversizeDestinations) == 0 {
+			return 0, 0, fmt.Errorf("oversize %s needs oversizedestinations", OversizeRoute)
+		}
+	default:
+		return 0, 0, fmt.Errorf("unknown oversize policy %s, use skip, shallow or route", f.Oversize)
+	}
+
+	return minSize, maxSize, nil
+}
+
+// programs caches the compiled filter expressions by their source.
+var programs sync.Map
+
+// FilterEnv are the attributes of a repository filter expressions see.
+// Attributes a hoster doesn't report are empty, Size is in kilobytes.
+type FilterEnv struct {
+	Name         string    `expr:"name"`
+	Owner        string    `expr:"owner"`
+	Size         int64     `expr:"size"`
+	Topics       []string  `expr:"topics"`
+	Visibility   string    `expr:"visibility"`
+	Archived     bool      `expr:"archived"`
+	Fork         bool      `expr:"fork"`
+	Stars        int       `expr:"stars"`
+	Language     string    `expr:"language"`
+	LastActivity time.Time `expr:"lastactivity"`
+}
+
+// Compile compiles the filter expression, it has to be called before Match.
+func (f Filter) Compile() error {
+	if strings.TrimSpace(f.Expr) == "" {
+		return nil
+	}
+
+	if _, ok := programs.Load(f.Expr); ok {
+		return nil
+	}
+
+	program, err := expr.Compile(f.Expr, expr.Env(FilterEnv{}), expr.AsBool())
+	if err != nil {
+		return err
+	}
+
+	programs.Store(f.Expr, program)
+
+	return nil
+}
+
+// program returns the compiled filter expression, nil if there is none.
+func (f Filter) program() *vm.Program {
+	program, ok := programs.Load(f.Expr)
+	if !ok {
+		return nil
+	}
+
+	return program.(*vm.Program)
+}
+
+// Uses reports whether the filter expression refers to the attribute, so
+// attributes that need extra requests are only fetched if needed.
+func (f Filter) Uses(attribute string) bool {
+	program := f.program()
+	if program == nil {
+		return false
+	}
+
+	return ast.Find(program.Node(), func(n ast.Node) bool {
+		ident, ok := n.(*ast.IdentifierNode)
+
+		return ok && ident.Value == attribute
+	}) != nil
+}
+
+// Match reports whether the repository passes the filter expression. It is
+// true without an expression and false if the expression wasn't compiled or
+// its evaluation fails.
+func (f Filter) Match(env FilterEnv) bool {
+	if strings.TrimSpace(f.Expr) == "" {
+		return true
+	}
+
+	program := f.program()
+	if program == nil {
+		log.Error().Str("repo", env.Name).Msg("the filter expression wasn't compiled")
+		return false
+	}
+
+	out, err := expr.Run(program, env)
+	if err != nil {
+		log.Warn().Str("repo", env.Name).Err(err).Msg("can't evaluate the filter expression")
+		return false
+	}
+
+	match, _ := out.(bool)
+
+	return match
 }
 
 // GetToken TODO.
@@ -328,6 +834,38 @@ func (grepo GenRepo) GetToken() string {
 	return token
 }
 
+// TargetOwner returns the owner of a repository of owner on a destination:
+// the mapping of the longest owner path in OwnerMap, like acme for acme/team,
+// with the rest of the path appended, else OwnerFallback, else User, with the
+// owner below it if Subgroups is set, else the owner itself if CreateOrg is
+// set. It is empty for the user of the token.
+func (grepo GenRepo) TargetOwner(owner string) string {
+	for prefix := owner; prefix != ""; {
+		if target, ok := grepo.OwnerMap[prefix]; ok {
+			return path.Join(target, strings.TrimPrefix(owner, prefix))
+		}
+
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+
+	switch {
+	case grepo.OwnerFallback != "":
+		return grepo.OwnerFallback
+	case grepo.User != "" && grepo.Subgroups && owner != "":
+		return path.Join(grepo.User, owner)
+	case grepo.User != "":
+		return grepo.User
+	case grepo.CreateOrg:
+		return owner
+	}
+
+	return ""
+}
+
 // HasAppAuth returns true when all GitHub App authentication fields are set.
 func (grepo GenRepo) HasAppAuth() bool {
 	return grepo.AppID > 0 && grepo.AppInstallationID > 0 && grepo.AppPrivateKeyFile != ""
@@ -427,17 +965,389 @@ func resolveToken(tokenString string, tokenFile string) (string, error) {
 
 // Repo TODO.
 type Repo struct {
-	Name        string
-	URL         string
-	SSHURL      string
-	Token       string
-	Origin      GenRepo
-	Owner       string
-	Hoster      string
-	Description string
-	Issues      map[string]interface{}
+	// ID identifies the repository on its hoster across renames, it is
+	// empty if the source doesn't know one.
+	ID           string
+	Name         string
+	URL          string
+	SSHURL       string
+	Token        string
+	Origin       GenRepo
+	Owner        string
+	Hoster       string
+	Description  string
+	Issues       map[string]interface{}
+	PullRequests map[string]interface{}
+	// Comments are the comments of gists.
+	Comments map[string]interface{}
+	Releases []Release
+	// Export is the archive of a project export, it is written next to the
+	// repository.
+	Export *Asset
+	// Metadata is stored as <repo>.meta.json next to the repository.
+	Metadata    *Metadata
 	Private     bool
 	NoTokenUser bool
+	// Source is the kind of source the repository was found by, like github.
+	Source string
+	// PreviousName is the name earlier versions of gickup stored the
+	// repository under, its backups are moved to Name.
+	PreviousName string
+	// Enrich fetches the details of the repository from its hoster, like its
+	// issues and releases. It is called once the duplicates found by other
+	// sources are dropped, nothing is fetched for them.
+	Enrich func(ctx context.Context, r *Repo)
+	// Size is the size reported by the hoster in kilobytes, 0 if unknown.
+	Size int64
+	// Shallow repositories are cloned with their latest commits only.
+	Shallow bool
+	// Destinations are the names of the destinations the repository is
+	// backed up to, every destination if empty.
+	Destinations []string
+}
+
+// NameData are the variables of name templates.
+type NameData struct {
+	Hoster     string
+	Owner      string
+	Name       string
+	Date       string
+	Visibility string
+	Source     string
+}
+
+// nameFuncs are the string functions of name templates, the piped value is
+// their last argument.
+var nameFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(old, replacement, s string) string { return strings.ReplaceAll(s, old, replacement) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"default": func(fallback, s string) string {
+		if s == "" {
+			return fallback
+		}
+
+		return s
+	},
+}
+
+// StructuredName is the name template of structured destinations.
+const StructuredName = "{{.Hoster}}/{{.Owner}}/{{.Name}}"
+
+// RenderName renders the name of the repository on a destination with the
+// template tmpl, StructuredName if it is empty and structured is set. Without
+// both the name is kept. Names can't leave the destination with .. or /.
+func RenderName(tmpl string, structured bool, r Repo, date time.Time) (string, error) {
+	if tmpl == "" {
+		if !structured {
+			return r.Name, nil
+		}
+
+		tmpl = StructuredName
+	}
+
+	t, err := template.New("name").Funcs(nameFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, NameData{
+		Hoster:     r.Hoster,
+		Owner:      r.Owner,
+		Name:       r.Name,
+		Date:       date.Format("2006-01-02"),
+		Visibility: r.GetMetadata().Visibility,
+		Source:     r.Source,
+	}); err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSpace(b.String())
+	if name == "" || strings.HasPrefix(name, "/") || slices.Contains(strings.Split(name, "/"), "..") {
+		return "", fmt.Errorf("invalid name %q of %s", name, r.Name)
+	}
+
+	return path.Clean(name), nil
+}
+
+// Route selects repositories for a destination, every criterion that is set
+// has to match.
+type Route struct {
+	// Sources are kinds like github, names or hosts of sources.
+	Sources []string `yaml:"sources"`
+	// Owners and Names are patterns like include and exclude.
+	Owners     []string `yaml:"owners"`
+	Names      []string `yaml:"names"`
+	Visibility string   `yaml:"visibility"`
+	// Topics match repositories with any of them.
+	Topics []string `yaml:"topics"`
+}
+
+// Match reports whether the repository matches the route.
+func (route Route) Match(r Repo) bool {
+	if len(route.Sources) > 0 && !slices.ContainsFunc(route.Sources, func(source string) bool {
+		return strings.EqualFold(source, r.Source) || source == r.Origin.Name || strings.EqualFold(source, r.Hoster)
+	}) {
+		return false
+	}
+
+	if len(route.Owners) > 0 && !NewMatcher(route.Owners).Match(r.Owner) {
+		return false
+	}
+
+	if len(route.Names) > 0 && !NewMatcher(route.Names).MatchRepo(r.Owner, r.Name) {
+		return false
+	}
+
+	meta := r.GetMetadata()
+	if route.Visibility != "" && !strings.EqualFold(route.Visibility, meta.Visibility) {
+		return false
+	}
+
+	if len(route.Topics) > 0 && !slices.ContainsFunc(route.Topics, func(topic string) bool {
+		return slices.Contains(meta.Topics, topic)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// RoutedTo reports whether the repository is backed up to the destination
+// with the name and routes. Without routes a destination takes every
+// repository that isn't routed to other destinations by name.
+func (r Repo) RoutedTo(destination string, routes []Route) bool {
+	if len(r.Destinations) > 0 && !slices.Contains(r.Destinations, destination) {
+		return false
+	}
+
+	if len(routes) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(routes, func(route Route) bool { return route.Match(r) })
+}
+
+// CanonicalURL identifies the repository across sources, it is the clone URL
+// without scheme, credentials, port and .git suffix, like
+// github.com/owner/name. SSH URLs are used if there is no clone URL.
+func (r Repo) CanonicalURL() string {
+	raw := r.URL
+	if raw == "" {
+		raw = r.SSHURL
+	}
+
+	return CanonicalURL(raw)
+}
+
+// CanonicalURL returns the canonical form of a clone URL, scp-like SSH URLs
+// like git@github.com:owner/name.git included.
+func CanonicalURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	if !strings.Contains(raw, "://") {
+		// git@host:owner/name
+		if host, repoPath, ok := strings.Cut(raw, ":"); ok && !strings.Contains(host, "/") {
+			raw = "ssh://" + host + "/" + repoPath
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(strings.TrimSuffix(raw, "/"), ".git")
+	}
+
+	repoPath := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+
+	return strings.ToLower(u.Hostname()) + "/" + repoPath
+}
+
+// sidecars are the suffixes of what path destinations store next to a
+// repository: zips, metadata, issues, pull requests, comments, releases and
+// exports.
+var sidecars = []string{"", ".zip", ".meta.json", ".issues", ".pulls", ".comments", ".releases", ".export.tar.gz"}
+
+// StoredAs reports whether the file, directory or object key belongs to the
+// backup of the repository named name on a path destination, bare and mirror
+// clones with their .git suffix included.
+func StoredAs(key, name string) bool {
+	rest, ok := strings.CutPrefix(key, name)
+	if !ok {
+		return false
+	}
+
+	rest = strings.TrimPrefix(rest, ".git")
+	for _, suffix := range sidecars {
+		if after, ok := strings.CutPrefix(rest, suffix); ok && (after == "" || strings.HasPrefix(after, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Metadata is what the hoster knows about a repository beyond its content.
+// Sources fill in what they know, Extra holds details only some hosters have.
+type Metadata struct {
+	Description   string                 `json:"description,omitempty"`
+	Topics        []string               `json:"topics,omitempty"`
+	Homepage      string                 `json:"homepage,omitempty"`
+	DefaultBranch string                 `json:"default_branch,omitempty"`
+	License       string                 `json:"license,omitempty"`
+	Archived      bool                   `json:"archived"`
+	Fork          bool                   `json:"fork"`
+	Parent        string                 `json:"parent,omitempty"`
+	Visibility    string                 `json:"visibility,omitempty"`
+	CreatedAt     *time.Time             `json:"created_at,omitempty"`
+	UpdatedAt     *time.Time             `json:"updated_at,omitempty"`
+	Languages     []string               `json:"languages,omitempty"`
+	Collaborators []string               `json:"collaborators,omitempty"`
+	Extra         map[string]interface{} `json:"extra,omitempty"`
+}
+
+// GetMetadata returns the metadata of the repository, the description and
+// visibility are taken from the repository if the source left them out.
+func (r Repo) GetMetadata() Metadata {
+	meta := Metadata{}
+	if r.Metadata != nil {
+		meta = *r.Metadata
+	}
+
+	if meta.Description == "" {
+		meta.Description = r.Description
+	}
+
+	if meta.Visibility == "" {
+		meta.Visibility = "public"
+		if r.Private {
+			meta.Visibility = "private"
+		}
+	}
+
+	return meta
+}
+
+// SortLanguages returns the languages ordered by their share, the largest
+// first.
+func SortLanguages[T int | int64 | float32 | float64](shares map[string]T) []string {
+	languages := make([]string, 0, len(shares))
+	for language := range shares {
+		languages = append(languages, language)
+	}
+
+	sort.Slice(languages, func(i, j int) bool {
+		if shares[languages[i]] != shares[languages[j]] {
+			return shares[languages[i]] > shares[languages[j]]
+		}
+
+		return languages[i] < languages[j]
+	})
+
+	return languages
+}
+
+// Issue is an issue with its discussion, every hoster backs issues up in
+// this structure. Issue is the issue as the hoster returns it, its fields are
+// written next to the lists, which replace fields of the same name. Lists the
+// hoster doesn't have, or that can't be fetched, are empty.
+type Issue struct {
+	Issue       interface{}
+	Comments    []interface{}
+	Reactions   []interface{}
+	Events      []interface{}
+	Attachments []interface{}
+}
+
+// NewIssue returns an issue with empty lists.
+func NewIssue(issue interface{}) Issue {
+	return Issue{
+		Issue:       issue,
+		Comments:    []interface{}{},
+		Reactions:   []interface{}{},
+		Events:      []interface{}{},
+		Attachments: []interface{}{},
+	}
+}
+
+// List converts the items of a hoster to the items of an Issue list.
+func List[T any](items []T) []interface{} {
+	list := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		list = append(list, item)
+	}
+
+	return list
+}
+
+// MarshalJSON writes the fields of the issue and the lists in one object.
+func (i Issue) MarshalJSON() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if i.Issue != nil {
+		data, err := json.Marshal(i.Issue)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+
+	lists := map[string][]interface{}{
+		"comments":    i.Comments,
+		"reactions":   i.Reactions,
+		"events":      i.Events,
+		"attachments": i.Attachments,
+	}
+	for key, list := range lists {
+		if list == nil {
+			list = []interface{}{}
+		}
+
+		data, err := json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+
+		fields[key] = data
+	}
+
+	return json.Marshal(fields)
+}
+
+// Release is a release of a repository with its assets.
+type Release struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Body        string    `json:"body"`
+	Author      string    `json:"author"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	CreatedAt   time.Time `json:"created_at"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []Asset   `json:"assets"`
+}
+
+// Asset is a file attached to a release.
+type Asset struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	// Size is 0 if the hoster doesn't know it.
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+	// SHA256 is the checksum of the content, either from the hoster or set
+	// once the asset is downloaded.
+	SHA256 string `json:"sha256"`
+	// Key identifies a version of the asset at the hoster.
+	Key string `json:"-"`
+	// Open downloads the asset.
+	Open func(ctx context.Context) (io.ReadCloser, error) `json:"-"`
 }
 
 // Site TODO.
@@ -517,31 +1427,107 @@ var (
 	DotGitRx = regexp.MustCompile(`\.git$`)
 )
 
-// GetMap TODO.
-func GetMap(excludes []string) map[string]bool {
-	excludemap := make(map[string]bool)
-	for _, exclude := range excludes {
-		excludemap[exclude] = true
+// Matcher matches names against the patterns of include, exclude,
+// includeorgs, excludeorgs and the languages filter. A pattern enclosed in
+// slashes or starting with ^ is a regular expression, one with *, ? or [ is a
+// glob and every other pattern is an exact name. Exact names and globs that
+// contain a / are matched against owner/name.
+type Matcher struct {
+	exact   map[string]bool
+	globs   []string
+	regexps []*regexp.Regexp
+}
+
+// IsPattern reports whether pattern is a glob or a regular expression.
+func IsPattern(pattern string) bool {
+	return isRegexp(pattern) || strings.ContainsAny(pattern, "*?[")
+}
+
+func isRegexp(pattern string) bool {
+	return strings.HasPrefix(pattern, "^") || (len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"))
+}
+
+// NewMatcher returns a matcher of the patterns. Invalid patterns are logged
+// and match nothing.
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{exact: map[string]bool{}}
+	for _, pattern := range patterns {
+		switch {
+		case isRegexp(pattern):
+			rx, err := regexp.Compile(strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/"))
+			if err != nil {
+				log.Warn().Str("pattern", pattern).Err(err).Msg("invalid regular expression")
+				continue
+			}
+			m.regexps = append(m.regexps, rx)
+		case IsPattern(pattern):
+			if _, err := path.Match(pattern, ""); err != nil {
+				log.Warn().Str("pattern", pattern).Err(err).Msg("invalid glob")
+				continue
+			}
+			m.globs = append(m.globs, pattern)
+		default:
+			m.exact[pattern] = true
+		}
 	}
 
-	return excludemap
+	return m
+}
+
+// Empty reports whether the matcher has no patterns.
+func (m *Matcher) Empty() bool {
+	return len(m.exact) == 0 && len(m.globs) == 0 && len(m.regexps) == 0
 }
 
-func statRemoteSSH(sshURL string, repo GenRepo) (string, transport.AuthMethod, error) {
-	url := DotGitRx.ReplaceAllString(sshURL, ".wiki.git")
+// Add adds the exact name.
+func (m *Matcher) Add(name string) {
+	m.exact[name] = true
+}
 
+// Match reports whether name matches one of the patterns.
+func (m *Matcher) Match(name string) bool {
+	if m.exact[name] {
+		return true
+	}
+
+	for _, glob := range m.globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+
+	for _, rx := range m.regexps {
+		if rx.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchRepo reports whether the repository name of owner matches one of the
+// patterns, either by its name or as owner/name.
+func (m *Matcher) MatchRepo(owner, name string) bool {
+	return m.Match(name) || (owner != "" && m.Match(owner+"/"+name))
+}
+
+func statRemoteSSH(repo GenRepo) (transport.AuthMethod, error) {
 	if repo.SSHKey == "" {
 		home := os.Getenv("HOME")
 		repo.SSHKey = path.Join(home, ".ssh", "id_rsa")
 	}
 
-	auth, err := ssh.NewPublicKeysFromFile("git", repo.SSHKey, "")
-
-	return url, auth, err
+	return ssh.NewPublicKeysFromFile("git", repo.SSHKey, "")
 }
 
-// StatRemote TODO.
+// StatRemote reports whether the wiki of the repository exists.
 func StatRemote(remoteURL, sshURL string, repo GenRepo) bool {
+	return RemoteExists(DotGitRx.ReplaceAllString(remoteURL, ".wiki.git"), DotGitRx.ReplaceAllString(sshURL, ".wiki.git"), repo)
+}
+
+// RemoteExists reports whether the repository answers at remoteURL, or at
+// sshURL if the source uses SSH, with the credentials of the source.
+func RemoteExists(remoteURL, sshURL string, repo GenRepo) bool {
 	var (
 		url  string
 		auth transport.AuthMethod
@@ -549,12 +1535,13 @@ func StatRemote(remoteURL, sshURL string, repo GenRepo) bool {
 	)
 
 	if repo.SSH {
-		url, auth, err = statRemoteSSH(sshURL, repo)
+		url = sshURL
+		auth, err = statRemoteSSH(repo)
 		if err != nil {
 			return false
 		}
 	} else {
-		url = DotGitRx.ReplaceAllString(remoteURL, ".wiki.git")
+		url = remoteURL
 		if repo.Token != "" {
 			auth = &http.BasicAuth{
 				Username: "xyz",
@@ -579,12 +1566,15 @@ func StatRemote(remoteURL, sshURL string, repo GenRepo) bool {
 }
 
 type S3Repo struct {
+	Name             string  `yaml:"name"`
+	Routes           []Route `yaml:"routes"`
+	NameTemplate     string  `yaml:"nametemplate"`
 	Bucket           string  `yaml:"bucket"`
 	Endpoint         string  `yaml:"endpoint"`
 	UseStaticCreds   bool    `yaml:"use_static_creds" default:"true"`
-	AccessKey        string  `yaml:"accesskey"`
-	SecretKey        string  `yaml:"secretkey"`
-	Token            string  `yaml:"token"`
+	AccessKey        string  `yaml:"accesskey" secret:"true"`
+	SecretKey        string  `yaml:"secretkey" secret:"true"`
+	Token            string  `yaml:"token" secret:"true"`
 	Region           string  `yaml:"region"`
 	UseSSL           bool    `yaml:"usessl"`
 	Structured       bool    `yaml:"structured"`
@@ -592,6 +1582,7 @@ type S3Repo struct {
 	StorageClass     string  `yaml:"storageclass"`
 	DateCreateDir    bool    `yaml:"datecreatedir"`
 	SrcRepoUrlTagKey *string `yaml:"src_repo_url_tag_key"`
+	Upstream         `yaml:",inline"`
 }
 
 func (s3 S3Repo) GetKey(accessString string) (string, error) {
@@ -610,23 +1601,31 @@ func (s3 S3Repo) GetKey(accessString string) (string, error) {
 }
 
 type AzureBlob struct {
-	Url              string `yaml:"url"`
-	Container        string `yaml:"container"`
-	UseCliCredential bool   `yaml:"useclicredential"`
-	TenantId         string `yaml:"tenantid"`
-	ClientId         string `yaml:"clientid"`
-	ClientSecret     string `yaml:"clientsecret"`
-	Structured       bool   `yaml:"structured"`
-	Zip              bool   `yaml:"zip"`
-	DateCreateDir    bool   `yaml:"datecreatedir"`
+	Name             string  `yaml:"name"`
+	Routes           []Route `yaml:"routes"`
+	NameTemplate     string  `yaml:"nametemplate"`
+	Url              string  `yaml:"url"`
+	Container        string  `yaml:"container"`
+	UseCliCredential bool    `yaml:"useclicredential"`
+	TenantId         string  `yaml:"tenantid"`
+	ClientId         string  `yaml:"clientid"`
+	ClientSecret     string  `yaml:"clientsecret" secret:"true"`
+	Structured       bool    `yaml:"structured"`
+	Zip              bool    `yaml:"zip"`
+	DateCreateDir    bool    `yaml:"datecreatedir"`
+	Upstream         `yaml:",inline"`
 }
 
 type WebDAVRepo struct {
-	Url           string `yaml:"url"`
-	Username      string `yaml:"username"`
-	Password      string `yaml:"password"`
-	Path          string `yaml:"path"`
-	Structured    bool   `yaml:"structured"`
-	Zip           bool   `yaml:"zip"`
-	DateCreateDir bool   `yaml:"datecreatedir"`
+	Name          string  `yaml:"name"`
+	Routes        []Route `yaml:"routes"`
+	NameTemplate  string  `yaml:"nametemplate"`
+	Url           string  `yaml:"url"`
+	Username      string  `yaml:"username"`
+	Password      string  `yaml:"password" secret:"true"`
+	Path          string  `yaml:"path"`
+	Structured    bool    `yaml:"structured"`
+	Zip           bool    `yaml:"zip"`
+	DateCreateDir bool    `yaml:"datecreatedir"`
+	Upstream      `yaml:",inline"`
 }
@@ -205,3 +205,40 @@ func shouldRetry(resp *http.Response, err error) bool {
 	}
 	return false
 }
+
+// Move moves the files of the repository named from, with everything stored
+// next to it, to the name to below the path of repo.
+func Move(repo types.WebDAVRepo, from, to string) (int, error) {
+	sub = logger.CreateSubLogger("stage", "webdav", "url", repo.Url)
+	c := newClient(repo)
+	dir := path.Join(repo.Path, path.Dir(from))
+	base := path.Base(from)
+
+	files, err := c.ReadDir(dir)
+	if err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	moved := 0
+	for _, f := range files {
+		if !types.StoredAs(f.Name(), base) {
+			continue
+		}
+
+		target := path.Join(repo.Path, to+strings.TrimPrefix(f.Name(), base))
+		if err := c.MkdirAll(path.Dir(target), 0o755); err != nil {
+			return moved, err
+		}
+
+		sub.Debug().Msgf("Moving %s to %s", path.Join(dir, f.Name()), target)
+		if err := c.Rename(path.Join(dir, f.Name()), target, false); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+
+	return moved, nil
+}
@@ -1,6 +1,7 @@
 package whatever
 
 import (
+	"context"
 	"path"
 	"path/filepath"
 	"strings"
@@ -31,7 +32,7 @@ func getRepoNameAndHost(rawURL string) (string, string) {
 }
 
 // Get TODO.
-func Get(conf *types.Conf) ([]types.Repo, bool) {
+func Get(_ context.Context, conf *types.Conf) ([]types.Repo, bool) {
 	ran := false
 	repos := []types.Repo{}
 	if len(conf.Source.Any) > 0 {
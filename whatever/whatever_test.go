@@ -1,6 +1,7 @@
 package whatever
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -17,7 +18,7 @@ func TestGetBuildsRemoteRepo(t *testing.T) {
 		},
 	}
 
-	repos, ran := Get(conf)
+	repos, ran := Get(context.Background(), conf)
 	if !ran {
 		t.Fatal("expected adapter to run")
 	}
@@ -41,7 +42,7 @@ func TestGetBuildsSSHRemoteRepo(t *testing.T) {
 		},
 	}
 
-	repos, ran := Get(conf)
+	repos, ran := Get(context.Background(), conf)
 	if !ran {
 		t.Fatal("expected adapter to run")
 	}
@@ -65,7 +66,7 @@ func TestGetBuildsSCPRemoteRepo(t *testing.T) {
 		},
 	}
 
-	repos, ran := Get(conf)
+	repos, ran := Get(context.Background(), conf)
 	if !ran {
 		t.Fatal("expected adapter to run")
 	}
@@ -94,7 +95,7 @@ func TestGetBuildsLocalRepo(t *testing.T) {
 		},
 	}
 
-	repos, ran := Get(conf)
+	repos, ran := Get(context.Background(), conf)
 	if !ran {
 		t.Fatal("expected adapter to run")
 	}
@@ -118,7 +119,7 @@ func TestGetSkipsMissingURL(t *testing.T) {
 		},
 	}
 
-	repos, ran := Get(conf)
+	repos, ran := Get(context.Background(), conf)
 	if !ran {
 		t.Fatal("expected adapter to run")
 	}